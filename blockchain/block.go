@@ -3,6 +3,7 @@ package blockchain
 import (
 	"bytes"
 	"encoding/gob"
+	"errors"
 	"log"
 	"time"
 )
@@ -17,13 +18,42 @@ type Block struct {
 
 }
 
+// HashTransactions returns the Merkle root of the block's transaction IDs.
 func (b *Block) HashTransactions() []byte {
+	return b.MerkleTree().RootNode.Data
+}
+
+// MerkleTree builds the Merkle tree of the block's transaction IDs.
+func (b *Block) MerkleTree() *MerkleTree {
 	var txHashes [][]byte
 
 	for _, tx := range b.Transactions {
-		txHashes = append(txHashes, tx.Serialize())
+		txHashes = append(txHashes, tx.ID)
+	}
+
+	return NewMerkleTree(txHashes)
+}
+
+// MerkleProof proves that the transaction with the given ID is in the block.
+func (b *Block) MerkleProof(txID []byte) (MerkleProof, error) {
+	for index, tx := range b.Transactions {
+		if bytes.Equal(tx.ID, txID) {
+			return b.MerkleTree().Proof(index)
+		}
+	}
+
+	return MerkleProof{}, errors.New("Transaction is not in the block")
+}
+
+// HashWitnesses returns the Merkle root of the block's witness hashes, which
+// commits to the signatures left out of the transaction IDs.
+func (b *Block) HashWitnesses() []byte {
+	var witnessHashes [][]byte
+
+	for _, tx := range b.Transactions {
+		witnessHashes = append(witnessHashes, tx.WitnessHash())
 	}
-	tree := NewMerkleTree(txHashes)
+	tree := NewMerkleTree(witnessHashes)
 
 	return tree.RootNode.Data
 }
@@ -2,7 +2,6 @@ package blockchain
 
 import (
 	"bytes"
-	"crypto/ecdsa"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -13,6 +12,8 @@ import (
 	"strings"
 
 	badger "github.com/dgraph-io/badger"
+
+	"github.com/mapfumo/golang-blockchain/wallet"
 )
 
 // dbPath is the directory where the BadgerDB database files will be stored.
@@ -112,10 +113,8 @@ func (chain *BlockChain) MineBlock(transactions []*Transaction) *Block {
 	var lastHash []byte
 	var lastHeight int
 
-	for _, tx := range transactions {
-		if !chain.VerifyTransaction(tx) {
-			log.Panic("Invalid Transaction")
-		}
+	if !chain.VerifyTransactions(transactions) {
+		log.Panic("Invalid Transaction")
 	}
 
 	err := chain.Database.View(func(txn *badger.Txn) error {
@@ -243,6 +242,80 @@ func (chain *BlockChain) GetBlockHashes() [][]byte {
 }
 
 
+// GetHeaders returns the headers of the blocks above fromHeight, lowest first.
+func (chain *BlockChain) GetHeaders(fromHeight int) []Header {
+	var headers []Header
+
+	iter := chain.Iterator()
+
+	for {
+		block := iter.Next()
+
+		if block.Height > fromHeight {
+			headers = append([]Header{block.Header()}, headers...)
+		}
+
+		if len(block.PrevHash) == 0 || block.Height <= fromHeight {
+			break
+		}
+	}
+
+	return headers
+}
+
+// FindTxProofs returns every transaction paying to or spending from one of
+// the public key hashes, each with the proof of its inclusion in a block.
+func (chain *BlockChain) FindTxProofs(pubKeyHashes [][]byte) ([]*Transaction, []*TxProof) {
+	var txs []*Transaction
+	var proofs []*TxProof
+
+	iter := chain.Iterator()
+
+	for {
+		block := iter.Next()
+
+		for _, tx := range block.Transactions {
+			if !tx.Involves(pubKeyHashes) {
+				continue
+			}
+
+			proof, err := NewTxProof(block, tx.ID)
+			Handle(err)
+			txs = append(txs, tx)
+			proofs = append(proofs, proof)
+		}
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	return txs, proofs
+}
+
+// FindUsedPubKeyHashes returns the hex encoded public key hashes that any
+// output in the chain was locked to.
+func (chain *BlockChain) FindUsedPubKeyHashes() map[string]bool {
+	used := make(map[string]bool)
+
+	iter := chain.Iterator()
+
+	for {
+		block := iter.Next()
+
+		for _, tx := range block.Transactions {
+			for _, out := range tx.Outputs {
+				used[hex.EncodeToString(out.PubKeyHash)] = true
+			}
+		}
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	return used
+}
 
 func (chain *BlockChain) FindUTXO() map[string]TxOutputs {
 	UTXO := make(map[string]TxOutputs)
@@ -253,6 +326,17 @@ func (chain *BlockChain) FindUTXO() map[string]TxOutputs {
 	for {
 		block := iter.Next()
 
+		// Record the block's spends first, as a transaction may spend an
+		// output of one before it in the same block.
+		for _, tx := range block.Transactions {
+			if tx.IsCoinbase() == false {
+				for _, in := range tx.Inputs {
+					inTxID := hex.EncodeToString(in.ID)
+					spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Out)
+				}
+			}
+		}
+
 		for _, tx := range block.Transactions {
 			txID := hex.EncodeToString(tx.ID)
 
@@ -267,14 +351,9 @@ func (chain *BlockChain) FindUTXO() map[string]TxOutputs {
 				}
 				outs := UTXO[txID]
 				outs.Outputs = append(outs.Outputs, out)
+				outs.Indices = append(outs.Indices, outIdx)
 				UTXO[txID] = outs
 			}
-			if tx.IsCoinbase() == false {
-				for _, in := range tx.Inputs {
-					inTxID := hex.EncodeToString(in.ID)
-					spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Out)
-				}
-			}
 		}
 
 		if len(block.PrevHash) == 0 {
@@ -304,7 +383,28 @@ func (bc *BlockChain) FindTransaction(ID []byte) (Transaction, error) {
 	return Transaction{}, errors.New("Transaction does not exist")
 }
 
-func (bc *BlockChain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey) {
+// FindTransactionBlock returns the block that contains the transaction.
+func (bc *BlockChain) FindTransactionBlock(ID []byte) (Block, error) {
+	iter := bc.Iterator()
+
+	for {
+		block := iter.Next()
+
+		for _, tx := range block.Transactions {
+			if bytes.Equal(tx.ID, ID) {
+				return *block, nil
+			}
+		}
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	return Block{}, errors.New("Transaction does not exist")
+}
+
+func (bc *BlockChain) SignTransaction(tx *Transaction, privKey wallet.SigningKey) {
 	prevTXs := make(map[string]Transaction)
 
 	for _, in := range tx.Inputs {
@@ -317,6 +417,9 @@ func (bc *BlockChain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey)
 }
 
 func (bc *BlockChain) VerifyTransaction(tx *Transaction) bool {
+	if !bytes.Equal(tx.ID, tx.Hash()) {
+		return false
+	}
 	if tx.IsCoinbase() {
 		return true
 	}
@@ -324,13 +427,54 @@ func (bc *BlockChain) VerifyTransaction(tx *Transaction) bool {
 
 	for _, in := range tx.Inputs {
 		prevTX, err := bc.FindTransaction(in.ID)
-		Handle(err)
+		if err != nil {
+			return false
+		}
+		if in.Out < 0 || in.Out >= len(prevTX.Outputs) {
+			return false
+		}
 		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
 	}
 
 	return tx.Verify(prevTXs)
 }
 
+// VerifyTransactions checks a batch of transactions, such as a block, fanning
+// the signature checks of all their inputs out over one worker pool. A
+// transaction may spend outputs of one earlier in the batch.
+func (bc *BlockChain) VerifyTransactions(txs []*Transaction) bool {
+	var checks []inputCheck
+	prevTXs := make(map[string]Transaction)
+
+	for _, tx := range txs {
+		if !bytes.Equal(tx.ID, tx.Hash()) {
+			return false
+		}
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		for inId, in := range tx.Inputs {
+			prevTX, ok := prevTXs[hex.EncodeToString(in.ID)]
+			if !ok {
+				var err error
+				prevTX, err = bc.FindTransaction(in.ID)
+				if err != nil {
+					return false
+				}
+				prevTXs[hex.EncodeToString(in.ID)] = prevTX
+			}
+			if in.Out < 0 || in.Out >= len(prevTX.Outputs) {
+				return false
+			}
+			checks = append(checks, inputCheck{tx, inId, prevTX.Outputs[in.Out]})
+		}
+		prevTXs[hex.EncodeToString(tx.ID)] = *tx
+	}
+
+	return verifyInputs(checks)
+}
+
 func retry(dir string, originalOpts badger.Options) (*badger.DB, error) {
 	lockPath := filepath.Join(dir, "LOCK")
 	if err := os.Remove(lockPath); err != nil {
@@ -0,0 +1,144 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+)
+
+const (
+	// MaxBloomFilterSize and MaxBloomHashFuncs bound what a peer may ask a
+	// full node to evaluate for it.
+	MaxBloomFilterSize = 36000
+	MaxBloomHashFuncs  = 50
+
+	bloomSeedStep = 0xfba4c795
+)
+
+// BloomFilter is a probabilistic set a light client hands to full nodes so
+// they only send it matching transactions, without revealing exactly which
+// addresses it follows. False positives are possible, false negatives not.
+type BloomFilter struct {
+	Filter    []byte
+	HashFuncs uint32
+	Tweak     uint32
+}
+
+// NewBloomFilter sizes a filter for the number of elements and the false
+// positive rate. The tweak randomises the hash functions per client.
+func NewBloomFilter(elements int, fpRate float64, tweak uint32) *BloomFilter {
+	if elements < 1 {
+		elements = 1
+	}
+
+	size := int(-1 / (math.Ln2 * math.Ln2) * float64(elements) * math.Log(fpRate) / 8)
+	size = max(1, min(size, MaxBloomFilterSize))
+
+	hashFuncs := int(float64(size*8) / float64(elements) * math.Ln2)
+	hashFuncs = max(1, min(hashFuncs, MaxBloomHashFuncs))
+
+	return &BloomFilter{make([]byte, size), uint32(hashFuncs), tweak}
+}
+
+// IsValid reports whether the filter is within the limits a node accepts.
+func (f *BloomFilter) IsValid() bool {
+	return len(f.Filter) > 0 && len(f.Filter) <= MaxBloomFilterSize &&
+		f.HashFuncs > 0 && f.HashFuncs <= MaxBloomHashFuncs
+}
+
+func (f *BloomFilter) Add(data []byte) {
+	for i := uint32(0); i < f.HashFuncs; i++ {
+		bit := f.bit(i, data)
+		f.Filter[bit>>3] |= 1 << (bit & 7)
+	}
+}
+
+func (f *BloomFilter) Contains(data []byte) bool {
+	for i := uint32(0); i < f.HashFuncs; i++ {
+		bit := f.bit(i, data)
+		if f.Filter[bit>>3]&(1<<(bit&7)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (f *BloomFilter) bit(i uint32, data []byte) uint32 {
+	return murmur3(i*bloomSeedStep+f.Tweak, data) % uint32(len(f.Filter)*8)
+}
+
+// MatchTransaction reports whether the transaction is relevant to the
+// filter: its ID, an output's public key hash, or an input's spent outpoint
+// or public key is in the filter. Outpoints of matching outputs are added to
+// the filter so that later transactions spending them match too.
+func (f *BloomFilter) MatchTransaction(tx *Transaction) bool {
+	matched := f.Contains(tx.ID)
+
+	for outIdx, out := range tx.Outputs {
+		if f.Contains(out.PubKeyHash) {
+			matched = true
+			f.Add(Outpoint(tx.ID, outIdx))
+		}
+	}
+	if matched || tx.IsCoinbase() {
+		return matched
+	}
+
+	for _, in := range tx.Inputs {
+		if f.Contains(Outpoint(in.ID, in.Out)) || f.Contains(in.PubKey) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Outpoint is the filter element naming output index of transaction txID.
+func Outpoint(txID []byte, index int) []byte {
+	return binary.LittleEndian.AppendUint32(append([]byte{}, txID...), uint32(index))
+}
+
+// murmur3 is the 32-bit MurmurHash3 used to derive the filter's hash
+// functions.
+func murmur3(seed uint32, data []byte) uint32 {
+	const c1, c2 = 0xcc9e2d51, 0x1b873593
+
+	h := seed
+	n := len(data) / 4 * 4
+	for i := 0; i < n; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	var k uint32
+	switch tail := data[n:]; len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+
+	return h
+}
@@ -0,0 +1,64 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+func TestMurmur3(t *testing.T) {
+	tests := []struct {
+		seed uint32
+		data string
+		want uint32
+	}{
+		{0x00000000, "", 0x00000000},
+		{0xfba4c795, "", 0x6a396f08},
+		{0xffffffff, "", 0x81f16f39},
+		{0x00000000, "\x00", 0x514e28b7},
+		{0xfba4c795, "\x00", 0xea3f0b17},
+		{0x00000000, "\xff", 0xfd6cf10d},
+		{0x00000000, "\x00\x11", 0x16c6b7ab},
+		{0x00000000, "\x00\x11\x22", 0x8eb51c3d},
+		{0x00000000, "\x00\x11\x22\x33", 0xb4471bf8},
+		{0x00000000, "\x00\x11\x22\x33\x44", 0xe2301fa8},
+	}
+
+	for _, test := range tests {
+		if got := murmur3(test.seed, []byte(test.data)); got != test.want {
+			t.Errorf("murmur3(%#x, %x) = %#x, want %#x", test.seed, test.data, got, test.want)
+		}
+	}
+}
+
+func TestBloomFilterMatchesTransactions(t *testing.T) {
+	received := CoinbaseTx(testAddress, "received")
+	pubKeyHash := received.Outputs[0].PubKeyHash
+
+	spend := &Transaction{
+		Inputs:  []TxInput{{received.ID, 0, nil, []byte("pubkey"), 0}},
+		Outputs: []TxOutput{{20, []byte("someone else")}},
+	}
+	spend.ID = spend.Hash()
+
+	filter := NewBloomFilter(10, 0.0001, 7)
+	if !filter.IsValid() {
+		t.Fatalf("expected a valid filter, got %d bytes and %d hash functions", len(filter.Filter), filter.HashFuncs)
+	}
+	if filter.MatchTransaction(spend) {
+		t.Errorf("expected the empty filter to match nothing")
+	}
+
+	filter.Add(pubKeyHash)
+	if !filter.MatchTransaction(received) {
+		t.Errorf("expected a payment to the filtered key hash to match")
+	}
+	if !filter.MatchTransaction(spend) {
+		t.Errorf("expected a spend of a matched output to match")
+	}
+
+	unrelated := CoinbaseTx("1111111111111111111114oLvT2", "unrelated")
+	unrelated.Outputs[0].PubKeyHash = []byte("nobody")
+	unrelated.ID = unrelated.Hash()
+	if filter.MatchTransaction(unrelated) {
+		t.Errorf("expected an unrelated transaction not to match")
+	}
+}
@@ -35,21 +35,37 @@ type ProofOfWork struct {
 
 // NewProofOfWork initializes a new ProofOfWork for a given block.
 func NewProofOfWork(block *Block) *ProofOfWork {
+	// Return a new ProofOfWork with the block and target.
+	return &ProofOfWork{Block: block, Target: powTarget()}
+}
+
+// powTarget is the value a valid block hash must be less than.
+func powTarget() *big.Int {
 	target := big.NewInt(1)
 	// Shift the target left by (256 - Difficulty) bits to set the difficulty.
 	target.Lsh(target, uint(256-Difficulty))
-	// Return a new ProofOfWork with the block and target.
-	return &ProofOfWork{Block: block, Target: target}
+	return target
 }
 
 // InitData prepares the data for hashing by combining the block's attributes and the nonce.
 func (pow *ProofOfWork) InitData(nonce int) []byte {
+	return powData(pow.Block.PrevHash, pow.Block.HashTransactions(), pow.Block.HashWitnesses(), pow.Block.Timestamp, pow.Block.Height, nonce)
+}
+
+// powData is the data hashed by proof of work. It depends on the block's
+// transactions only through their Merkle roots, so headers can be checked
+// without the transactions. The timestamp and height are covered too, so a
+// header cannot be given another height or time without being mined again.
+func powData(prevHash, merkleRoot, witnessRoot []byte, timestamp int64, height, nonce int) []byte {
 	data := bytes.Join(
 		[][]byte{
-			pow.Block.PrevHash,           // Previous block's hash.
-			pow.Block.HashTransactions(), // Current block's data.
-			ToHex(int64(nonce)),          // Nonce converted to a byte slice.
-			ToHex(int64(Difficulty)),     // Difficulty level converted to a byte slice.
+			prevHash,                 // Previous block's hash.
+			merkleRoot,               // Current block's data.
+			witnessRoot,              // Signatures of the block's transactions.
+			ToHex(timestamp),         // Time the block was created.
+			ToHex(int64(height)),     // Height of the block in the chain.
+			ToHex(int64(nonce)),      // Nonce converted to a byte slice.
+			ToHex(int64(Difficulty)), // Difficulty level converted to a byte slice.
 		},
 		[]byte{}) // Separator (none needed here).
 	return data
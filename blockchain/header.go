@@ -0,0 +1,59 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"math/big"
+)
+
+// Header holds the parts of a block covered by proof of work. It is enough
+// to follow and validate the chain without downloading any transactions.
+type Header struct {
+	Timestamp   int64
+	Hash        []byte
+	PrevHash    []byte
+	MerkleRoot  []byte // root of the block's transaction IDs
+	WitnessRoot []byte // root of the block's witness hashes
+	Nonce       int
+	Height      int
+}
+
+func (b *Block) Header() Header {
+	return Header{
+		Timestamp:   b.Timestamp,
+		Hash:        b.Hash,
+		PrevHash:    b.PrevHash,
+		MerkleRoot:  b.HashTransactions(),
+		WitnessRoot: b.HashWitnesses(),
+		Nonce:       b.Nonce,
+		Height:      b.Height,
+	}
+}
+
+// Validate checks that the header's hash is the proof of work over its
+// fields and meets the difficulty target.
+func (h *Header) Validate() bool {
+	var intHash big.Int
+
+	hash := sha256.Sum256(powData(h.PrevHash, h.MerkleRoot, h.WitnessRoot, h.Timestamp, h.Height, h.Nonce))
+	intHash.SetBytes(hash[:])
+
+	return bytes.Equal(hash[:], h.Hash) && intHash.Cmp(powTarget()) == -1
+}
+
+func (h *Header) Serialize() []byte {
+	var res bytes.Buffer
+	encoder := gob.NewEncoder(&res)
+	err := encoder.Encode(h)
+	Handle(err)
+	return res.Bytes()
+}
+
+func DeserializeHeader(data []byte) *Header {
+	var header Header
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&header)
+	Handle(err)
+	return &header
+}
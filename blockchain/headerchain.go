@@ -0,0 +1,303 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+
+	badger "github.com/dgraph-io/badger"
+)
+
+const headersPath = "./tmp/headers_%s"
+
+var (
+	// keys in the header database, next to "lh" for the best header's hash
+	headerPrefix   = []byte("header-")
+	provenTxPrefix = []byte("proven-")
+)
+
+// HeaderChain is the chain as seen by a light (SPV) client: block headers
+// plus the transactions relevant to its wallet, each with a Merkle proof
+// tying it to one of the headers.
+type HeaderChain struct {
+	LastHash []byte
+	Database *badger.DB
+}
+
+// ProvenTransaction is a transaction together with the proof that it is
+// included in a block.
+type ProvenTransaction struct {
+	Tx    Transaction
+	Proof TxProof
+}
+
+// SPVOutput is an unspent output known to a light client.
+type SPVOutput struct {
+	TxID          []byte
+	Index         int
+	Value         int
+	Confirmations int
+}
+
+// OpenHeaderChain opens the header database of a light client, creating an
+// empty one if needed.
+func OpenHeaderChain(nodeId string) *HeaderChain {
+	path := fmt.Sprintf(headersPath, nodeId)
+	err := os.MkdirAll(path, 0755)
+	Handle(err)
+
+	opts := badger.DefaultOptions(path)
+	opts.Logger = nil
+	opts.ValueDir = path
+
+	db, err := openDB(path, opts)
+	Handle(err)
+
+	var lastHash []byte
+	err = db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("lh"))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		lastHash, err = item.ValueCopy(nil)
+		return err
+	})
+	Handle(err)
+
+	return &HeaderChain{lastHash, db}
+}
+
+// AddHeader validates the header's proof of work and its link to a known
+// parent, stores it and makes it the tip if it extends the best chain.
+// The first header must be a genesis header.
+func (hc *HeaderChain) AddHeader(header Header) error {
+	if !header.Validate() {
+		return fmt.Errorf("header %x has invalid proof of work", header.Hash)
+	}
+
+	return hc.Database.Update(func(txn *badger.Txn) error {
+		if _, err := txn.Get(headerKey(header.Hash)); err == nil {
+			return nil
+		}
+
+		if len(header.PrevHash) == 0 {
+			if header.Height != 0 {
+				return fmt.Errorf("header %x has no parent", header.Hash)
+			}
+			if len(hc.LastHash) > 0 {
+				genesis, err := hc.getHeader(txn, hc.LastHash)
+				if err != nil {
+					return err
+				}
+				for len(genesis.PrevHash) > 0 {
+					if genesis, err = hc.getHeader(txn, genesis.PrevHash); err != nil {
+						return err
+					}
+				}
+				if !bytes.Equal(genesis.Hash, header.Hash) {
+					return fmt.Errorf("header %x is a different genesis", header.Hash)
+				}
+			}
+		} else {
+			parent, err := hc.getHeader(txn, header.PrevHash)
+			if err != nil {
+				return fmt.Errorf("header %x has an unknown parent", header.Hash)
+			}
+			if header.Height != parent.Height+1 {
+				return fmt.Errorf("header %x has height %d after %d", header.Hash, header.Height, parent.Height)
+			}
+		}
+
+		if err := txn.Set(headerKey(header.Hash), header.Serialize()); err != nil {
+			return err
+		}
+
+		if len(hc.LastHash) == 0 {
+			hc.LastHash = header.Hash
+			return txn.Set([]byte("lh"), header.Hash)
+		}
+
+		tip, err := hc.getHeader(txn, hc.LastHash)
+		if err != nil {
+			return err
+		}
+		if header.Height > tip.Height {
+			hc.LastHash = header.Hash
+			return txn.Set([]byte("lh"), header.Hash)
+		}
+
+		return nil
+	})
+}
+
+func (hc *HeaderChain) GetHeader(hash []byte) (Header, error) {
+	var header Header
+
+	err := hc.Database.View(func(txn *badger.Txn) error {
+		var err error
+		header, err = hc.getHeader(txn, hash)
+		return err
+	})
+
+	return header, err
+}
+
+func (hc *HeaderChain) getHeader(txn *badger.Txn, hash []byte) (Header, error) {
+	item, err := txn.Get(headerKey(hash))
+	if err != nil {
+		return Header{}, errors.New("Header is not found")
+	}
+	data, err := item.ValueCopy(nil)
+	if err != nil {
+		return Header{}, err
+	}
+
+	return *DeserializeHeader(data), nil
+}
+
+// GetBestHeight returns the height of the tip, or -1 with no headers yet.
+func (hc *HeaderChain) GetBestHeight() int {
+	if len(hc.LastHash) == 0 {
+		return -1
+	}
+
+	tip, err := hc.GetHeader(hc.LastHash)
+	Handle(err)
+
+	return tip.Height
+}
+
+// InBestChain reports whether the header is an ancestor of (or is) the tip.
+func (hc *HeaderChain) InBestChain(hash []byte) bool {
+	header, err := hc.GetHeader(hash)
+	if err != nil || len(hc.LastHash) == 0 {
+		return false
+	}
+
+	current, err := hc.GetHeader(hc.LastHash)
+	for err == nil && current.Height > header.Height {
+		current, err = hc.GetHeader(current.PrevHash)
+	}
+
+	return err == nil && bytes.Equal(current.Hash, header.Hash)
+}
+
+// AddProvenTransaction stores a transaction once its Merkle proof checks out
+// against the root of a header we hold.
+func (hc *HeaderChain) AddProvenTransaction(tx *Transaction, proof *TxProof) error {
+	if !bytes.Equal(tx.ID, tx.Hash()) || !bytes.Equal(tx.ID, proof.TxID) {
+		return fmt.Errorf("proof does not belong to transaction %x", tx.ID)
+	}
+
+	header, err := hc.GetHeader(proof.BlockHash)
+	if err != nil {
+		return fmt.Errorf("transaction %x is in unknown block %x", tx.ID, proof.BlockHash)
+	}
+	if !bytes.Equal(header.MerkleRoot, proof.MerkleRoot) || !proof.Verify() {
+		return fmt.Errorf("invalid Merkle proof for transaction %x", tx.ID)
+	}
+	if proof.Height != header.Height {
+		return fmt.Errorf("proof of transaction %x claims height %d, block is at %d", tx.ID, proof.Height, header.Height)
+	}
+
+	var encoded bytes.Buffer
+	err = gob.NewEncoder(&encoded).Encode(ProvenTransaction{*tx, *proof})
+	Handle(err)
+
+	return hc.Database.Update(func(txn *badger.Txn) error {
+		return txn.Set(append(provenTxPrefix, tx.ID...), encoded.Bytes())
+	})
+}
+
+// ProvenTransactions returns every stored transaction whose block is in the
+// best chain.
+func (hc *HeaderChain) ProvenTransactions() []ProvenTransaction {
+	var proven []ProvenTransaction
+
+	err := hc.Database.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(provenTxPrefix); it.ValidForPrefix(provenTxPrefix); it.Next() {
+			v, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			var ptx ProvenTransaction
+			if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&ptx); err != nil {
+				return err
+			}
+			proven = append(proven, ptx)
+		}
+		return nil
+	})
+	Handle(err)
+
+	var best []ProvenTransaction
+	for _, ptx := range proven {
+		if hc.InBestChain(ptx.Proof.BlockHash) {
+			best = append(best, ptx)
+		}
+	}
+
+	return best
+}
+
+// UnspentOutputs lists the outputs locked to pubKeyHash that no proven
+// transaction spends, with their number of confirmations.
+func (hc *HeaderChain) UnspentOutputs(pubKeyHash []byte) []SPVOutput {
+	var unspent []SPVOutput
+
+	proven := hc.ProvenTransactions()
+	spent := make(map[string]bool)
+	for _, ptx := range proven {
+		if ptx.Tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range ptx.Tx.Inputs {
+			spent[fmt.Sprintf("%x:%d", in.ID, in.Out)] = true
+		}
+	}
+
+	bestHeight := hc.GetBestHeight()
+	for _, ptx := range proven {
+		// Confirmations count from the header we hold, not the height the
+		// serving node put in the proof.
+		header, err := hc.GetHeader(ptx.Proof.BlockHash)
+		if err != nil {
+			continue
+		}
+
+		for outIdx, out := range ptx.Tx.Outputs {
+			if !out.IsLockedWithKey(pubKeyHash) || spent[fmt.Sprintf("%x:%d", ptx.Tx.ID, outIdx)] {
+				continue
+			}
+
+			unspent = append(unspent, SPVOutput{
+				TxID:          ptx.Tx.ID,
+				Index:         outIdx,
+				Value:         out.Value,
+				Confirmations: bestHeight - header.Height + 1,
+			})
+		}
+	}
+
+	return unspent
+}
+
+func headerKey(hash []byte) []byte {
+	return append(append([]byte{}, headerPrefix...), hash...)
+}
+
+// HeadersExist reports whether a light client database exists for the node.
+func HeadersExist(nodeId string) bool {
+	_, err := os.Stat(fmt.Sprintf(headersPath, nodeId) + "/MANIFEST")
+
+	return err == nil
+}
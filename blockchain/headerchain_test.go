@@ -0,0 +1,96 @@
+package blockchain
+
+import (
+	"os"
+	"testing"
+)
+
+const testAddress = "1111111111111111111114oLvT2"
+
+// chdirTemp moves into a temporary working directory for the test, since
+// database paths are relative.
+func chdirTemp(t *testing.T) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func openTestHeaderChain(t *testing.T) *HeaderChain {
+	t.Helper()
+	chdirTemp(t)
+
+	hc := OpenHeaderChain("test")
+	t.Cleanup(func() { hc.Database.Close() })
+
+	return hc
+}
+
+func TestHeaderChainSync(t *testing.T) {
+	hc := openTestHeaderChain(t)
+
+	genesis := Genesis(CoinbaseTx(testAddress, "genesis"))
+	second := CreateBlock([]*Transaction{CoinbaseTx(testAddress, "second")}, genesis.Hash, 1)
+	third := CreateBlock([]*Transaction{CoinbaseTx(testAddress, "third")}, second.Hash, 2)
+
+	if err := hc.AddHeader(second.Header()); err == nil {
+		t.Errorf("expected a header with an unknown parent to be rejected")
+	}
+
+	if err := hc.AddHeader(genesis.Header()); err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := second.Header()
+	tampered.MerkleRoot = third.HashTransactions()
+	if err := hc.AddHeader(tampered); err == nil {
+		t.Errorf("expected a header with a changed Merkle root to be rejected")
+	}
+	tampered = second.Header()
+	tampered.Timestamp++
+	if tampered.Validate() {
+		t.Errorf("expected a header with a changed timestamp to fail proof of work")
+	}
+	tampered = second.Header()
+	tampered.Height++
+	if tampered.Validate() {
+		t.Errorf("expected a header with a changed height to fail proof of work")
+	}
+
+	for _, block := range []*Block{second, third} {
+		if err := hc.AddHeader(block.Header()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if height := hc.GetBestHeight(); height != 2 {
+		t.Errorf("expected best height 2, got %d", height)
+	}
+
+	proof, err := NewTxProof(second, second.Transactions[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hc.AddProvenTransaction(third.Transactions[0], proof); err == nil {
+		t.Errorf("expected a proof of another transaction to be rejected")
+	}
+	deeper := *proof
+	deeper.Height = 0
+	if err := hc.AddProvenTransaction(second.Transactions[0], &deeper); err == nil {
+		t.Errorf("expected a proof with the wrong height to be rejected")
+	}
+	if err := hc.AddProvenTransaction(second.Transactions[0], proof); err != nil {
+		t.Fatal(err)
+	}
+
+	pubKeyHash := second.Transactions[0].Outputs[0].PubKeyHash
+	outputs := hc.UnspentOutputs(pubKeyHash)
+	if len(outputs) != 1 || outputs[0].Confirmations != 2 {
+		t.Errorf("expected one output with 2 confirmations, got %+v", outputs)
+	}
+}
@@ -1,11 +1,14 @@
 package blockchain
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"errors"
 )
 
 type MerkleTree struct {
 	RootNode *MerkleNode
+	Leaves   int
 }
 
 type MerkleNode struct {
@@ -14,6 +17,17 @@ type MerkleNode struct {
 	Data  []byte
 }
 
+// MerkleProof shows that a leaf is part of a Merkle tree without the rest of
+// the tree. Siblings holds the hash next to the path from the leaf to the
+// root at every level, starting at the leaf, and the bits of Index say
+// whether the path goes through the left (0) or right (1) child. Leaves is
+// the number of leaves in the tree, without the copies padding odd levels.
+type MerkleProof struct {
+	Index    int
+	Leaves   int
+	Siblings [][]byte
+}
+
 func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
 	node := MerkleNode{}
 
@@ -21,7 +35,7 @@ func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
 		hash := sha256.Sum256(data)
 		node.Data = hash[:]
 	} else {
-		prevHashes := append(left.Data, right.Data...)
+		prevHashes := append(append([]byte{}, left.Data...), right.Data...)
 		hash := sha256.Sum256(prevHashes)
 		node.Data = hash[:]
 	}
@@ -31,29 +45,91 @@ func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
 	return &node
 }
 
+// NewMerkleTree builds the tree level by level. A level with an odd number of
+// nodes pairs its last node with itself, so any number of leaves works.
 func NewMerkleTree(data [][]byte) *MerkleTree {
-	var nodes []MerkleNode
+	var nodes []*MerkleNode
 
-	if len(data)%2 != 0 {
-		data = append(data, data[len(data)-1])
+	if len(data) == 0 {
+		return &MerkleTree{NewMerkleNode(nil, nil, nil), 0}
 	}
 
 	for _, dat := range data {
-		node := NewMerkleNode(nil, nil, dat)
-		nodes = append(nodes, *node)
+		nodes = append(nodes, NewMerkleNode(nil, nil, dat))
 	}
 
-	for i := 0; i < len(data)/2; i++ {
-		var level []MerkleNode
+	for len(nodes) > 1 {
+		var level []*MerkleNode
+
+		if len(nodes)%2 != 0 {
+			nodes = append(nodes, nodes[len(nodes)-1])
+		}
 
 		for j := 0; j < len(nodes); j += 2 {
-			node := NewMerkleNode(&nodes[j], &nodes[j+1], nil)
-			level = append(level, *node)
+			level = append(level, NewMerkleNode(nodes[j], nodes[j+1], nil))
 		}
 
 		nodes = level
 	}
 
-	tree := MerkleTree{&nodes[0]}
+	tree := MerkleTree{nodes[0], len(data)}
 	return &tree
 }
+
+// merkleDepth is the number of levels below the root of a tree of leaves.
+func merkleDepth(leaves int) int {
+	depth := 0
+	for 1<<depth < leaves {
+		depth++
+	}
+
+	return depth
+}
+
+// Proof returns the inclusion proof of the leaf at index.
+func (t *MerkleTree) Proof(index int) (MerkleProof, error) {
+	if index < 0 || index >= t.Leaves {
+		return MerkleProof{}, errors.New("leaf index out of range")
+	}
+
+	depth := merkleDepth(t.Leaves)
+	proof := MerkleProof{Index: index, Leaves: t.Leaves, Siblings: make([][]byte, depth)}
+	node := t.RootNode
+	for level := depth - 1; level >= 0; level-- {
+		if index>>level&1 == 0 {
+			proof.Siblings[level] = node.Right.Data
+			node = node.Left
+		} else {
+			proof.Siblings[level] = node.Left.Data
+			node = node.Right
+		}
+	}
+
+	return proof, nil
+}
+
+// VerifyMerkleProof checks that data is the leaf at proof.Index of the tree
+// with the given root.
+func VerifyMerkleProof(root, data []byte, proof MerkleProof) bool {
+	if proof.Index < 0 || proof.Index >= proof.Leaves || len(proof.Siblings) != merkleDepth(proof.Leaves) {
+		return false
+	}
+
+	hash := NewMerkleNode(nil, nil, data)
+	for level, sibling := range proof.Siblings {
+		node := &MerkleNode{Data: sibling}
+		if proof.Index>>level&1 == 0 {
+			hash = NewMerkleNode(hash, node, nil)
+		} else {
+			// The root does not commit to the leaf count, so a path
+			// through the copy padding an odd level, a right child equal
+			// to its sibling, is rejected whatever Leaves claims.
+			if bytes.Equal(hash.Data, sibling) {
+				return false
+			}
+			hash = NewMerkleNode(node, hash, nil)
+		}
+	}
+
+	return bytes.Equal(hash.Data, root)
+}
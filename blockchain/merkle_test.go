@@ -0,0 +1,134 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+)
+
+func merkleLeaves(n int) [][]byte {
+	var leaves [][]byte
+	for i := 0; i < n; i++ {
+		leaves = append(leaves, []byte(fmt.Sprintf("tx%d", i)))
+	}
+
+	return leaves
+}
+
+func hashPair(left, right []byte) []byte {
+	hash := sha256.Sum256(append(append([]byte{}, left...), right...))
+
+	return hash[:]
+}
+
+func hashLeaf(data []byte) []byte {
+	hash := sha256.Sum256(data)
+
+	return hash[:]
+}
+
+func TestMerkleTreeOddLevels(t *testing.T) {
+	leaves := merkleLeaves(5)
+	h := make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		h[i] = hashLeaf(leaf)
+	}
+
+	// Levels: [h0 h1 h2 h3 h4] -> [h01 h23 h44] -> [h0123 h4444] -> root
+	h01, h23, h44 := hashPair(h[0], h[1]), hashPair(h[2], h[3]), hashPair(h[4], h[4])
+	expected := hashPair(hashPair(h01, h23), hashPair(h44, h44))
+
+	if root := NewMerkleTree(leaves).RootNode.Data; !bytes.Equal(root, expected) {
+		t.Errorf("expected root %x, got %x", expected, root)
+	}
+
+	if root := NewMerkleTree(leaves[:1]).RootNode.Data; !bytes.Equal(root, h[0]) {
+		t.Errorf("expected the root of a single leaf to be its hash, got %x", root)
+	}
+}
+
+func TestMerkleProofs(t *testing.T) {
+	for n := 1; n <= 17; n++ {
+		leaves := merkleLeaves(n)
+		tree := NewMerkleTree(leaves)
+		root := tree.RootNode.Data
+
+		for index, leaf := range leaves {
+			proof, err := tree.Proof(index)
+			if err != nil {
+				t.Fatalf("%d leaves, index %d: %v", n, index, err)
+			}
+			if !VerifyMerkleProof(root, leaf, proof) {
+				t.Errorf("%d leaves, index %d: valid proof rejected", n, index)
+			}
+			if VerifyMerkleProof(root, []byte("other"), proof) {
+				t.Errorf("%d leaves, index %d: proof accepted for another leaf", n, index)
+			}
+			if n > 1 {
+				moved := MerkleProof{(index + 1) % n, n, proof.Siblings}
+				if !bytes.Equal(leaves[moved.Index], leaf) && VerifyMerkleProof(root, leaf, moved) {
+					t.Errorf("%d leaves, index %d: proof accepted at index %d", n, index, moved.Index)
+				}
+			}
+		}
+	}
+}
+
+func TestMerkleProofRejectsBadInput(t *testing.T) {
+	tree := NewMerkleTree(merkleLeaves(4))
+	root := tree.RootNode.Data
+	proof, _ := tree.Proof(2)
+
+	if VerifyMerkleProof(root, []byte("tx2"), MerkleProof{6, 8, proof.Siblings}) {
+		t.Errorf("expected an index beyond the path length to be rejected")
+	}
+	if VerifyMerkleProof(root, []byte("tx2"), MerkleProof{2, 4, proof.Siblings[:1]}) {
+		t.Errorf("expected a truncated path to be rejected")
+	}
+	if _, err := tree.Proof(4); err == nil {
+		t.Errorf("expected proof of a missing leaf to fail")
+	}
+}
+
+func TestMerkleProofRejectsPadding(t *testing.T) {
+	// The third leaf is paired with a copy of itself at index 3.
+	tree := NewMerkleTree(merkleLeaves(3))
+	root := tree.RootNode.Data
+	proof, _ := tree.Proof(2)
+
+	if _, err := tree.Proof(3); err == nil {
+		t.Errorf("expected no proof at a padding index")
+	}
+	for _, leaves := range []int{3, 4} {
+		padding := MerkleProof{3, leaves, proof.Siblings}
+		if VerifyMerkleProof(root, []byte("tx2"), padding) {
+			t.Errorf("expected a proof at a padding index claiming %d leaves to be rejected", leaves)
+		}
+	}
+}
+
+func TestBlockTxProof(t *testing.T) {
+	var txs []*Transaction
+	for i := 0; i < 3; i++ {
+		txs = append(txs, CoinbaseTx("1111111111111111111114oLvT2", fmt.Sprintf("tx%d", i)))
+	}
+	block := &Block{Transactions: txs, Hash: []byte("block")}
+
+	proof, err := NewTxProof(block, txs[2].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proof.Verify() || !bytes.Equal(proof.MerkleRoot, block.HashTransactions()) {
+		t.Errorf("expected proof of the last transaction to verify against the block")
+	}
+
+	decoded, err := DeserializeTxProof(proof.Serialize())
+	if err != nil || !decoded.Verify() {
+		t.Errorf("expected decoded proof to verify, got %v", err)
+	}
+
+	if _, err := NewTxProof(block, []byte("missing")); err == nil {
+		t.Errorf("expected proof of a missing transaction to fail")
+	}
+}
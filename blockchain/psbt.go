@@ -0,0 +1,161 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+
+	"github.com/mapfumo/golang-blockchain/wallet"
+)
+
+// PartialTransaction is a transaction that is still collecting signatures.
+// Alongside the transaction it carries the output spent by every input, so it
+// can be signed on a machine that holds only the wallet file and no chain.
+// Signatures collected so far live in the inputs of Tx.
+type PartialTransaction struct {
+	Tx          Transaction
+	PrevOutputs []TxOutput
+}
+
+// NewPartialTransaction builds an unsigned transaction paying every payout
+// and the fee from the outputs locked to from. Only the address is needed,
+// so it can be created on a node that holds no private keys.
+func NewPartialTransaction(from string, payouts []Payout, fee int, UTXO *UTXOSet) (*PartialTransaction, error) {
+	decoded, err := wallet.DecodeAddress(from)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := newUnsignedTransaction(decoded.PubKeyHash, nil, from, payouts, fee, UTXO)
+	if err != nil {
+		return nil, err
+	}
+
+	var prevOutputs []TxOutput
+	for _, in := range tx.Inputs {
+		prevTX, err := UTXO.FindTransaction(in.ID)
+		if err != nil {
+			return nil, err
+		}
+		prevOutputs = append(prevOutputs, prevTX.Outputs[in.Out])
+	}
+
+	return &PartialTransaction{tx, prevOutputs}, nil
+}
+
+// Sign signs every input spending an output locked to the wallet's key with
+// the given sighash type and returns how many inputs it signed.
+func (ptx *PartialTransaction) Sign(w *wallet.Wallet, hashType SigHashType) (int, error) {
+	pubKeyHash := wallet.PublicKeyHash(w.PublicKey)
+	privKey, err := w.SigningKey()
+	if err != nil {
+		return 0, err
+	}
+	signed := 0
+
+	for inId, prevOut := range ptx.PrevOutputs {
+		if !prevOut.IsLockedWithKey(pubKeyHash) {
+			continue
+		}
+
+		ptx.Tx.Inputs[inId].PubKey = w.PublicKey
+		if err := ptx.Tx.SignInput(inId, privKey, prevOut, hashType); err != nil {
+			return signed, err
+		}
+		signed++
+	}
+
+	return signed, nil
+}
+
+// Combine merges the signatures collected in other into ptx. Both must
+// describe the same unsigned transaction.
+func (ptx *PartialTransaction) Combine(other *PartialTransaction) error {
+	if !bytes.Equal(ptx.unsignedHash(), other.unsignedHash()) {
+		return errors.New("partial transactions spend or pay different outputs")
+	}
+
+	for inId, in := range other.Tx.Inputs {
+		if len(in.Signature) == 0 || len(ptx.Tx.Inputs[inId].Signature) > 0 {
+			continue
+		}
+		ptx.Tx.Inputs[inId].Signature = in.Signature
+		ptx.Tx.Inputs[inId].PubKey = in.PubKey
+	}
+
+	return nil
+}
+
+// IsComplete reports whether every input carries a signature.
+func (ptx *PartialTransaction) IsComplete() bool {
+	for _, in := range ptx.Tx.Inputs {
+		if len(in.Signature) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Finalize verifies every collected signature and returns the transaction
+// ready to be broadcast.
+func (ptx *PartialTransaction) Finalize() (*Transaction, error) {
+	if !ptx.IsComplete() {
+		return nil, errors.New("partial transaction is missing signatures")
+	}
+
+	tx := ptx.Tx
+	for inId, prevOut := range ptx.PrevOutputs {
+		if !tx.VerifyInput(inId, prevOut) {
+			return nil, fmt.Errorf("input %d has an invalid signature", inId)
+		}
+	}
+
+	tx.ID = tx.Hash()
+
+	return &tx, nil
+}
+
+// unsignedHash identifies the transaction regardless of collected signatures.
+func (ptx *PartialTransaction) unsignedHash() []byte {
+	txCopy := ptx.Tx.TrimmedCopy()
+
+	return txCopy.Hash()
+}
+
+func (ptx *PartialTransaction) Serialize() []byte {
+	var encoded bytes.Buffer
+
+	enc := gob.NewEncoder(&encoded)
+	err := enc.Encode(ptx)
+	Handle(err)
+
+	return encoded.Bytes()
+}
+
+// Encode encodes the partial transaction as base64 text for passing around
+// in files.
+func (ptx *PartialTransaction) Encode() string {
+	return base64.StdEncoding.EncodeToString(ptx.Serialize())
+}
+
+// DecodePartialTransaction parses the text produced by Encode.
+func DecodePartialTransaction(text string) (*PartialTransaction, error) {
+	data, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var ptx PartialTransaction
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&ptx); err != nil {
+		return nil, err
+	}
+	if len(ptx.PrevOutputs) != len(ptx.Tx.Inputs) {
+		return nil, errors.New("partial transaction has no previous output for every input")
+	}
+
+	return &ptx, nil
+}
@@ -0,0 +1,82 @@
+package blockchain
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/mapfumo/golang-blockchain/wallet"
+)
+
+func TestPartialTransactionSigning(t *testing.T) {
+	chdirTemp(t)
+	if err := os.Mkdir("tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	alice, bob, carol := wallet.MakeWallet(), wallet.MakeWallet(), wallet.MakeWallet()
+	aliceAddr, bobAddr, carolAddr := string(alice.Address()), string(bob.Address()), string(carol.Address())
+
+	chain := InitBlockChain(aliceAddr, "test")
+	defer chain.Database.Close()
+	UTXO := &UTXOSet{Blockchain: chain}
+	UTXO.Reindex()
+	UTXO.Update(chain.MineBlock([]*Transaction{CoinbaseTx(bobAddr, "")}))
+
+	// Alice and Bob pay Carol together, each from their own outputs.
+	ptx, err := NewPartialTransaction(aliceAddr, []Payout{{carolAddr, 5}}, 0, UTXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobPart, err := NewPartialTransaction(bobAddr, []Payout{{carolAddr, 7}}, 0, UTXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ptx.Tx.Inputs = append(ptx.Tx.Inputs, bobPart.Tx.Inputs...)
+	ptx.Tx.Outputs = append(ptx.Tx.Outputs, bobPart.Tx.Outputs...)
+	ptx.PrevOutputs = append(ptx.PrevOutputs, bobPart.PrevOutputs...)
+
+	encoded := ptx.Encode()
+	decoded, err := DecodePartialTransaction(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Encode() != encoded || !bytes.Equal(decoded.Tx.Hash(), ptx.Tx.Hash()) {
+		t.Fatalf("expected the partial transaction to survive encoding")
+	}
+
+	// Each signer works on a copy of their own.
+	aliceCopy, _ := DecodePartialTransaction(encoded)
+	bobCopy, _ := DecodePartialTransaction(encoded)
+	if n, err := aliceCopy.Sign(alice, SigHashAll); err != nil || n != 1 {
+		t.Fatalf("expected alice to sign 1 input, signed %d: %v", n, err)
+	}
+	if n, err := bobCopy.Sign(bob, SigHashAll); err != nil || n != 1 {
+		t.Fatalf("expected bob to sign 1 input, signed %d: %v", n, err)
+	}
+	if _, err := aliceCopy.Finalize(); err == nil {
+		t.Errorf("expected a partial transaction missing signatures not to finalize")
+	}
+
+	other, err := NewPartialTransaction(aliceAddr, []Payout{{carolAddr, 6}}, 0, UTXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := aliceCopy.Combine(other); err == nil {
+		t.Errorf("expected combining with another transaction to fail")
+	}
+
+	if err := aliceCopy.Combine(bobCopy); err != nil {
+		t.Fatal(err)
+	}
+	if !aliceCopy.IsComplete() {
+		t.Fatalf("expected the combined transaction to carry both signatures")
+	}
+	tx, err := aliceCopy.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !chain.VerifyTransaction(tx) {
+		t.Errorf("expected the finalized transaction to verify")
+	}
+}
@@ -0,0 +1,101 @@
+package blockchain
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+)
+
+// DefaultSigCacheSize is the number of verified signatures remembered.
+const DefaultSigCacheSize = 100000
+
+// sigCache is shared by all verification so a transaction checked on its
+// way into the memory pool is not checked again when it is mined or arrives
+// in a block. It may be set to nil to disable caching.
+var sigCache = NewSigCache(DefaultSigCacheSize)
+
+// SigCache is a thread-safe LRU set of signatures known to be valid, keyed by
+// (signature hash, public key, signature).
+type SigCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[[32]byte]*list.Element
+	order    *list.List
+}
+
+func NewSigCache(capacity int) *SigCache {
+	return &SigCache{
+		capacity: capacity,
+		entries:  make(map[[32]byte]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Contains reports whether the signature was added before, marking it as
+// recently used.
+func (c *SigCache) Contains(hash, pubKey, sig []byte) bool {
+	if c == nil {
+		return false
+	}
+	key := sigCacheKey(hash, pubKey, sig)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if ok {
+		c.order.MoveToFront(elem)
+	}
+
+	return ok
+}
+
+// Add remembers a valid signature, evicting the least recently used entry
+// when the cache is full.
+func (c *SigCache) Add(hash, pubKey, sig []byte) {
+	if c == nil || c.capacity <= 0 {
+		return
+	}
+	key := sigCacheKey(hash, pubKey, sig)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	if c.order.Len() >= c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.([32]byte))
+	}
+
+	c.entries[key] = c.order.PushFront(key)
+}
+
+func (c *SigCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// sigCacheKey hashes the three parts with length prefixes so that different
+// splits of the same bytes cannot collide.
+func sigCacheKey(hash, pubKey, sig []byte) [32]byte {
+	h := sha256.New()
+	for _, part := range [][]byte{hash, pubKey, sig} {
+		var length [4]byte
+		binary.BigEndian.PutUint32(length[:], uint32(len(part)))
+		h.Write(length[:])
+		h.Write(part)
+	}
+
+	var key [32]byte
+	copy(key[:], h.Sum(nil))
+
+	return key
+}
@@ -0,0 +1,123 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// SigHashType selects which parts of a transaction a signature commits to.
+// It is appended as the last byte of every input signature.
+type SigHashType byte
+
+const (
+	// SigHashAll commits to every input and every output.
+	SigHashAll SigHashType = 0x01
+	// SigHashNone commits to every input but no output, so anyone may
+	// decide where the coins go.
+	SigHashNone SigHashType = 0x02
+	// SigHashSingle commits to every input and only the output with the
+	// same index as the signed input.
+	SigHashSingle SigHashType = 0x03
+	// SigHashAnyoneCanPay may be combined with any of the above so the
+	// signature commits to the signed input only, letting others add inputs.
+	SigHashAnyoneCanPay SigHashType = 0x80
+
+	sigHashBaseMask = 0x1f
+)
+
+var sigHashNames = map[SigHashType]string{
+	SigHashAll:    "ALL",
+	SigHashNone:   "NONE",
+	SigHashSingle: "SINGLE",
+}
+
+// ParseSigHashType parses names like "ALL", "NONE" or "SINGLE|ANYONECANPAY".
+func ParseSigHashType(name string) (SigHashType, error) {
+	var hashType SigHashType
+
+	for _, part := range strings.Split(strings.ToUpper(name), "|") {
+		part = strings.TrimSpace(part)
+		if part == "ANYONECANPAY" {
+			hashType |= SigHashAnyoneCanPay
+			continue
+		}
+
+		found := false
+		for base, baseName := range sigHashNames {
+			if part == baseName && hashType&sigHashBaseMask == 0 {
+				hashType |= base
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("invalid sighash type %q", name)
+		}
+	}
+
+	if !hashType.IsValid() {
+		return 0, fmt.Errorf("invalid sighash type %q", name)
+	}
+
+	return hashType, nil
+}
+
+// IsValid reports whether the type has a known base mode and no unknown flags.
+func (t SigHashType) IsValid() bool {
+	_, ok := sigHashNames[t.base()]
+
+	return ok && t&^(sigHashBaseMask|SigHashAnyoneCanPay) == 0
+}
+
+func (t SigHashType) AnyoneCanPay() bool {
+	return t&SigHashAnyoneCanPay != 0
+}
+
+func (t SigHashType) base() SigHashType {
+	return t & sigHashBaseMask
+}
+
+func (t SigHashType) String() string {
+	name, ok := sigHashNames[t.base()]
+	if !ok {
+		name = fmt.Sprintf("0x%02x", byte(t.base()))
+	}
+	if t.AnyoneCanPay() {
+		name += "|ANYONECANPAY"
+	}
+
+	return name
+}
+
+// signingHash is the digest signed for the input at inId. The spent output's
+// public key hash stands in for the signed input's public key, and hashType
+// decides which other inputs and outputs are committed to.
+func (tx *Transaction) signingHash(inId int, prevOut TxOutput, hashType SigHashType) ([]byte, error) {
+	if !hashType.IsValid() {
+		return nil, fmt.Errorf("invalid sighash type 0x%02x", byte(hashType))
+	}
+
+	txCopy := tx.TrimmedCopy()
+	txCopy.Inputs[inId].PubKey = prevOut.PubKeyHash
+
+	switch hashType.base() {
+	case SigHashNone:
+		txCopy.Outputs = nil
+	case SigHashSingle:
+		if inId >= len(txCopy.Outputs) {
+			return nil, fmt.Errorf("input %d has no matching output for SIGHASH_SINGLE", inId)
+		}
+		txCopy.Outputs = txCopy.Outputs[:inId+1]
+		for outId := 0; outId < inId; outId++ {
+			txCopy.Outputs[outId] = TxOutput{-1, nil}
+		}
+	}
+
+	if hashType.AnyoneCanPay() {
+		txCopy.Inputs = []TxInput{txCopy.Inputs[inId]}
+	}
+
+	hash := sha256.Sum256(append(txCopy.Hash(), byte(hashType)))
+
+	return hash[:], nil
+}
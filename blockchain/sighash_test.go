@@ -0,0 +1,156 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/mapfumo/golang-blockchain/wallet"
+)
+
+type sighashFixture struct {
+	tx       *Transaction
+	keys     []wallet.SigningKey
+	prevOuts []TxOutput
+}
+
+// newSighashFixture builds a transaction with two outputs and two inputs,
+// the first owned by a P-256 key and the second by an Ed25519 key.
+func newSighashFixture() *sighashFixture {
+	f := &sighashFixture{tx: &Transaction{}}
+
+	for i, keyType := range []wallet.KeyType{wallet.KeyTypeP256, wallet.KeyTypeEd25519} {
+		w, err := wallet.MakeWalletOfType(keyType)
+		if err != nil {
+			panic(err)
+		}
+		private, err := w.SigningKey()
+		if err != nil {
+			panic(err)
+		}
+		f.keys = append(f.keys, private)
+		f.prevOuts = append(f.prevOuts, TxOutput{10, wallet.PublicKeyHash(w.PublicKey)})
+		f.tx.Inputs = append(f.tx.Inputs, TxInput{[]byte{byte(i + 1)}, i, nil, w.PublicKey, 0})
+		f.tx.Outputs = append(f.tx.Outputs, TxOutput{5 + i, []byte{byte(i + 1)}})
+	}
+	f.tx.ID = f.tx.Hash()
+
+	return f
+}
+
+func (f *sighashFixture) sign(t *testing.T, inId int, hashType SigHashType) {
+	t.Helper()
+
+	if err := f.tx.SignInput(inId, f.keys[inId], f.prevOuts[inId], hashType); err != nil {
+		t.Fatalf("signing input %d with %s: %v", inId, hashType, err)
+	}
+	if !f.tx.VerifyInput(inId, f.prevOuts[inId]) {
+		t.Fatalf("fresh %s signature on input %d does not verify", hashType, inId)
+	}
+}
+
+func (f *sighashFixture) addInput() {
+	_, public := wallet.NewKeyPair()
+	f.tx.Inputs = append(f.tx.Inputs, TxInput{[]byte{9}, 0, nil, public, 0})
+}
+
+func TestSigHashMalleability(t *testing.T) {
+	tests := []struct {
+		name     string
+		hashType SigHashType
+		mutate   func(f *sighashFixture)
+		valid    bool
+	}{
+		{"ALL change output", SigHashAll, func(f *sighashFixture) { f.tx.Outputs[1].Value++ }, false},
+		{"ALL add output", SigHashAll, func(f *sighashFixture) { f.tx.Outputs = append(f.tx.Outputs, TxOutput{1, nil}) }, false},
+		{"ALL add input", SigHashAll, (*sighashFixture).addInput, false},
+		{"ALL change other input", SigHashAll, func(f *sighashFixture) { f.tx.Inputs[1].Out = 7 }, false},
+
+		{"NONE change output", SigHashNone, func(f *sighashFixture) { f.tx.Outputs[0].PubKeyHash = []byte("thief") }, true},
+		{"NONE drop outputs", SigHashNone, func(f *sighashFixture) { f.tx.Outputs = nil }, true},
+		{"NONE add input", SigHashNone, (*sighashFixture).addInput, false},
+		{"NONE change other input", SigHashNone, func(f *sighashFixture) { f.tx.Inputs[1].Out = 7 }, false},
+
+		{"SINGLE change own output", SigHashSingle, func(f *sighashFixture) { f.tx.Outputs[0].Value++ }, false},
+		{"SINGLE change other output", SigHashSingle, func(f *sighashFixture) { f.tx.Outputs[1].Value++ }, true},
+		{"SINGLE add output", SigHashSingle, func(f *sighashFixture) { f.tx.Outputs = append(f.tx.Outputs, TxOutput{1, nil}) }, true},
+		{"SINGLE add input", SigHashSingle, (*sighashFixture).addInput, false},
+
+		{"ALL|ANYONECANPAY add input", SigHashAll | SigHashAnyoneCanPay, (*sighashFixture).addInput, true},
+		{"ALL|ANYONECANPAY drop other input", SigHashAll | SigHashAnyoneCanPay, func(f *sighashFixture) { f.tx.Inputs = f.tx.Inputs[:1] }, true},
+		{"ALL|ANYONECANPAY change output", SigHashAll | SigHashAnyoneCanPay, func(f *sighashFixture) { f.tx.Outputs[1].Value++ }, false},
+		{"NONE|ANYONECANPAY change everything else", SigHashNone | SigHashAnyoneCanPay, func(f *sighashFixture) {
+			f.addInput()
+			f.tx.Outputs = []TxOutput{{20, []byte("thief")}}
+		}, true},
+		{"SINGLE|ANYONECANPAY add input and output", SigHashSingle | SigHashAnyoneCanPay, func(f *sighashFixture) {
+			f.addInput()
+			f.tx.Outputs = append(f.tx.Outputs, TxOutput{1, nil})
+		}, true},
+		{"SINGLE|ANYONECANPAY change own output", SigHashSingle | SigHashAnyoneCanPay, func(f *sighashFixture) { f.tx.Outputs[0].Value++ }, false},
+
+		{"any change own input", SigHashNone | SigHashAnyoneCanPay, func(f *sighashFixture) { f.tx.Inputs[0].Out = 7 }, false},
+		{"any swap hash type", SigHashAll, func(f *sighashFixture) {
+			sig := f.tx.Inputs[0].Signature
+			sig[len(sig)-1] = byte(SigHashNone)
+		}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newSighashFixture()
+			f.sign(t, 0, test.hashType)
+
+			test.mutate(f)
+
+			if got := f.tx.VerifyInput(0, f.prevOuts[0]); got != test.valid {
+				t.Errorf("expected signature valid=%t after mutation, got %t", test.valid, got)
+			}
+		})
+	}
+}
+
+func TestSigHashSingleWithoutMatchingOutput(t *testing.T) {
+	f := newSighashFixture()
+	f.tx.Outputs = f.tx.Outputs[:1]
+
+	if err := f.tx.SignInput(1, f.keys[1], f.prevOuts[1], SigHashSingle); err == nil {
+		t.Errorf("expected SIGHASH_SINGLE without a matching output to fail")
+	}
+}
+
+func TestSigHashUnknownTypeRejected(t *testing.T) {
+	f := newSighashFixture()
+
+	for _, hashType := range []SigHashType{0x00, 0x04, SigHashAnyoneCanPay, SigHashAll | 0x40} {
+		if err := f.tx.SignInput(0, f.keys[0], f.prevOuts[0], hashType); err == nil {
+			t.Errorf("expected sighash type 0x%02x to be rejected", byte(hashType))
+		}
+	}
+
+	f.sign(t, 0, SigHashAll)
+	sig := f.tx.Inputs[0].Signature
+	sig[len(sig)-1] = 0x04
+	if f.tx.VerifyInput(0, f.prevOuts[0]) {
+		t.Errorf("expected signature with unknown sighash type to fail verification")
+	}
+}
+
+func TestParseSigHashType(t *testing.T) {
+	tests := map[string]SigHashType{
+		"ALL":                 SigHashAll,
+		"none":                SigHashNone,
+		"SINGLE|ANYONECANPAY": SigHashSingle | SigHashAnyoneCanPay,
+		"ANYONECANPAY|ALL":    SigHashAll | SigHashAnyoneCanPay,
+	}
+	for name, expected := range tests {
+		got, err := ParseSigHashType(name)
+		if err != nil || got != expected {
+			t.Errorf("ParseSigHashType(%q) = %s, %v; expected %s", name, got, err, expected)
+		}
+	}
+
+	for _, name := range []string{"", "ANYONECANPAY", "ALL|NONE", "EVERYTHING"} {
+		if _, err := ParseSigHashType(name); err == nil {
+			t.Errorf("expected ParseSigHashType(%q) to fail", name)
+		}
+	}
+}
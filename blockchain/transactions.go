@@ -2,17 +2,15 @@ package blockchain
 
 import (
 	"bytes"
-	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
-	"crypto/x509"
+	"encoding/binary"
 	"encoding/gob"
 	"encoding/hex"
-	"encoding/pem"
+	"errors"
 	"fmt"
 	"log"
-	"math/big"
+	"math"
 	"strings"
 
 	"github.com/mapfumo/golang-blockchain/wallet"
@@ -24,17 +22,70 @@ type Transaction struct {
 	Outputs []TxOutput
 }
 
+// Hash computes the transaction ID over everything but the input
+// signatures, so re-encoding a signature cannot change the ID of a
+// transaction in flight. Signatures are committed to by WitnessHash.
 func (tx *Transaction) Hash() []byte {
-	var hash [32]byte
+	hash := sha256.Sum256(tx.hashData(false))
 
-	txCopy := *tx
-	txCopy.ID = []byte{}
+	return hash[:]
+}
 
-	hash = sha256.Sum256(txCopy.Serialize())
+// WitnessHash hashes the whole transaction including the input signatures.
+func (tx *Transaction) WitnessHash() []byte {
+	hash := sha256.Sum256(tx.hashData(true))
 
 	return hash[:]
 }
 
+// hashData is the encoding hashed for the IDs. It is independent of gob,
+// whose output depends on the order types were first encoded in a process
+// and so is not the same on every node.
+func (tx *Transaction) hashData(withSignatures bool) []byte {
+	var data bytes.Buffer
+
+	writeInt := func(n int) {
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], uint64(n))
+		data.Write(buf[:])
+	}
+	writeBytes := func(b []byte) {
+		writeInt(len(b))
+		data.Write(b)
+	}
+
+	writeInt(len(tx.Inputs))
+	for _, in := range tx.Inputs {
+		writeBytes(in.ID)
+		writeInt(in.Out)
+		if withSignatures {
+			writeBytes(in.Signature)
+		}
+		writeBytes(in.PubKey)
+		writeInt(int(in.Sequence))
+	}
+
+	writeInt(len(tx.Outputs))
+	for _, out := range tx.Outputs {
+		writeInt(out.Value)
+		writeBytes(out.PubKeyHash)
+	}
+
+	return data.Bytes()
+}
+
+// IsReplaceable reports whether the transaction opted in to be replaced by
+// one paying a higher fee while it is unconfirmed.
+func (tx *Transaction) IsReplaceable() bool {
+	for _, in := range tx.Inputs {
+		if in.Sequence == SequenceReplaceable {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (tx Transaction) Serialize() []byte {
 	var encoded bytes.Buffer
 
@@ -56,8 +107,30 @@ func DeserializeTransaction(data []byte) Transaction {
 	return transaction
 }
 
+// ParseTransaction is DeserializeTransaction for data that may be
+// malformed, such as a file left by an earlier run.
+func ParseTransaction(data []byte) (Transaction, error) {
+	var transaction Transaction
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&transaction); err != nil {
+		return Transaction{}, err
+	}
+
+	return transaction, nil
+}
+
+
+// Subsidy is the reward for mining a block, on top of its fees.
+const Subsidy = 20
 
 func CoinbaseTx(to, data string) *Transaction {
+	return CoinbaseTxWithFees(to, data, 0)
+}
+
+// CoinbaseTxWithFees pays the block reward plus the fees of the block's
+// other transactions to the miner.
+func CoinbaseTxWithFees(to, data string, fees int) *Transaction {
 	if data == "" {
 		randData := make([]byte, 24)
 		_, err := rand.Read(randData)
@@ -65,8 +138,8 @@ func CoinbaseTx(to, data string) *Transaction {
 		data = fmt.Sprintf("%x", randData)
 	}
 
-	txin := TxInput{[]byte{}, -1, nil, []byte(data)}
-	txout := NewTXOutput(20, to)
+	txin := TxInput{[]byte{}, -1, nil, []byte(data), 0}
+	txout := NewTXOutput(Subsidy+fees, to)
 
 	tx := Transaction{nil, []TxInput{txin}, []TxOutput{*txout}}
 	tx.ID = tx.Hash()
@@ -74,16 +147,161 @@ func CoinbaseTx(to, data string) *Transaction {
 	return &tx
 }
 
-func NewTransaction(w *wallet.Wallet, to string, amount int, UTXO *UTXOSet) *Transaction {
+// Payout is a single destination of a multi-recipient transaction.
+type Payout struct {
+	Address string `json:"address"`
+	Amount  int    `json:"amount"`
+}
+
+// ValidatePayouts checks every destination address and amount and returns
+// the total amount to be paid out. Paying the same key twice is an error,
+// as it is most likely a duplicated line.
+func ValidatePayouts(payouts []Payout) (int, error) {
+	if len(payouts) == 0 {
+		return 0, errors.New("no payouts given")
+	}
+
+	total := 0
+	seen := make(map[string]int)
+	for i, p := range payouts {
+		decoded, err := wallet.DecodeAddress(p.Address)
+		if err != nil {
+			return 0, fmt.Errorf("payout %d: invalid address %q: %w", i, p.Address, err)
+		}
+		key := hex.EncodeToString(decoded.PubKeyHash)
+		if first, ok := seen[key]; ok {
+			return 0, fmt.Errorf("payout %d: address %q is already paid by payout %d", i, p.Address, first)
+		}
+		seen[key] = i
+		if p.Amount <= 0 {
+			return 0, fmt.Errorf("payout %d: amount must be positive, got %d", i, p.Amount)
+		}
+		if total > math.MaxInt-p.Amount {
+			return 0, fmt.Errorf("payout %d: total amount overflows", i)
+		}
+		total += p.Amount
+	}
+
+	return total, nil
+}
+
+func NewTransaction(w *wallet.Wallet, to string, amount, fee int, change string, replaceable bool, UTXO *UTXOSet) (*Transaction, error) {
+	return NewMultiTransaction(w, []Payout{{Address: to, Amount: amount}}, fee, change, replaceable, UTXO)
+}
+
+// NewMultiTransaction pays every payout from the wallet in a single
+// transaction with one shared change output, leaving fee to the miner.
+// Change goes to the change address, or back to the wallet's own address
+// if it is empty. A replaceable transaction can have its fee bumped until
+// it is mined.
+func NewMultiTransaction(w *wallet.Wallet, payouts []Payout, fee int, change string, replaceable bool, UTXO *UTXOSet) (*Transaction, error) {
+	if change == "" {
+		change = string(w.Address())
+	}
+	pubKeyHash := wallet.PublicKeyHash(w.PublicKey)
+
+	tx, err := newUnsignedTransaction(pubKeyHash, w.PublicKey, change, payouts, fee, UTXO)
+	if err != nil {
+		return nil, err
+	}
+	if replaceable {
+		for i := range tx.Inputs {
+			tx.Inputs[i].Sequence = SequenceReplaceable
+		}
+		tx.ID = tx.Hash()
+	}
+
+	privateKey, err := w.SigningKey()
+	if err != nil {
+		return nil, err
+	}
+	UTXO.SignTransaction(&tx, privateKey)
+
+	return &tx, nil
+}
+
+// NewReplacementTransaction rebuilds an unconfirmed replaceable transaction
+// of the wallet to pay fee instead, spending the same inputs and taking the
+// difference from the change output, its last output if isChange reports
+// it locked to one of our keys. The unconfirmed set of UTXO must hold the
+// parents of orig that are not in the chain.
+func NewReplacementTransaction(w *wallet.Wallet, orig *Transaction, fee int, isChange func(pubKeyHash []byte) bool, UTXO *UTXOSet) (*Transaction, error) {
+	if !orig.IsReplaceable() {
+		return nil, errors.New("transaction did not opt in to replace-by-fee")
+	}
+	pubKeyHash := wallet.PublicKeyHash(w.PublicKey)
+
+	inputs := 0
+	for _, in := range orig.Inputs {
+		if !in.UsesKey(pubKeyHash) {
+			return nil, errors.New("transaction spends outputs of another wallet")
+		}
+		prevTX, err := UTXO.FindTransaction(in.ID)
+		if err != nil {
+			return nil, err
+		}
+		if in.Out < 0 || in.Out >= len(prevTX.Outputs) {
+			return nil, fmt.Errorf("transaction spends output %d of %x, which has %d outputs", in.Out, in.ID, len(prevTX.Outputs))
+		}
+		inputs += prevTX.Outputs[in.Out].Value
+	}
+	outputs := 0
+	for _, out := range orig.Outputs {
+		outputs += out.Value
+	}
+
+	bump := fee - (inputs - outputs)
+	if bump <= 0 {
+		return nil, fmt.Errorf("fee %d is not higher than the current fee %d", fee, inputs-outputs)
+	}
+
+	tx := Transaction{nil, nil, nil}
+	for _, in := range orig.Inputs {
+		tx.Inputs = append(tx.Inputs, TxInput{in.ID, in.Out, nil, in.PubKey, SequenceReplaceable})
+	}
+	tx.Outputs = append(tx.Outputs, orig.Outputs...)
+
+	change := len(tx.Outputs) - 1
+	if change < 0 || !isChange(tx.Outputs[change].PubKeyHash) || tx.Outputs[change].Value < bump {
+		return nil, errors.New("not enough change to raise the fee")
+	}
+	if tx.Outputs[change].Value == bump {
+		tx.Outputs = tx.Outputs[:change]
+	} else {
+		tx.Outputs[change].Value -= bump
+	}
+	tx.ID = tx.Hash()
+
+	privateKey, err := w.SigningKey()
+	if err != nil {
+		return nil, err
+	}
+	UTXO.SignTransaction(&tx, privateKey)
+
+	return &tx, nil
+}
+
+// newUnsignedTransaction selects outputs locked to pubKeyHash and builds an
+// unsigned transaction paying every payout, sending any change to
+// changeAddress and leaving fee unclaimed for the miner. The inputs carry
+// pubKey, which may be nil when the spending key is not known yet.
+func newUnsignedTransaction(pubKeyHash, pubKey []byte, changeAddress string, payouts []Payout, fee int, UTXO *UTXOSet) (Transaction, error) {
 	var inputs []TxInput
 	var outputs []TxOutput
 
+	total, err := ValidatePayouts(payouts)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if fee < 0 || total > math.MaxInt-fee {
+		return Transaction{}, fmt.Errorf("invalid fee %d", fee)
+	}
+	amount := total + fee
 
-	pubKeyHash := wallet.PublicKeyHash(w.PublicKey)
 	acc, validOutputs := UTXO.FindSpendableOutputs(pubKeyHash, amount)
 
 	if acc < amount {
-		log.Panic("Error: not enough funds")
+		return Transaction{}, errors.New("Error: not enough funds")
 	}
 
 	for txid, outs := range validOutputs {
@@ -91,34 +309,53 @@ func NewTransaction(w *wallet.Wallet, to string, amount int, UTXO *UTXOSet) *Tra
 		Handle(err)
 
 		for _, out := range outs {
-			input := TxInput{txID, out, nil, w.PublicKey}
+			input := TxInput{txID, out, nil, pubKey, 0}
 			inputs = append(inputs, input)
 		}
 	}
 
-	from := fmt.Sprintf("%s", w.Address())
-
-	outputs = append(outputs, *NewTXOutput(amount, to))
+	for _, p := range payouts {
+		outputs = append(outputs, *NewTXOutput(p.Amount, p.Address))
+	}
 
 	if acc > amount {
-		outputs = append(outputs, *NewTXOutput(acc-amount, from))
+		outputs = append(outputs, *NewTXOutput(acc-amount, changeAddress))
 	}
 
 	tx := Transaction{nil, inputs, outputs}
 	tx.ID = tx.Hash()
 
-	privateKey, _ := byteToPrivateKey(w.PrivateKey)
-	UTXO.Blockchain.SignTransaction(&tx, privateKey)
-	// chain.SignTransaction(&tx, w.PrivateKey)
+	return tx, nil
+}
 
-	return &tx
+// Involves reports whether the transaction pays to or spends from any of
+// the public key hashes.
+func (tx *Transaction) Involves(pubKeyHashes [][]byte) bool {
+	for _, pubKeyHash := range pubKeyHashes {
+		for _, out := range tx.Outputs {
+			if out.IsLockedWithKey(pubKeyHash) {
+				return true
+			}
+		}
+
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Inputs {
+			if in.UsesKey(pubKeyHash) {
+				return true
+			}
+		}
+	}
+
+	return false
 }
 
 func (tx *Transaction) IsCoinbase() bool {
 	return len(tx.Inputs) == 1 && len(tx.Inputs[0].ID) == 0 && tx.Inputs[0].Out == -1
 }
 
-func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transaction) {
+func (tx *Transaction) Sign(privKey wallet.SigningKey, prevTXs map[string]Transaction) {
 	if tx.IsCoinbase() {
 		return
 	}
@@ -130,22 +367,29 @@ func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transac
 	}
 	// fmt.Println("Signing transaction: ", tx)
 
-	txCopy := tx.TrimmedCopy()
-
-	for inId, in := range txCopy.Inputs {
+	for inId, in := range tx.Inputs {
 		prevTX := prevTXs[hex.EncodeToString(in.ID)]
-		txCopy.Inputs[inId].Signature = nil
-		txCopy.Inputs[inId].PubKey = prevTX.Outputs[in.Out].PubKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Inputs[inId].PubKey = nil
-
-		r, s, err := ecdsa.Sign(rand.Reader, &privKey, txCopy.ID)
+		err := tx.SignInput(inId, privKey, prevTX.Outputs[in.Out], SigHashAll)
 		Handle(err)
-		signature := append(r.Bytes(), s.Bytes()...)
+	}
+}
 
-		tx.Inputs[inId].Signature = signature
+// SignInput signs a single input given the output it spends. The signature
+// is followed by the sighash type.
+func (tx *Transaction) SignInput(inId int, privKey wallet.SigningKey, prevOut TxOutput, hashType SigHashType) error {
+	hash, err := tx.signingHash(inId, prevOut, hashType)
+	if err != nil {
+		return err
+	}
 
+	signature, err := privKey.Sign(hash)
+	if err != nil {
+		return err
 	}
+
+	tx.Inputs[inId].Signature = append(signature, byte(hashType))
+
+	return nil
 }
 
 func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
@@ -159,34 +403,55 @@ func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
 		}
 	}
 
-	txCopy := tx.TrimmedCopy()
-	curve := elliptic.P256()
-
+	var checks []inputCheck
 	for inId, in := range tx.Inputs {
 		prevTx := prevTXs[hex.EncodeToString(in.ID)]
-		txCopy.Inputs[inId].Signature = nil
-		txCopy.Inputs[inId].PubKey = prevTx.Outputs[in.Out].PubKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Inputs[inId].PubKey = nil
+		checks = append(checks, inputCheck{tx, inId, prevTx.Outputs[in.Out]})
+	}
+
+	return verifyInputs(checks)
+}
 
-		r := big.Int{}
-		s := big.Int{}
+// VerifyOutputs checks the signatures of the inputs given the outputs they
+// spend, in input order.
+func (tx *Transaction) VerifyOutputs(prevOuts []TxOutput) bool {
+	if len(prevOuts) != len(tx.Inputs) {
+		return false
+	}
 
-		sigLen := len(in.Signature)
-		r.SetBytes(in.Signature[:(sigLen / 2)])
-		s.SetBytes(in.Signature[(sigLen / 2):])
+	var checks []inputCheck
+	for inId := range tx.Inputs {
+		checks = append(checks, inputCheck{tx, inId, prevOuts[inId]})
+	}
 
-		x := big.Int{}
-		y := big.Int{}
-		keyLen := len(in.PubKey)
-		x.SetBytes(in.PubKey[:(keyLen / 2)])
-		y.SetBytes(in.PubKey[(keyLen / 2):])
+	return verifyInputs(checks)
+}
 
-		rawPubKey := ecdsa.PublicKey{curve, &x, &y}
-		if ecdsa.Verify(&rawPubKey, txCopy.ID, &r, &s) == false {
-			return false
-		}
+// VerifyInput checks the signature of a single input given the output it spends.
+func (tx *Transaction) VerifyInput(inId int, prevOut TxOutput) bool {
+	in := tx.Inputs[inId]
+	if len(in.Signature) < 2 || len(in.PubKey) == 0 {
+		return false
 	}
+	if !in.UsesKey(prevOut.PubKeyHash) {
+		return false
+	}
+
+	hashType := SigHashType(in.Signature[len(in.Signature)-1])
+	signature := in.Signature[:len(in.Signature)-1]
+
+	hash, err := tx.signingHash(inId, prevOut, hashType)
+	if err != nil {
+		return false
+	}
+
+	if sigCache.Contains(hash, in.PubKey, signature) {
+		return true
+	}
+	if !wallet.VerifySignature(in.PubKey, hash, signature) {
+		return false
+	}
+	sigCache.Add(hash, in.PubKey, signature)
 
 	return true
 }
@@ -196,7 +461,7 @@ func (tx *Transaction) TrimmedCopy() Transaction {
 	var outputs []TxOutput
 
 	for _, in := range tx.Inputs {
-		inputs = append(inputs, TxInput{in.ID, in.Out, nil, nil})
+		inputs = append(inputs, TxInput{in.ID, in.Out, nil, nil, in.Sequence})
 	}
 
 	for _, out := range tx.Outputs {
@@ -218,6 +483,7 @@ func (tx Transaction) String() string {
 		lines = append(lines, fmt.Sprintf("       Out:       %d", input.Out))
 		lines = append(lines, fmt.Sprintf("       Signature: %x", input.Signature))
 		lines = append(lines, fmt.Sprintf("       PubKey:    %x", input.PubKey))
+		lines = append(lines, fmt.Sprintf("       Sequence:  %d", input.Sequence))
 	}
 
 	for i, output := range tx.Outputs {
@@ -228,17 +494,3 @@ func (tx Transaction) String() string {
 
 	return strings.Join(lines, "\n")
 }
-
-func byteToPrivateKey(priv []byte) (ecdsa.PrivateKey, error) {
-	block, _ := pem.Decode(priv)
-	if block == nil {
-		return ecdsa.PrivateKey{}, fmt.Errorf("failed to parse PEM block containing the private key")
-	}
-
-	privateKey, err := x509.ParseECPrivateKey(block.Bytes)
-	if err != nil {
-		return ecdsa.PrivateKey{}, err
-	}
-
-	return *privateKey, nil
-}
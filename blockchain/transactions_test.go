@@ -0,0 +1,176 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"encoding/hex"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/mapfumo/golang-blockchain/wallet"
+)
+
+func TestHashExcludesSignatures(t *testing.T) {
+	f := newSighashFixture()
+	id := f.tx.Hash()
+	witness := f.tx.WitnessHash()
+
+	f.sign(t, 0, SigHashAll)
+	f.sign(t, 1, SigHashAll)
+
+	if !bytes.Equal(f.tx.Hash(), id) {
+		t.Errorf("expected signing not to change the transaction ID")
+	}
+	if bytes.Equal(f.tx.WitnessHash(), witness) {
+		t.Errorf("expected signing to change the witness hash")
+	}
+}
+
+func TestHashEncoding(t *testing.T) {
+	tx := Transaction{
+		Inputs:  []TxInput{{ID: []byte{1, 2}, Out: 1, Signature: []byte{3}, PubKey: []byte{4}}},
+		Outputs: []TxOutput{{Value: 10, PubKeyHash: []byte{5}}},
+	}
+
+	// The IDs must be the same on every node, whatever gob has encoded
+	// before in the process.
+	if id := hex.EncodeToString(tx.Hash()); id != "2195e8a3457a23893733d64a36eb38492e9e5a1dd2e39f12745e63b1354ba9f6" {
+		t.Errorf("unexpected transaction ID %s", id)
+	}
+	if witness := hex.EncodeToString(tx.WitnessHash()); witness != "203df5521f011599f2e5a8555b4ffb6f217a6fccff960305aadcb11fae67e8d7" {
+		t.Errorf("unexpected witness hash %s", witness)
+	}
+
+	// Fields are length prefixed, so moving a byte from one to the next
+	// changes the ID.
+	moved := tx
+	moved.Inputs = []TxInput{{ID: []byte{1}, Out: 1, Signature: []byte{3}, PubKey: []byte{2, 4}}}
+	if bytes.Equal(moved.Hash(), tx.Hash()) {
+		t.Errorf("expected fields to be length prefixed")
+	}
+
+	replaceable := tx
+	replaceable.Inputs = []TxInput{tx.Inputs[0]}
+	replaceable.Inputs[0].Sequence = SequenceReplaceable
+	if bytes.Equal(replaceable.Hash(), tx.Hash()) {
+		t.Errorf("expected the sequence to be part of the ID")
+	}
+}
+
+func TestNewReplacementTransaction(t *testing.T) {
+	alice := wallet.MakeWallet()
+	aliceHash := wallet.PublicKeyHash(alice.PublicKey)
+	isChange := func(pubKeyHash []byte) bool { return bytes.Equal(pubKeyHash, aliceHash) }
+
+	parent := CoinbaseTx(string(alice.Address()), "parent")
+	UTXO := &UTXOSet{Unconfirmed: []*Transaction{parent}}
+	orig := &Transaction{
+		Inputs:  []TxInput{{ID: parent.ID, Out: 0, PubKey: alice.PublicKey, Sequence: SequenceReplaceable}},
+		Outputs: []TxOutput{{Value: 10, PubKeyHash: []byte("bob")}, {Value: 9, PubKeyHash: aliceHash}},
+	}
+	orig.ID = orig.Hash()
+
+	bad := *orig
+	bad.Inputs = []TxInput{orig.Inputs[0]}
+	bad.Inputs[0].Out = 5
+	if _, err := NewReplacementTransaction(alice, &bad, 3, isChange, UTXO); err == nil {
+		t.Errorf("expected spending a missing output to be an error")
+	}
+	if _, err := NewReplacementTransaction(alice, orig, 1, isChange, UTXO); err == nil {
+		t.Errorf("expected a fee no higher than the current one to be an error")
+	}
+
+	tx, err := NewReplacementTransaction(alice, orig, 3, isChange, UTXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.Outputs) != 2 || tx.Outputs[0].Value != 10 || tx.Outputs[1].Value != 7 {
+		t.Errorf("expected the change to pay the higher fee, got %+v", tx.Outputs)
+	}
+	if !tx.IsReplaceable() || bytes.Equal(tx.ID, orig.ID) {
+		t.Errorf("expected a new replaceable transaction")
+	}
+}
+
+func TestVerifyRejectsHighS(t *testing.T) {
+	f := newSighashFixture()
+	f.sign(t, 0, SigHashAll)
+	id := f.tx.Hash()
+
+	// Replace s with n-s, the other valid signature for the same digest.
+	sig := f.tx.Inputs[0].Signature
+	curve := elliptic.P256()
+	r, s, err := wallet.ParseDERSignature(sig[:len(sig)-1], curve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	highS, err := wallet.EncodeDERSignature(r, new(big.Int).Sub(curve.Params().N, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.tx.Inputs[0].Signature = append(highS, sig[len(sig)-1])
+
+	if f.tx.VerifyInput(0, f.prevOuts[0]) {
+		t.Errorf("expected high-S signature to be rejected")
+	}
+	if !bytes.Equal(f.tx.Hash(), id) {
+		t.Errorf("expected re-encoded signature not to change the transaction ID")
+	}
+}
+
+func TestSignInputIsDeterministic(t *testing.T) {
+	f := newSighashFixture()
+
+	f.sign(t, 0, SigHashAll)
+	first := f.tx.Inputs[0].Signature
+
+	f.sign(t, 0, SigHashAll)
+	if !bytes.Equal(f.tx.Inputs[0].Signature, first) {
+		t.Errorf("expected re-signing to produce identical bytes, got %x and %x", first, f.tx.Inputs[0].Signature)
+	}
+}
+
+func TestMixedKeyTypes(t *testing.T) {
+	f := newSighashFixture()
+	f.sign(t, 0, SigHashAll)
+	f.sign(t, 1, SigHashAll)
+
+	for inId := range f.tx.Inputs {
+		if !f.tx.VerifyInput(inId, f.prevOuts[inId]) {
+			t.Errorf("input %d signed with %s does not verify", inId, f.keys[inId].Type())
+		}
+	}
+
+	// A signature only verifies under the key it was made with.
+	f.tx.Inputs[0].Signature, f.tx.Inputs[1].Signature = f.tx.Inputs[1].Signature, f.tx.Inputs[0].Signature
+	for inId := range f.tx.Inputs {
+		if f.tx.VerifyInput(inId, f.prevOuts[inId]) {
+			t.Errorf("input %d verified with the other scheme's signature", inId)
+		}
+	}
+}
+
+func TestValidatePayouts(t *testing.T) {
+	alice, bob := wallet.MakeWallet(), wallet.MakeWallet()
+	aliceAddr, bobAddr := string(alice.Address()), string(bob.Address())
+
+	total, err := ValidatePayouts([]Payout{{aliceAddr, 5}, {bobAddr, 7}})
+	if err != nil || total != 12 {
+		t.Errorf("expected a total of 12, got %d, %v", total, err)
+	}
+
+	for name, payouts := range map[string][]Payout{
+		"none":             nil,
+		"invalid address":  {{aliceAddr, 5}, {"not an address", 7}},
+		"duplicate":        {{aliceAddr, 5}, {bobAddr, 7}, {aliceAddr, 5}},
+		"duplicate legacy": {{aliceAddr, 5}, {wallet.Address{KeyType: alice.KeyType, PubKeyHash: alice.KeyHash()}.String(), 5}},
+		"zero amount":      {{aliceAddr, 0}},
+		"negative amount":  {{aliceAddr, 5}, {bobAddr, -1}},
+		"overflow":         {{aliceAddr, math.MaxInt}, {bobAddr, 1}},
+	} {
+		if _, err := ValidatePayouts(payouts); err == nil {
+			t.Errorf("%s: expected payouts to be rejected", name)
+		}
+	}
+}
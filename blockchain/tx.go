@@ -3,6 +3,7 @@ package blockchain
 import (
 	"bytes"
 	"encoding/gob"
+	"log"
 
 	"github.com/mapfumo/golang-blockchain/wallet"
 )
@@ -12,15 +13,34 @@ type TxOutput struct {
 	PubKeyHash []byte
 }
 
+// TxOutputs are the unspent outputs of one transaction. Indices holds the
+// index of each output in the transaction; sets stored before it was kept
+// leave it empty and use the position instead.
 type TxOutputs struct {
 	Outputs []TxOutput
+	Indices []int
 }
 
+// Index returns the index in the transaction of the i-th unspent output.
+func (outs TxOutputs) Index(i int) int {
+	if i < len(outs.Indices) {
+		return outs.Indices[i]
+	}
+
+	return i
+}
+
+// SequenceReplaceable is the input sequence number that opts a transaction
+// in to replace-by-fee. Inputs default to sequence 0, which keeps the
+// transaction final once it is broadcast.
+const SequenceReplaceable uint32 = 1
+
 type TxInput struct {
 	ID        []byte
 	Out       int
 	Signature []byte
 	PubKey    []byte
+	Sequence  uint32
 }
 
 func (in *TxInput) UsesKey(pubKeyHash []byte) bool {
@@ -30,9 +50,11 @@ func (in *TxInput) UsesKey(pubKeyHash []byte) bool {
 }
 
 func (out *TxOutput) Lock(address []byte) {
-	pubKeyHash := wallet.Base58Decode(address)
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
-	out.PubKeyHash = pubKeyHash
+	decoded, err := wallet.DecodeAddress(string(address))
+	if err != nil {
+		log.Panic(err)
+	}
+	out.PubKeyHash = decoded.PubKeyHash
 }
 
 func (out *TxOutput) IsLockedWithKey(pubKeyHash []byte) bool {
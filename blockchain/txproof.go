@@ -0,0 +1,54 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// TxProof shows that a transaction is included in a block. It is checked
+// against the Merkle root of the block, so a verifier needs only the block
+// header and not the block's transactions.
+type TxProof struct {
+	BlockHash  []byte
+	Height     int
+	MerkleRoot []byte
+	TxID       []byte
+	Proof      MerkleProof
+}
+
+// NewTxProof builds the inclusion proof of the transaction in the block.
+func NewTxProof(block *Block, txID []byte) (*TxProof, error) {
+	proof, err := block.MerkleProof(txID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TxProof{block.Hash, block.Height, block.HashTransactions(), txID, proof}, nil
+}
+
+// Verify checks the Merkle path from the transaction to the proof's root.
+// Callers must still check that the root belongs to a block they trust.
+func (p *TxProof) Verify() bool {
+	return VerifyMerkleProof(p.MerkleRoot, p.TxID, p.Proof)
+}
+
+func (p *TxProof) Serialize() []byte {
+	var encoded bytes.Buffer
+
+	enc := gob.NewEncoder(&encoded)
+	err := enc.Encode(p)
+	Handle(err)
+
+	return encoded.Bytes()
+}
+
+func DeserializeTxProof(data []byte) (*TxProof, error) {
+	var proof TxProof
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&proof); err != nil {
+		return nil, err
+	}
+
+	return &proof, nil
+}
@@ -3,9 +3,12 @@ package blockchain
 import (
 	"bytes"
 	"encoding/hex"
+	"fmt"
 	"log"
 
 	badger "github.com/dgraph-io/badger"
+
+	"github.com/mapfumo/golang-blockchain/wallet"
 )
 
 var (
@@ -19,13 +22,25 @@ var (
 // Unspent transaction sets
 type UTXOSet struct {
 	Blockchain *BlockChain
+	// Unconfirmed are memory pool transactions, parents first. When set,
+	// their outputs can be spent too and the outputs they spend cannot.
+	Unconfirmed []*Transaction
 }
 
+// FindSpendableOutputs selects outputs locked to pubKeyHash worth at least
+// amount, using confirmed outputs before unconfirmed ones.
 func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int) {
 	unspentOuts := make(map[string][]int)
 	accumulated := 0
 	db := u.Blockchain.Database
 
+	spent := make(map[string]bool)
+	for _, tx := range u.Unconfirmed {
+		for _, in := range tx.Inputs {
+			spent[fmt.Sprintf("%x:%d", in.ID, in.Out)] = true
+		}
+	}
+
 	err := db.View(func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
 
@@ -41,19 +56,62 @@ func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[s
 			txID := hex.EncodeToString(k)
 			outs := DeserializeOutputs(v)
 
-			for outIdx, out := range outs.Outputs {
+			for i, out := range outs.Outputs {
+				if spent[fmt.Sprintf("%s:%d", txID, outs.Index(i))] {
+					continue
+				}
 				if out.IsLockedWithKey(pubKeyHash) && accumulated < amount {
 					accumulated += out.Value
-					unspentOuts[txID] = append(unspentOuts[txID], outIdx)
+					unspentOuts[txID] = append(unspentOuts[txID], outs.Index(i))
 				}
 			}
 		}
 		return nil
 	})
 	Handle(err)
+
+	for _, tx := range u.Unconfirmed {
+		txID := hex.EncodeToString(tx.ID)
+		for outIdx, out := range tx.Outputs {
+			if spent[fmt.Sprintf("%s:%d", txID, outIdx)] {
+				continue
+			}
+			if out.IsLockedWithKey(pubKeyHash) && accumulated < amount {
+				accumulated += out.Value
+				unspentOuts[txID] = append(unspentOuts[txID], outIdx)
+			}
+		}
+	}
+
 	return accumulated, unspentOuts
 }
 
+// FindTransaction looks a transaction up among the unconfirmed ones, then
+// in the chain.
+func (u UTXOSet) FindTransaction(ID []byte) (Transaction, error) {
+	for _, tx := range u.Unconfirmed {
+		if bytes.Equal(tx.ID, ID) {
+			return *tx, nil
+		}
+	}
+
+	return u.Blockchain.FindTransaction(ID)
+}
+
+// SignTransaction signs the inputs of tx, which may spend unconfirmed
+// outputs.
+func (u UTXOSet) SignTransaction(tx *Transaction, privKey wallet.SigningKey) {
+	prevTXs := make(map[string]Transaction)
+
+	for _, in := range tx.Inputs {
+		prevTX, err := u.FindTransaction(in.ID)
+		Handle(err)
+		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
+	}
+
+	tx.Sign(privKey, prevTXs)
+}
+
 func (u UTXOSet) FindUnspentTransactions(pubKeyHash []byte) []TxOutput {
 	var UTXOs []TxOutput
 
@@ -84,6 +142,37 @@ func (u UTXOSet) FindUnspentTransactions(pubKeyHash []byte) []TxOutput {
 	return UTXOs
 }
 
+// FindOutput returns output index of transaction txID if it is unspent.
+func (u UTXOSet) FindOutput(txID []byte, index int) (TxOutput, bool) {
+	var output TxOutput
+	found := false
+
+	err := u.Blockchain.Database.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(append(append([]byte{}, utxoPrefix...), txID...))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		v, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		outs := DeserializeOutputs(v)
+		for i, out := range outs.Outputs {
+			if outs.Index(i) == index {
+				output, found = out, true
+			}
+		}
+		return nil
+	})
+	Handle(err)
+
+	return output, found
+}
+
 func (u UTXOSet) CountTransactions() int {
 	db := u.Blockchain.Database
 	counter := 0
@@ -145,9 +234,10 @@ func (u *UTXOSet) Update(block *Block) {
 
 					outs := DeserializeOutputs(v)
 
-					for outIdx, out := range outs.Outputs {
-						if outIdx != in.Out {
+					for i, out := range outs.Outputs {
+						if outs.Index(i) != in.Out {
 							updatedOuts.Outputs = append(updatedOuts.Outputs, out)
+							updatedOuts.Indices = append(updatedOuts.Indices, outs.Index(i))
 						}
 					}
 
@@ -165,8 +255,9 @@ func (u *UTXOSet) Update(block *Block) {
 			}
 
 			newOutputs := TxOutputs{}
-			for _, out := range tx.Outputs {
+			for outIdx, out := range tx.Outputs {
 				newOutputs.Outputs = append(newOutputs.Outputs, out)
+				newOutputs.Indices = append(newOutputs.Indices, outIdx)
 			}
 
 			txID := append(utxoPrefix, tx.ID...)
@@ -0,0 +1,76 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"os"
+	"testing"
+
+	"github.com/mapfumo/golang-blockchain/wallet"
+)
+
+func TestUTXOSetKeepsOutputIndices(t *testing.T) {
+	chdirTemp(t)
+	if err := os.Mkdir("tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	alice, bob := wallet.MakeWallet(), wallet.MakeWallet()
+	aliceAddr, bobAddr := string(alice.Address()), string(bob.Address())
+
+	chain := InitBlockChain(aliceAddr, "test")
+	defer chain.Database.Close()
+	UTXO := &UTXOSet{Blockchain: chain}
+	UTXO.Reindex()
+
+	// Outputs: 0 pays bob, 1 is alice's change.
+	pay, err := NewTransaction(alice, bobAddr, 5, 0, "", false, UTXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	UTXO.Update(chain.MineBlock([]*Transaction{CoinbaseTx(bobAddr, ""), pay}))
+
+	bobPubKeyHash := wallet.PublicKeyHash(bob.PublicKey)
+	_, bobOuts := UTXO.FindSpendableOutputs(bobPubKeyHash, 25)
+	if outs := bobOuts[hex.EncodeToString(pay.ID)]; len(outs) != 1 || outs[0] != 0 {
+		t.Fatalf("expected bob to spend output 0 of the payment, got %v", outs)
+	}
+
+	if _, err := NewTransaction(bob, aliceAddr, 100, 0, "", false, UTXO); err == nil {
+		t.Errorf("expected spending more than the balance to be an error")
+	}
+	spend, err := NewTransaction(bob, aliceAddr, 25, 0, "", false, UTXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	UTXO.Update(chain.MineBlock([]*Transaction{CoinbaseTx(bobAddr, ""), spend}))
+
+	for _, check := range []func(){func() {}, UTXO.Reindex} {
+		check()
+
+		if _, ok := UTXO.FindOutput(pay.ID, 0); ok {
+			t.Errorf("expected the spent output to be gone")
+		}
+		if out, ok := UTXO.FindOutput(pay.ID, 1); !ok || out.Value != 15 {
+			t.Errorf("expected the change to stay at output 1, got %v %v", out, ok)
+		}
+	}
+
+	// Spending the change must reference its original index.
+	change, err := NewTransaction(alice, bobAddr, 15, 0, "", false, UTXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !chain.VerifyTransaction(change) {
+		t.Errorf("expected a spend of the remaining output to verify")
+	}
+
+	// Change can go to another address of the wallet.
+	fresh := wallet.MakeWallet()
+	toFresh, err := NewTransaction(alice, bobAddr, 5, 0, string(fresh.Address()), false, UTXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toFresh.Outputs) != 2 || !toFresh.Outputs[1].IsLockedWithKey(wallet.PublicKeyHash(fresh.PublicKey)) {
+		t.Errorf("expected the change to pay the change address")
+	}
+}
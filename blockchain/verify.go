@@ -0,0 +1,55 @@
+package blockchain
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// inputCheck is the signature check of one transaction input.
+type inputCheck struct {
+	tx      *Transaction
+	inId    int
+	prevOut TxOutput
+}
+
+// verifyInputs runs the signature checks on a bounded pool of workers, one
+// per CPU, and stops handing out work as soon as a check fails.
+func verifyInputs(checks []inputCheck) bool {
+	workers := min(runtime.GOMAXPROCS(0), len(checks))
+	if workers <= 1 {
+		for _, check := range checks {
+			if !check.tx.VerifyInput(check.inId, check.prevOut) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	jobs := make(chan inputCheck)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for check := range jobs {
+				if !failed.Load() && !check.tx.VerifyInput(check.inId, check.prevOut) {
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+
+	for _, check := range checks {
+		if failed.Load() {
+			break
+		}
+		jobs <- check
+	}
+	close(jobs)
+	wg.Wait()
+
+	return !failed.Load()
+}
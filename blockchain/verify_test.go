@@ -0,0 +1,178 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"os"
+	"testing"
+
+	"github.com/mapfumo/golang-blockchain/wallet"
+)
+
+// newVerifyFixture builds a signed transaction spending n outputs of a
+// single previous transaction.
+func newVerifyFixture(tb testing.TB, n int, keyType wallet.KeyType) (*Transaction, map[string]Transaction) {
+	tb.Helper()
+
+	w, err := wallet.MakeWalletOfType(keyType)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	key, err := w.SigningKey()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	pubKeyHash := wallet.PublicKeyHash(w.PublicKey)
+
+	prevTX := Transaction{}
+	for i := 0; i < n; i++ {
+		prevTX.Outputs = append(prevTX.Outputs, TxOutput{1, pubKeyHash})
+	}
+	prevTX.ID = prevTX.Hash()
+
+	tx := &Transaction{Outputs: []TxOutput{{n, pubKeyHash}}}
+	for i := 0; i < n; i++ {
+		tx.Inputs = append(tx.Inputs, TxInput{prevTX.ID, i, nil, w.PublicKey, 0})
+	}
+	tx.ID = tx.Hash()
+
+	prevTXs := map[string]Transaction{hex.EncodeToString(prevTX.ID): prevTX}
+	tx.Sign(key, prevTXs)
+
+	return tx, prevTXs
+}
+
+func openTestChain(t *testing.T) *BlockChain {
+	t.Helper()
+	chdirTemp(t)
+	if err := os.Mkdir("tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	chain := InitBlockChain(string(wallet.MakeWallet().Address()), "test")
+	t.Cleanup(func() { chain.Database.Close() })
+
+	return chain
+}
+
+func withSigCache(cache *SigCache, f func()) {
+	saved := sigCache
+	sigCache = cache
+	defer func() { sigCache = saved }()
+
+	f()
+}
+
+func TestParallelVerifyDetectsBadInput(t *testing.T) {
+	withSigCache(nil, func() {
+		tx, prevTXs := newVerifyFixture(t, 64, wallet.KeyTypeP256)
+		if !tx.Verify(prevTXs) {
+			t.Fatalf("expected transaction to verify")
+		}
+
+		sig := tx.Inputs[41].Signature
+		tx.Inputs[41].Signature = tx.Inputs[40].Signature
+		if tx.Verify(prevTXs) {
+			t.Errorf("expected a transaction with one bad input to fail")
+		}
+		tx.Inputs[41].Signature = sig
+	})
+}
+
+func TestVerifyUsesSigCache(t *testing.T) {
+	withSigCache(NewSigCache(100), func() {
+		tx, prevTXs := newVerifyFixture(t, 8, wallet.KeyTypeEd25519)
+
+		if !tx.Verify(prevTXs) {
+			t.Fatalf("expected transaction to verify")
+		}
+		if got := sigCache.Len(); got != 8 {
+			t.Errorf("expected 8 cached signatures, got %d", got)
+		}
+
+		// A cached signature must not vouch for a different transaction.
+		tx.Outputs[0].Value++
+		if tx.Verify(prevTXs) {
+			t.Errorf("expected modified transaction to fail despite the cache")
+		}
+	})
+}
+
+func TestSigCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewSigCache(2)
+	a, b, c := []byte("a"), []byte("b"), []byte("c")
+
+	cache.Add(a, a, a)
+	cache.Add(b, b, b)
+	cache.Contains(a, a, a)
+	cache.Add(c, c, c)
+
+	if !cache.Contains(a, a, a) || !cache.Contains(c, c, c) {
+		t.Errorf("expected recently used entries to stay cached")
+	}
+	if cache.Contains(b, b, b) {
+		t.Errorf("expected least recently used entry to be evicted")
+	}
+	if cache.Contains([]byte("ab"), nil, a) {
+		t.Errorf("expected differently split keys not to collide")
+	}
+}
+
+func TestVerifyTransactionsRejectsUnknownInputs(t *testing.T) {
+	chain := openTestChain(t)
+
+	// The fixture spends a transaction that is not in the chain.
+	tx, _ := newVerifyFixture(t, 2, wallet.KeyTypeP256)
+	if chain.VerifyTransactions([]*Transaction{tx}) {
+		t.Errorf("expected a block spending an unknown transaction to be rejected")
+	}
+}
+
+func TestVerifyTransactionRejectsBadInputs(t *testing.T) {
+	chain := openTestChain(t)
+
+	tx, _ := newVerifyFixture(t, 1, wallet.KeyTypeP256)
+	if chain.VerifyTransaction(tx) {
+		t.Errorf("expected a transaction spending an unknown transaction to be rejected")
+	}
+
+	genesis := chain.Iterator().Next().Transactions[0]
+	tx.Inputs[0].ID = genesis.ID
+	tx.Inputs[0].Out = len(genesis.Outputs)
+	tx.ID = tx.Hash()
+	if chain.VerifyTransaction(tx) {
+		t.Errorf("expected a transaction spending a missing output to be rejected")
+	}
+}
+
+func benchmarkVerify(b *testing.B, cache *SigCache, parallel bool) {
+	withSigCache(cache, func() {
+		tx, prevTXs := newVerifyFixture(b, 256, wallet.KeyTypeP256)
+		if !tx.Verify(prevTXs) {
+			b.Fatalf("expected transaction to verify")
+		}
+		prevTX := prevTXs[hex.EncodeToString(tx.Inputs[0].ID)]
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if parallel {
+				tx.Verify(prevTXs)
+				continue
+			}
+			for inId, in := range tx.Inputs {
+				tx.VerifyInput(inId, prevTX.Outputs[in.Out])
+			}
+		}
+	})
+}
+
+func BenchmarkVerifySequential(b *testing.B) {
+	benchmarkVerify(b, nil, false)
+}
+
+func BenchmarkVerifyParallel(b *testing.B) {
+	benchmarkVerify(b, nil, true)
+}
+
+func BenchmarkVerifyCached(b *testing.B) {
+	benchmarkVerify(b, NewSigCache(DefaultSigCacheSize), true)
+}
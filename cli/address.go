@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mapfumo/golang-blockchain/wallet"
+)
+
+// validateAddress prints what an address decodes to, or where a single
+// mistyped character in a bech32m address is.
+func (cli *CommandLine) validateAddress(address string) {
+	decoded, err := wallet.ParseAddress(address)
+	var checksumErr *wallet.ChecksumError
+	if errors.As(err, &checksumErr) && len(checksumErr.Positions) > 0 {
+		fmt.Printf("Invalid address, check the character at position %d:\n", checksumErr.Positions[0]+1)
+		fmt.Println(address)
+		fmt.Println(strings.Repeat(" ", checksumErr.Positions[0]) + "^")
+		return
+	}
+	if err != nil {
+		fmt.Printf("Invalid address: %v\n", err)
+		return
+	}
+
+	network := "any (legacy base58)"
+	if decoded.Network != nil {
+		network = decoded.Network.Name
+	}
+	fmt.Printf("Network: %s\n", network)
+	fmt.Printf("Key type: %s\n", decoded.KeyType)
+	fmt.Printf("Key hash: %x\n", decoded.PubKeyHash)
+	if err := wallet.ValidateAddress(address); err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Println("Address is valid")
+	}
+}
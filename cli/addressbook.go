@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+	"github.com/mapfumo/golang-blockchain/wallet"
+)
+
+// resolveAddress returns the address a label of ours or of a contact
+// names, or the address itself.
+func resolveAddress(name, nodeID string) string {
+	wallets, _ := wallet.CreateWallets(nodeID)
+	address, err := wallets.Resolve(name)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return address
+}
+
+// resolvePayouts replaces labels in payouts by their addresses, leaving
+// anything else for ValidatePayouts to report.
+func resolvePayouts(payouts []blockchain.Payout, nodeID string) {
+	wallets, _ := wallet.CreateWallets(nodeID)
+	for i, p := range payouts {
+		if address, err := wallets.Resolve(p.Address); err == nil {
+			payouts[i].Address = address
+		}
+	}
+}
+
+func (cli *CommandLine) setLabel(address, label, nodeID string) {
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	if err := wallets.SetLabel(address, label); err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveFile(nodeID)
+
+	if label == "" {
+		fmt.Printf("Removed the label of %s\n", address)
+	} else {
+		fmt.Printf("Labelled %s %q\n", address, label)
+	}
+}
+
+func (cli *CommandLine) addContact(label, address, nodeID string) {
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	if err := wallets.AddContact(label, address); err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveFile(nodeID)
+
+	fmt.Printf("Added contact %q at %s\n", label, address)
+}
+
+func (cli *CommandLine) removeContact(label, nodeID string) {
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	if err := wallets.RemoveContact(label); err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveFile(nodeID)
+
+	fmt.Printf("Removed contact %q\n", label)
+}
+
+func (cli *CommandLine) listContacts(nodeID string) {
+	wallets, _ := wallet.CreateWallets(nodeID)
+
+	for _, contact := range wallets.GetContacts() {
+		fmt.Printf("%q %s added %s\n", contact.Label, contact.Address, contact.Created.Format("2006-01-02 15:04"))
+	}
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+	"github.com/mapfumo/golang-blockchain/network"
+	"github.com/mapfumo/golang-blockchain/wallet"
+)
+
+// bumpFee replaces a transaction still in the memory pool of the central
+// node with one paying fee, signed by the wallet that sent it.
+func (cli *CommandLine) bumpFee(txID string, fee int, nodeID string) {
+	id, err := hex.DecodeString(txID)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	chain := blockchain.ContinueBlockChain(nodeID)
+	UTXOSet := spendableUTXOSet(chain, true)
+	defer chain.Database.Close()
+
+	var orig *blockchain.Transaction
+	for _, tx := range UTXOSet.Unconfirmed {
+		if bytes.Equal(tx.ID, id) {
+			orig = tx
+		}
+	}
+	if orig == nil {
+		log.Panic("Transaction is not in the memory pool")
+	}
+
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	unlockWallets(wallets)
+
+	var from *wallet.Wallet
+	internal := make(map[string]bool)
+	for _, address := range wallets.GetAllAddresses() {
+		w := wallets.GetWallet(address)
+		if orig.Inputs[0].UsesKey(w.KeyHash()) {
+			from = &w
+		}
+		if w.Internal {
+			internal[hex.EncodeToString(w.KeyHash())] = true
+		}
+	}
+	if from == nil {
+		log.Panic("Transaction was not sent from our wallet file")
+	}
+	// Change went to a change address, or back to the sender before they
+	// existed.
+	isChange := func(pubKeyHash []byte) bool {
+		return internal[hex.EncodeToString(pubKeyHash)] || bytes.Equal(pubKeyHash, from.KeyHash())
+	}
+
+	tx, err := blockchain.NewReplacementTransaction(from, orig, fee, isChange, &UTXOSet)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	network.SendTx(network.KnownNodes[0], tx)
+	recordTransaction(chain, tx, nodeID)
+	fmt.Printf("Replaced %x with %x\n", orig.ID, tx.ID)
+}
@@ -7,6 +7,8 @@ import (
 	"os"
 	"runtime"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/mapfumo/golang-blockchain/blockchain"
 	"github.com/mapfumo/golang-blockchain/network"
@@ -17,14 +19,42 @@ type CommandLine struct{}
 
 func (cli *CommandLine) printUsage() {
 	fmt.Println("Usage:")
-	fmt.Println(" getbalance -address ADDRESS - get the balance for an address")
+	fmt.Println(" getbalance -address ADDRESS -spv - get the balance for an address, or the confirmed, unconfirmed and immature balance of our wallet file without -address. -spv uses the headers and proofs of a light client")
 	fmt.Println(" createblockchain -address ADDRESS creates a blockchain and sends genesis reward to address")
 	fmt.Println(" printchain - Prints the blocks in the chain")
-	fmt.Println(" send -from FROM -to TO -amount AMOUNT -mine - Send amount of coins. Then -mine flag is set, mine off of this node")
-	fmt.Println(" createwallet - Creates a new Wallet")
-	fmt.Println(" listaddresses - Lists the addresses in our wallet file")
+	fmt.Println(" send -from FROM -to TO -amount AMOUNT -fee FEE -mine -unconfirmed -rbf -warnreuse - Send amount of coins, leaving fee to the miner and change to a fresh address of the wallet. Then -mine flag is set, mine off of this node. With -unconfirmed, outputs in the memory pool can be spent. -rbf lets bumpfee replace the transaction. -warnreuse asks before paying an address that already received coins. FROM and TO can be labels of our addresses or contacts")
+	fmt.Println(" sendmany -from FROM -file FILE -fee FEE -mine -unconfirmed -rbf -warnreuse - Pay every address or label listed in a JSON or CSV file in one transaction")
+	fmt.Println(" bumpfee -txid TXID -fee FEE - Replace an unconfirmed transaction sent with -rbf by one paying the higher fee FEE")
+	fmt.Println(" estimatefee -blocks N - Estimate the fee rate needed to confirm within N blocks")
+	fmt.Println(" createpsbt -from FROM -to TO -amount AMOUNT -fee FEE -out FILE - Create an unsigned transaction without the private key")
+	fmt.Println(" signpsbt -in FILE -out FILE -sighash TYPE - Sign the inputs of a partial transaction owned by our wallet file")
+	fmt.Println(" combinepsbt -in FILE,FILE,... -out FILE - Merge the signatures of several partial transactions")
+	fmt.Println(" finalizepsbt -in FILE -out FILE - Verify a fully signed partial transaction and write the raw transaction")
+	fmt.Println(" broadcasttx -in FILE - Send a raw transaction to the network")
+	fmt.Println(" gettxproof -txid TXID - Print a Merkle proof that the transaction is in a block")
+	fmt.Println(" verifytxproof -proof PROOF -root ROOT - Check a Merkle proof against ROOT or the block in our chain")
+	fmt.Println(" createwallet -type TYPE -account N -mnemonic -passphrase PASS -label LABEL - Derives the next address of HD account N from the wallet seed. -type ed25519 creates a random Ed25519 key instead. -mnemonic creates the seed from a new recovery phrase")
+	fmt.Println(" restorewallet -mnemonic \"WORDS\" -passphrase PASS - Restore the wallet seed from its recovery phrase and rescan the chain for its addresses")
+	fmt.Println(" encryptwallet - Encrypt the seed and private keys of our wallet file with a passphrase")
+	fmt.Println(" changepassphrase - Change the passphrase of our encrypted wallet file")
+	fmt.Println(" unlock -timeout SECONDS - Unlock our encrypted wallet file in the running node so send, sendmany and signpsbt are signed by it without the passphrase. It locks again after SECONDS, or with lock when 0")
+	fmt.Println(" lock - Lock our wallet file in the running node again")
+	fmt.Println(" dumpprivkey -address ADDRESS -pem - Print the private key of an address in our wallet file. -pem prints it as a PKCS #8 PEM block")
+	fmt.Println(" importprivkey -key KEY -pem FILE - Add a private key printed by dumpprivkey, or read from a PEM file, to our wallet file. A P-256 key from a PEM file also adds the address it had in wallets made before key types existed")
+	fmt.Println(" signmessage -address ADDRESS -message MESSAGE - Sign a message with the key of an address in our wallet file, proving control of the address")
+	fmt.Println(" verifymessage -address ADDRESS -signature SIGNATURE -message MESSAGE - Check a message signature against an address")
+	fmt.Println(" validateaddress -address ADDRESS - Show the network and key of an address, or where a typo in it is")
+	fmt.Println(" dumpxpub -account N - Print the extended public key of HD account N")
+	fmt.Println(" importwatchonly -address ADDRESS -pubkey HEX -xpub XPUB - Watch the balance of an address, public key or extended public key without its private keys")
+	fmt.Println(" listaddresses -label TEXT - Lists the addresses in our wallet file, oldest first, with their labels. -label only lists those whose label contains TEXT")
+	fmt.Println(" setlabel -address ADDRESS -label LABEL - Label an address in our wallet file, or remove its label with an empty one")
+	fmt.Println(" addcontact -label LABEL -address ADDRESS - Add someone else's address to the address book")
+	fmt.Println(" removecontact -label LABEL - Remove an address from the address book")
+	fmt.Println(" listcontacts - Lists the address book")
+	fmt.Println(" listunspent - Lists the unspent outputs of our wallet file with their confirmations")
+	fmt.Println(" listtransactions - Lists the confirmed and pending transactions of our wallet file")
 	fmt.Println(" reindexutxo - Rebuilds the UTXO set")
-	fmt.Println(" startnode -miner ADDRESS - Start a node with ID specified in NODE_ID env. var. -miner enables mining")
+	fmt.Println(" startnode -miner ADDRESS -spv - Start a node with ID specified in NODE_ID env. var. -miner enables mining, -spv runs a light client that syncs headers only")
 }
 
 func (cli *CommandLine) validateArgs() {
@@ -39,41 +69,122 @@ func (cli *CommandLine) StartNode(nodeID, minerAddress string) {
 	fmt.Printf("Starting Node %s\n", nodeID)
 
 	if len(minerAddress) > 0 {
-		if wallet.ValidateAddress(minerAddress) {
+		if err := wallet.ValidateAddress(minerAddress); err == nil {
 			fmt.Println("Mining is on. Address to receive rewards: ", minerAddress)
 		} else {
-			log.Panic("Wrong miner address!")
+			log.Panic("Wrong miner address! ", err)
 		}
 	}
 	network.StartServer(nodeID, minerAddress)
 }
 
+func (cli *CommandLine) StartSPVNode(nodeID string) {
+	fmt.Printf("Starting SPV Node %s\n", nodeID)
+
+	network.StartSPVServer(nodeID)
+}
+
 
 
 func (cli *CommandLine) reindexUTXO(nodeID string) {
 	chain := blockchain.ContinueBlockChain(nodeID)
 	defer chain.Database.Close()
-	UTXOSet := blockchain.UTXOSet{chain}
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
 	UTXOSet.Reindex()
 
 	count := UTXOSet.CountTransactions()
 	fmt.Printf("Done! There are %d transactions in the UTXO set.\n", count)
 }
 
-func (cli *CommandLine) listAddresses(nodeID string) {
+func (cli *CommandLine) listAddresses(label, nodeID string) {
 	wallets, _ := wallet.CreateWallets(nodeID)
 	addresses := wallets.GetAllAddresses()
 
 	for _, address := range addresses {
-		fmt.Println(address)
+		w := wallets.Wallets[address]
+		if label != "" && !strings.Contains(w.Label, label) {
+			continue
+		}
+
+		fields := []string{address}
+		if w.Path != "" {
+			fields = append(fields, w.Path)
+		}
+		if w.WatchOnly {
+			fields = append(fields, "watch-only")
+		}
+		if w.Internal {
+			fields = append(fields, "change")
+		}
+		if w.Label != "" {
+			fields = append(fields, fmt.Sprintf("%q", w.Label))
+		}
+		if !w.Created.IsZero() {
+			fields = append(fields, w.Created.Format("2006-01-02 15:04"))
+		}
+		fmt.Println(strings.Join(fields, " "))
 	}
 
 }
 
 
-func (cli *CommandLine) createWallet(nodeID string) {
+func (cli *CommandLine) createWallet(keyTypeName string, account uint, withMnemonic bool, passphrase, label, nodeID string) {
+	keyType, err := wallet.ParseKeyType(keyTypeName)
+	if err != nil {
+		log.Panic(err)
+	}
+
 	wallets, _ := wallet.CreateWallets(nodeID)
-	address := wallets.AddWallet()
+
+	if withMnemonic {
+		if wallets.HasSeed() {
+			log.Panic("Wallet file already has a seed")
+		}
+		unlockWallets(wallets)
+		mnemonic, err := wallet.NewMnemonic(256)
+		if err != nil {
+			log.Panic(err)
+		}
+		seed, err := wallet.MnemonicSeed(mnemonic, passphrase)
+		if err != nil {
+			log.Panic(err)
+		}
+		if err := wallets.SetSeed(seed); err != nil {
+			log.Panic(err)
+		}
+
+		fmt.Println("Write down your recovery phrase and keep it safe:")
+		fmt.Println(mnemonic)
+	}
+
+	// Only P-256 keys are derived from the seed; Ed25519 keys stay random.
+	// A locked wallet file derives addresses of its existing accounts
+	// without the passphrase.
+	var address string
+	for {
+		if keyType == wallet.KeyTypeP256 {
+			if !wallets.HasSeed() {
+				err = wallets.NewSeed()
+			}
+			if err == nil {
+				address, err = wallets.DeriveAddress(uint32(account), wallet.ExternalChain)
+			}
+		} else {
+			address, err = wallets.AddWalletOfType(keyType)
+		}
+		if err != wallet.ErrWalletLocked {
+			break
+		}
+		unlockWallets(wallets)
+	}
+	if err != nil {
+		log.Panic(err)
+	}
+	if label != "" {
+		if err := wallets.SetLabel(address, label); err != nil {
+			log.Panic(err)
+		}
+	}
 	wallets.SaveFile(nodeID)
 
 	fmt.Printf("New address is: %s\n", address)
@@ -103,30 +214,29 @@ func (cli *CommandLine) printChain(nodeID string) {
 }
 
 func (cli *CommandLine) createBlockChain(address, nodeID string) {
-	if !wallet.ValidateAddress(address) {
-		log.Panic("Address is not Valid")
+	if err := wallet.ValidateAddress(address); err != nil {
+		log.Panic(err)
 	}
 	chain := blockchain.InitBlockChain(address, nodeID)
 	defer chain.Database.Close()
 
-	UTXOSet := blockchain.UTXOSet{chain}
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
 	UTXOSet.Reindex()
 
 	fmt.Println("Finished!")
 }
 
 func (cli *CommandLine) getBalance(address, nodeID string) {
-	if !wallet.ValidateAddress(address) {
-		log.Panic("Address is not Valid")
+	decoded, err := wallet.DecodeAddress(address)
+	if err != nil {
+		log.Panic(err)
 	}
 	chain := blockchain.ContinueBlockChain(nodeID)
-	UTXOSet := blockchain.UTXOSet{chain}
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
 	defer chain.Database.Close()
 
 	balance := 0
-	pubKeyHash := wallet.Base58Decode([]byte(address))
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
-	UTXOs := UTXOSet.FindUnspentTransactions(pubKeyHash)
+	UTXOs := UTXOSet.FindUnspentTransactions(decoded.PubKeyHash)
 
 	for _, out := range UTXOs {
 		balance += out.Value
@@ -135,39 +245,116 @@ func (cli *CommandLine) getBalance(address, nodeID string) {
 	fmt.Printf("Balance of %s: %d\n", address, balance)
 }
 
+func (cli *CommandLine) getBalanceSPV(address, nodeID string) {
+	decoded, err := wallet.DecodeAddress(address)
+	if err != nil {
+		log.Panic(err)
+	}
+	if !blockchain.HeadersExist(nodeID) {
+		fmt.Println("No headers found, run startnode -spv first")
+		runtime.Goexit()
+	}
+	headers := blockchain.OpenHeaderChain(nodeID)
+	defer headers.Database.Close()
+
+	balance := 0
+	for _, out := range headers.UnspentOutputs(decoded.PubKeyHash) {
+		balance += out.Value
+		fmt.Printf("  %x:%d %d (%d confirmations)\n", out.TxID, out.Index, out.Value, out.Confirmations)
+	}
+
+	fmt.Printf("Balance of %s: %d (headers up to height %d)\n", address, balance, headers.GetBestHeight())
+}
+
+
+// spendableUTXOSet returns the UTXO set to build a transaction from. With
+// unconfirmed set, outputs of the central node's memory pool can be spent too.
+func spendableUTXOSet(chain *blockchain.BlockChain, unconfirmed bool) blockchain.UTXOSet {
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	if unconfirmed {
+		txs, err := network.RequestMempool(network.KnownNodes[0])
+		if err != nil {
+			log.Panic(err)
+		}
+		UTXOSet.Unconfirmed = txs
+	}
+
+	return UTXOSet
+}
+
+func (cli *CommandLine) send(from, to string, amount, fee int, nodeID string, mineNow, unconfirmed, replaceable, warnReuse bool) {
+	to = resolveAddress(to, nodeID)
+	cli.pay(resolveAddress(from, nodeID), []blockchain.Payout{{Address: to, Amount: amount}}, fee, nodeID, mineNow, unconfirmed, replaceable, warnReuse)
+
+	fmt.Println("Success!")
+}
+
+func (cli *CommandLine) sendMany(from, file string, fee int, nodeID string, mineNow, unconfirmed, replaceable, warnReuse bool) {
+	payouts, err := loadPayouts(file)
+	if err != nil {
+		log.Panic(err)
+	}
+	resolvePayouts(payouts, nodeID)
+	total, err := blockchain.ValidatePayouts(payouts)
+	if err != nil {
+		log.Panic(err)
+	}
+	cli.pay(resolveAddress(from, nodeID), payouts, fee, nodeID, mineNow, unconfirmed, replaceable, warnReuse)
+
+	fmt.Printf("Paid %d to %d addresses\n", total, len(payouts))
+	fmt.Println("Success!")
+}
 
-func (cli *CommandLine) send(from, to string, amount int, nodeID string, mineNow bool) {
-	if !wallet.ValidateAddress(to) {
-		log.Panic("Address is not Valid")
+// pay sends the payouts from from in one transaction, signed here or by the
+// running node when it holds the wallet file unlocked.
+func (cli *CommandLine) pay(from string, payouts []blockchain.Payout, fee int, nodeID string, mineNow, unconfirmed, replaceable, warnReuse bool) {
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
 	}
-	if !wallet.ValidateAddress(from) {
-		log.Panic("Address is not Valid")
+	if wallets.GetWallet(from).WatchOnly {
+		log.Panic("Cannot send from a watch-only address, use createpsbt and sign it where its key is")
 	}
+	if nodeCanSign(wallets, nodeID) {
+		sendWithNode(from, payouts, fee, nodeID, mineNow, replaceable, unconfirmed, warnReuse)
+		return
+	}
+
 	chain := blockchain.ContinueBlockChain(nodeID)
-	UTXOSet := blockchain.UTXOSet{chain}
+	UTXOSet := spendableUTXOSet(chain, unconfirmed)
 	defer chain.Database.Close()
 
-	wallets, err := wallet.CreateWallets(nodeID)
+	if warnReuse {
+		var addresses []string
+		for _, p := range payouts {
+			addresses = append(addresses, p.Address)
+		}
+		warnAddressReuse(&UTXOSet, addresses)
+	}
+	unlockWallets(wallets)
+	change, err := wallets.NewChangeAddress(from)
 	if err != nil {
 		log.Panic(err)
 	}
 	wallet := wallets.GetWallet(from)
 
-	tx := blockchain.NewTransaction(&wallet, to, amount, &UTXOSet)
+	tx, err := blockchain.NewMultiTransaction(&wallet, payouts, fee, change, replaceable, &UTXOSet)
+	if err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveFile(nodeID)
 	if mineNow {
-		cbTx := blockchain.CoinbaseTx(from, "")
+		cbTx := blockchain.CoinbaseTxWithFees(from, "", fee)
 		txs := []*blockchain.Transaction{cbTx, tx}
 		block := chain.MineBlock(txs)
 		UTXOSet.Update(block)
 	} else {
 		network.SendTx(network.KnownNodes[0], tx)
-		fmt.Println("send tx")
+		recordTransaction(chain, tx, nodeID)
+		fmt.Printf("send tx %x\n", tx.ID)
 	}
-
-	fmt.Println("Success!")
 }
 
-
 func (cli *CommandLine) Run() {
 	cli.validateArgs()
 
@@ -176,23 +363,118 @@ func (cli *CommandLine) Run() {
 		fmt.Printf("NODE_ID env is not set!")
 		runtime.Goexit()
 	}
+	if name := os.Getenv("NETWORK"); name != "" {
+		network, err := wallet.NetworkByName(name)
+		if err != nil {
+			log.Panic(err)
+		}
+		wallet.ActiveNetwork = network
+	}
 
 	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
 	createBlockchainCmd := flag.NewFlagSet("createblockchain", flag.ExitOnError)
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
+	sendManyCmd := flag.NewFlagSet("sendmany", flag.ExitOnError)
+	bumpFeeCmd := flag.NewFlagSet("bumpfee", flag.ExitOnError)
+	estimateFeeCmd := flag.NewFlagSet("estimatefee", flag.ExitOnError)
+	createPSBTCmd := flag.NewFlagSet("createpsbt", flag.ExitOnError)
+	signPSBTCmd := flag.NewFlagSet("signpsbt", flag.ExitOnError)
+	combinePSBTCmd := flag.NewFlagSet("combinepsbt", flag.ExitOnError)
+	finalizePSBTCmd := flag.NewFlagSet("finalizepsbt", flag.ExitOnError)
+	broadcastTxCmd := flag.NewFlagSet("broadcasttx", flag.ExitOnError)
+	getTxProofCmd := flag.NewFlagSet("gettxproof", flag.ExitOnError)
+	verifyTxProofCmd := flag.NewFlagSet("verifytxproof", flag.ExitOnError)
 	printChainCmd := flag.NewFlagSet("printchain", flag.ExitOnError)
 	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
+	restoreWalletCmd := flag.NewFlagSet("restorewallet", flag.ExitOnError)
+	encryptWalletCmd := flag.NewFlagSet("encryptwallet", flag.ExitOnError)
+	changePassphraseCmd := flag.NewFlagSet("changepassphrase", flag.ExitOnError)
+	unlockCmd := flag.NewFlagSet("unlock", flag.ExitOnError)
+	lockCmd := flag.NewFlagSet("lock", flag.ExitOnError)
+	dumpPrivKeyCmd := flag.NewFlagSet("dumpprivkey", flag.ExitOnError)
+	importPrivKeyCmd := flag.NewFlagSet("importprivkey", flag.ExitOnError)
+	signMessageCmd := flag.NewFlagSet("signmessage", flag.ExitOnError)
+	verifyMessageCmd := flag.NewFlagSet("verifymessage", flag.ExitOnError)
+	validateAddressCmd := flag.NewFlagSet("validateaddress", flag.ExitOnError)
+	dumpXPubCmd := flag.NewFlagSet("dumpxpub", flag.ExitOnError)
+	importWatchOnlyCmd := flag.NewFlagSet("importwatchonly", flag.ExitOnError)
 	listAddressesCmd := flag.NewFlagSet("listaddresses", flag.ExitOnError)
+	setLabelCmd := flag.NewFlagSet("setlabel", flag.ExitOnError)
+	addContactCmd := flag.NewFlagSet("addcontact", flag.ExitOnError)
+	removeContactCmd := flag.NewFlagSet("removecontact", flag.ExitOnError)
+	listContactsCmd := flag.NewFlagSet("listcontacts", flag.ExitOnError)
+	listUnspentCmd := flag.NewFlagSet("listunspent", flag.ExitOnError)
+	listTransactionsCmd := flag.NewFlagSet("listtransactions", flag.ExitOnError)
 	reindexUTXOCmd := flag.NewFlagSet("reindexutxo", flag.ExitOnError)
 	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
 
 	getBalanceAddress := getBalanceCmd.String("address", "", "The address to get balance for")
+	getBalanceSPV := getBalanceCmd.Bool("spv", false, "Use the light client's headers and proofs")
 	createBlockchainAddress := createBlockchainCmd.String("address", "", "The address to send genesis block reward to")
-	sendFrom := sendCmd.String("from", "", "Source wallet address")
-	sendTo := sendCmd.String("to", "", "Destination wallet address")
+	sendFrom := sendCmd.String("from", "", "Source wallet address or label")
+	sendTo := sendCmd.String("to", "", "Destination wallet address or label")
 	sendAmount := sendCmd.Int("amount", 0, "Amount to send")
+	sendFee := sendCmd.Int("fee", 0, "Fee to leave to the miner")
 	sendMine := sendCmd.Bool("mine", false, "Mine immediately on the same node")
+	sendUnconfirmed := sendCmd.Bool("unconfirmed", false, "Also spend outputs still in the memory pool")
+	sendRBF := sendCmd.Bool("rbf", false, "Allow the transaction to be replaced by one paying a higher fee")
+	sendWarnReuse := sendCmd.Bool("warnreuse", false, "Ask before paying an address that already received coins")
+	sendManyFrom := sendManyCmd.String("from", "", "Source wallet address or label")
+	sendManyFile := sendManyCmd.String("file", "", "JSON or CSV file of address or label and amount pairs")
+	sendManyFee := sendManyCmd.Int("fee", 0, "Fee to leave to the miner")
+	sendManyMine := sendManyCmd.Bool("mine", false, "Mine immediately on the same node")
+	sendManyUnconfirmed := sendManyCmd.Bool("unconfirmed", false, "Also spend outputs still in the memory pool")
+	sendManyRBF := sendManyCmd.Bool("rbf", false, "Allow the transaction to be replaced by one paying a higher fee")
+	sendManyWarnReuse := sendManyCmd.Bool("warnreuse", false, "Ask before paying an address that already received coins")
+	bumpFeeTxID := bumpFeeCmd.String("txid", "", "Hex ID of the unconfirmed transaction to replace")
+	bumpFeeFee := bumpFeeCmd.Int("fee", 0, "New fee to leave to the miner")
+	estimateFeeBlocks := estimateFeeCmd.Int("blocks", 6, "Number of blocks to confirm within")
+	createPSBTFrom := createPSBTCmd.String("from", "", "Source wallet address")
+	createPSBTTo := createPSBTCmd.String("to", "", "Destination wallet address")
+	createPSBTAmount := createPSBTCmd.Int("amount", 0, "Amount to send")
+	createPSBTFee := createPSBTCmd.Int("fee", 0, "Fee to leave to the miner")
+	createPSBTOut := createPSBTCmd.String("out", "", "File to write the partial transaction to")
+	signPSBTIn := signPSBTCmd.String("in", "", "Partial transaction file to sign")
+	signPSBTOut := signPSBTCmd.String("out", "", "File to write the signed partial transaction to")
+	signPSBTSigHash := signPSBTCmd.String("sighash", "ALL", "Signature hash type: ALL, NONE or SINGLE, optionally |ANYONECANPAY")
+	combinePSBTIn := combinePSBTCmd.String("in", "", "Comma separated partial transaction files")
+	combinePSBTOut := combinePSBTCmd.String("out", "", "File to write the combined partial transaction to")
+	finalizePSBTIn := finalizePSBTCmd.String("in", "", "Fully signed partial transaction file")
+	finalizePSBTOut := finalizePSBTCmd.String("out", "", "File to write the raw transaction to")
+	broadcastTxIn := broadcastTxCmd.String("in", "", "Raw transaction file")
+	getTxProofTxID := getTxProofCmd.String("txid", "", "Hex ID of the transaction to prove")
+	verifyTxProofProof := verifyTxProofCmd.String("proof", "", "Hex proof printed by gettxproof")
+	verifyTxProofRoot := verifyTxProofCmd.String("root", "", "Hex Merkle root to check against instead of our chain")
+	createWalletType := createWalletCmd.String("type", "p256", "Key type of the new wallet: p256 or ed25519")
+	createWalletAccount := createWalletCmd.Uint("account", 0, "HD account to derive the address in")
+	createWalletMnemonic := createWalletCmd.Bool("mnemonic", false, "Create the wallet seed from a new recovery phrase")
+	createWalletPassphrase := createWalletCmd.String("passphrase", "", "Optional passphrase protecting the recovery phrase")
+	createWalletLabel := createWalletCmd.String("label", "", "Label of the new address")
+	listAddressesLabel := listAddressesCmd.String("label", "", "Only list addresses whose label contains this text")
+	setLabelAddress := setLabelCmd.String("address", "", "Address in our wallet file to label")
+	setLabelLabel := setLabelCmd.String("label", "", "New label, empty to remove it")
+	addContactLabel := addContactCmd.String("label", "", "Label of the contact")
+	addContactAddress := addContactCmd.String("address", "", "Address of the contact")
+	removeContactLabel := removeContactCmd.String("label", "", "Label of the contact to remove")
+	restoreWalletMnemonic := restoreWalletCmd.String("mnemonic", "", "Recovery phrase of the wallet")
+	restoreWalletPassphrase := restoreWalletCmd.String("passphrase", "", "Passphrase given when the recovery phrase was created")
+	unlockTimeout := unlockCmd.Int("timeout", 0, "Seconds until the node locks the wallet file again, 0 for never")
+	dumpPrivKeyAddress := dumpPrivKeyCmd.String("address", "", "Address whose private key to print")
+	dumpPrivKeyPEM := dumpPrivKeyCmd.Bool("pem", false, "Print the key as a PKCS #8 PEM block")
+	importPrivKeyKey := importPrivKeyCmd.String("key", "", "Private key printed by dumpprivkey")
+	importPrivKeyPEM := importPrivKeyCmd.String("pem", "", "PEM file holding a P-256 or Ed25519 private key")
+	signMessageAddress := signMessageCmd.String("address", "", "Address whose key signs the message")
+	signMessageMessage := signMessageCmd.String("message", "", "Message to sign")
+	verifyMessageAddress := verifyMessageCmd.String("address", "", "Address that signed the message")
+	verifyMessageSignature := verifyMessageCmd.String("signature", "", "Signature printed by signmessage")
+	verifyMessageMessage := verifyMessageCmd.String("message", "", "Message that was signed")
+	validateAddressAddress := validateAddressCmd.String("address", "", "Address to check")
+	dumpXPubAccount := dumpXPubCmd.Uint("account", 0, "HD account whose extended public key to print")
+	importWatchOnlyAddress := importWatchOnlyCmd.String("address", "", "Address to watch")
+	importWatchOnlyPubKey := importWatchOnlyCmd.String("pubkey", "", "Hex public key to watch")
+	importWatchOnlyXPub := importWatchOnlyCmd.String("xpub", "", "Extended public key whose addresses to watch")
 	startNodeMiner := startNodeCmd.String("miner", "", "Enable mining mode and send reward to ADDRESS")
+	startNodeSPV := startNodeCmd.Bool("spv", false, "Run a light client that syncs headers only")
 
 	switch os.Args[1] {
 	case "reindexutxo":
@@ -215,6 +497,36 @@ func (cli *CommandLine) Run() {
 		if err != nil {
 			log.Panic(err)
 		}
+	case "listunspent":
+		err := listUnspentCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "listtransactions":
+		err := listTransactionsCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "setlabel":
+		err := setLabelCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "addcontact":
+		err := addContactCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "removecontact":
+		err := removeContactCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "listcontacts":
+		err := listContactsCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "listaddresses":
 		err := listAddressesCmd.Parse(os.Args[2:])
 		if err != nil {
@@ -225,6 +537,66 @@ func (cli *CommandLine) Run() {
 		if err != nil {
 			log.Panic(err)
 		}
+	case "restorewallet":
+		err := restoreWalletCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "encryptwallet":
+		err := encryptWalletCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "changepassphrase":
+		err := changePassphraseCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "unlock":
+		err := unlockCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "lock":
+		err := lockCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "dumpprivkey":
+		err := dumpPrivKeyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "importprivkey":
+		err := importPrivKeyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "signmessage":
+		err := signMessageCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "verifymessage":
+		err := verifyMessageCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "validateaddress":
+		err := validateAddressCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "dumpxpub":
+		err := dumpXPubCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "importwatchonly":
+		err := importWatchOnlyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "printchain":
 		err := printChainCmd.Parse(os.Args[2:])
 		if err != nil {
@@ -235,17 +607,72 @@ func (cli *CommandLine) Run() {
 		if err != nil {
 			log.Panic(err)
 		}
+	case "sendmany":
+		err := sendManyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "bumpfee":
+		err := bumpFeeCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "estimatefee":
+		err := estimateFeeCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "createpsbt":
+		err := createPSBTCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "signpsbt":
+		err := signPSBTCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "combinepsbt":
+		err := combinePSBTCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "finalizepsbt":
+		err := finalizePSBTCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "broadcasttx":
+		err := broadcastTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "gettxproof":
+		err := getTxProofCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "verifytxproof":
+		err := verifyTxProofCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	default:
 		cli.printUsage()
 		runtime.Goexit()
 	}
 
 	if getBalanceCmd.Parsed() {
-		if *getBalanceAddress == "" {
-			getBalanceCmd.Usage()
-			runtime.Goexit()
+		switch {
+		case *getBalanceAddress == "" && *getBalanceSPV:
+			cli.getWalletBalanceSPV(nodeID)
+		case *getBalanceAddress == "":
+			cli.getWalletBalance(nodeID)
+		case *getBalanceSPV:
+			cli.getBalanceSPV(*getBalanceAddress, nodeID)
+		default:
+			cli.getBalance(*getBalanceAddress, nodeID)
 		}
-		cli.getBalance(*getBalanceAddress, nodeID)
 	}
 
 	if createBlockchainCmd.Parsed() {
@@ -261,22 +688,224 @@ func (cli *CommandLine) Run() {
 	}
 
 	if createWalletCmd.Parsed() {
-		cli.createWallet(nodeID)
+		if *createWalletAccount >= uint(wallet.HardenedKeyStart) {
+			createWalletCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.createWallet(*createWalletType, *createWalletAccount, *createWalletMnemonic, *createWalletPassphrase, *createWalletLabel, nodeID)
+	}
+	if restoreWalletCmd.Parsed() {
+		if *restoreWalletMnemonic == "" {
+			restoreWalletCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.restoreWallet(*restoreWalletMnemonic, *restoreWalletPassphrase, nodeID)
+	}
+	if encryptWalletCmd.Parsed() {
+		cli.encryptWallet(nodeID)
+	}
+	if changePassphraseCmd.Parsed() {
+		cli.changePassphrase(nodeID)
+	}
+	if unlockCmd.Parsed() {
+		if *unlockTimeout < 0 {
+			unlockCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.unlockNode(time.Duration(*unlockTimeout)*time.Second, nodeID)
+	}
+	if lockCmd.Parsed() {
+		cli.lockNode(nodeID)
+	}
+	if dumpPrivKeyCmd.Parsed() {
+		if *dumpPrivKeyAddress == "" {
+			dumpPrivKeyCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.dumpPrivKey(*dumpPrivKeyAddress, *dumpPrivKeyPEM, nodeID)
+	}
+	if importPrivKeyCmd.Parsed() {
+		if (*importPrivKeyKey == "") == (*importPrivKeyPEM == "") {
+			importPrivKeyCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.importPrivKey(*importPrivKeyKey, *importPrivKeyPEM, nodeID)
+	}
+	if signMessageCmd.Parsed() {
+		if *signMessageAddress == "" {
+			signMessageCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.signMessage(*signMessageAddress, *signMessageMessage, nodeID)
+	}
+	if verifyMessageCmd.Parsed() {
+		if *verifyMessageAddress == "" || *verifyMessageSignature == "" {
+			verifyMessageCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.verifyMessage(*verifyMessageAddress, *verifyMessageSignature, *verifyMessageMessage)
+	}
+	if validateAddressCmd.Parsed() {
+		if *validateAddressAddress == "" {
+			validateAddressCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.validateAddress(*validateAddressAddress)
+	}
+	if dumpXPubCmd.Parsed() {
+		if *dumpXPubAccount >= uint(wallet.HardenedKeyStart) {
+			dumpXPubCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.dumpXPub(*dumpXPubAccount, nodeID)
+	}
+	if importWatchOnlyCmd.Parsed() {
+		given := 0
+		for _, value := range []string{*importWatchOnlyAddress, *importWatchOnlyPubKey, *importWatchOnlyXPub} {
+			if value != "" {
+				given++
+			}
+		}
+		if given != 1 {
+			importWatchOnlyCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.importWatchOnly(*importWatchOnlyAddress, *importWatchOnlyPubKey, *importWatchOnlyXPub, nodeID)
 	}
 	if listAddressesCmd.Parsed() {
-		cli.listAddresses(nodeID)
+		cli.listAddresses(*listAddressesLabel, nodeID)
+	}
+	if setLabelCmd.Parsed() {
+		if *setLabelAddress == "" {
+			setLabelCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.setLabel(*setLabelAddress, *setLabelLabel, nodeID)
+	}
+	if addContactCmd.Parsed() {
+		if *addContactLabel == "" || *addContactAddress == "" {
+			addContactCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.addContact(*addContactLabel, *addContactAddress, nodeID)
+	}
+	if removeContactCmd.Parsed() {
+		if *removeContactLabel == "" {
+			removeContactCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.removeContact(*removeContactLabel, nodeID)
+	}
+	if listContactsCmd.Parsed() {
+		cli.listContacts(nodeID)
+	}
+	if listUnspentCmd.Parsed() {
+		cli.listUnspent(nodeID)
+	}
+	if listTransactionsCmd.Parsed() {
+		cli.listTransactions(nodeID)
 	}
 	if reindexUTXOCmd.Parsed() {
 		cli.reindexUTXO(nodeID)
 	}
 
 	if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 {
+		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 || (*sendMine && *sendUnconfirmed) {
 			sendCmd.Usage()
 			runtime.Goexit()
 		}
 
-		cli.send(*sendFrom, *sendTo, *sendAmount, nodeID, *sendMine)
+		cli.send(*sendFrom, *sendTo, *sendAmount, *sendFee, nodeID, *sendMine, *sendUnconfirmed, *sendRBF, *sendWarnReuse)
+	}
+
+	if sendManyCmd.Parsed() {
+		if *sendManyFrom == "" || *sendManyFile == "" || (*sendManyMine && *sendManyUnconfirmed) {
+			sendManyCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.sendMany(*sendManyFrom, *sendManyFile, *sendManyFee, nodeID, *sendManyMine, *sendManyUnconfirmed, *sendManyRBF, *sendManyWarnReuse)
+	}
+
+	if bumpFeeCmd.Parsed() {
+		if *bumpFeeTxID == "" || *bumpFeeFee <= 0 {
+			bumpFeeCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.bumpFee(*bumpFeeTxID, *bumpFeeFee, nodeID)
+	}
+
+	if estimateFeeCmd.Parsed() {
+		if *estimateFeeBlocks <= 0 {
+			estimateFeeCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.estimateFee(*estimateFeeBlocks)
+	}
+
+	if createPSBTCmd.Parsed() {
+		if *createPSBTFrom == "" || *createPSBTTo == "" || *createPSBTAmount <= 0 || *createPSBTOut == "" {
+			createPSBTCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.createPSBT(*createPSBTFrom, *createPSBTTo, *createPSBTAmount, *createPSBTFee, *createPSBTOut, nodeID)
+	}
+
+	if signPSBTCmd.Parsed() {
+		if *signPSBTIn == "" || *signPSBTOut == "" {
+			signPSBTCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.signPSBT(*signPSBTIn, *signPSBTOut, *signPSBTSigHash, nodeID)
+	}
+
+	if combinePSBTCmd.Parsed() {
+		if *combinePSBTIn == "" || *combinePSBTOut == "" {
+			combinePSBTCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.combinePSBT(strings.Split(*combinePSBTIn, ","), *combinePSBTOut)
+	}
+
+	if finalizePSBTCmd.Parsed() {
+		if *finalizePSBTIn == "" || *finalizePSBTOut == "" {
+			finalizePSBTCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.finalizePSBT(*finalizePSBTIn, *finalizePSBTOut)
+	}
+
+	if broadcastTxCmd.Parsed() {
+		if *broadcastTxIn == "" {
+			broadcastTxCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.broadcastTx(*broadcastTxIn)
+	}
+
+	if getTxProofCmd.Parsed() {
+		if *getTxProofTxID == "" {
+			getTxProofCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.getTxProof(*getTxProofTxID, nodeID)
+	}
+
+	if verifyTxProofCmd.Parsed() {
+		if *verifyTxProofProof == "" {
+			verifyTxProofCmd.Usage()
+			runtime.Goexit()
+		}
+
+		cli.verifyTxProof(*verifyTxProofProof, *verifyTxProofRoot, nodeID)
 	}
 
 	if startNodeCmd.Parsed() {
@@ -285,6 +914,13 @@ func (cli *CommandLine) Run() {
 			startNodeCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.StartNode(nodeID, *startNodeMiner)
+		if *startNodeSPV {
+			if *startNodeMiner != "" {
+				log.Panic("A light client cannot mine")
+			}
+			cli.StartSPVNode(nodeID)
+		} else {
+			cli.StartNode(nodeID, *startNodeMiner)
+		}
 	}
 }
\ No newline at end of file
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+	"github.com/mapfumo/golang-blockchain/network"
+	"github.com/mapfumo/golang-blockchain/wallet"
+)
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// readLine prompts for a line of input, such as a passphrase, on standard
+// input.
+func readLine(prompt string) string {
+	fmt.Print(prompt)
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		log.Panic(err)
+	}
+
+	return strings.TrimRight(line, "\r\n")
+}
+
+// unlockWallets asks for the passphrase of an encrypted wallet file so its
+// private keys can be used. It does nothing to a plaintext one.
+func unlockWallets(wallets *wallet.Wallets) {
+	if !wallets.IsLocked() {
+		return
+	}
+	if err := wallets.Unlock(readLine("Wallet passphrase: "), 0); err != nil {
+		log.Panic(err)
+	}
+}
+
+// nodeCanSign reports whether the wallet file is locked here but the running
+// node holds it unlocked, so the node can sign instead of the passphrase
+// being asked for.
+func nodeCanSign(wallets *wallet.Wallets, nodeID string) bool {
+	if !wallets.IsLocked() {
+		return false
+	}
+	unlocked, _, err := network.RequestWalletStatus(nodeID)
+
+	return err == nil && unlocked
+}
+
+// sendWithNode has the running node, which holds the chain and the unlocked
+// wallet file, pay the payouts from from and relay the transaction.
+func sendWithNode(from string, payouts []blockchain.Payout, fee int, nodeID string, mineNow, replaceable, unconfirmed, warnReuse bool) {
+	if mineNow || warnReuse {
+		log.Panic("-mine and -warnreuse need the chain, which the running node holds")
+	}
+
+	txID, err := network.RequestSendPayment(nodeID, from, payouts, fee, replaceable, unconfirmed)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("send tx %x\n", txID)
+}
+
+// unlockNode unlocks the wallet file in the running node, so commands can
+// have it sign without asking for the passphrase until timeout passes.
+func (cli *CommandLine) unlockNode(timeout time.Duration, nodeID string) {
+	until, err := network.RequestUnlock(nodeID, readLine("Wallet passphrase: "), timeout)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if until.IsZero() {
+		fmt.Println("Wallet unlocked in the node until it is locked")
+	} else {
+		fmt.Printf("Wallet unlocked in the node until %s\n", until.Format("2006-01-02 15:04:05"))
+	}
+}
+
+func (cli *CommandLine) lockNode(nodeID string) {
+	if err := network.RequestLock(nodeID); err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Println("Wallet locked in the node")
+}
+
+func (cli *CommandLine) encryptWallet(nodeID string) {
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	passphrase := readLine("New wallet passphrase: ")
+	if readLine("Repeat passphrase: ") != passphrase {
+		log.Panic("Passphrases do not match")
+	}
+	if err := wallets.Encrypt(passphrase); err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveFile(nodeID)
+
+	fmt.Println("Wallet file encrypted, keep the passphrase safe: it cannot be recovered")
+}
+
+func (cli *CommandLine) changePassphrase(nodeID string) {
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	if !wallets.IsEncrypted() {
+		log.Panic(wallet.ErrNotEncrypted)
+	}
+
+	old := readLine("Current wallet passphrase: ")
+	passphrase := readLine("New wallet passphrase: ")
+	if readLine("Repeat passphrase: ") != passphrase {
+		log.Panic("Passphrases do not match")
+	}
+	if err := wallets.ChangePassphrase(old, passphrase); err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveFile(nodeID)
+
+	fmt.Println("Passphrase changed")
+}
@@ -0,0 +1,19 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/mapfumo/golang-blockchain/network"
+)
+
+// estimateFee asks the central node, which has watched transactions confirm,
+// for the fee rate needed to confirm within blocks.
+func (cli *CommandLine) estimateFee(blocks int) {
+	feeRate, err := network.RequestFeeEstimate(network.KnownNodes[0], blocks)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Fee rate to confirm within %d blocks: %d per 1000 bytes\n", blocks, feeRate)
+}
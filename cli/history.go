@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+	"github.com/mapfumo/golang-blockchain/mempool"
+	"github.com/mapfumo/golang-blockchain/wallet"
+	"github.com/mapfumo/golang-blockchain/walletdb"
+)
+
+// openWalletDB opens the wallet database of our wallet file and catches it
+// up with the chain. It also returns the addresses by hex key hash.
+func openWalletDB(chain *blockchain.BlockChain, nodeID string) (*walletdb.DB, map[string]string) {
+	wallets, _ := wallet.CreateWallets(nodeID)
+	db, err := walletdb.Open(nodeID, walletdb.WalletKeys(wallets))
+	if err != nil {
+		log.Panic(err)
+	}
+	db.Sync(chain)
+	db.Expire(time.Now(), mempool.DefaultExpiry)
+
+	addresses := make(map[string]string)
+	for address, w := range wallets.Wallets {
+		addresses[hex.EncodeToString(w.KeyHash())] = address
+	}
+
+	return db, addresses
+}
+
+// rescanWalletDB has the wallet database rescan the chain the next time it
+// is opened, for addresses we added that may already have been paid.
+func rescanWalletDB(nodeID string) {
+	wallets, _ := wallet.CreateWallets(nodeID)
+	db, err := walletdb.Open(nodeID, walletdb.WalletKeys(wallets))
+	if err != nil {
+		log.Panic(err)
+	}
+	db.Rescan()
+	if err := db.Save(); err != nil {
+		log.Panic(err)
+	}
+}
+
+// recordTransaction adds a transaction we sent to the wallet database, so
+// it is pending until a block confirms it.
+func recordTransaction(chain *blockchain.BlockChain, tx *blockchain.Transaction, nodeID string) {
+	db, _ := openWalletDB(chain, nodeID)
+	db.AddTransaction(tx)
+	if err := db.Save(); err != nil {
+		log.Panic(err)
+	}
+}
+
+// getWalletBalance prints the balance of our wallet file from its
+// database, split by whether it can be spent yet.
+func (cli *CommandLine) getWalletBalance(nodeID string) {
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+
+	db, _ := openWalletDB(chain, nodeID)
+	if err := db.Save(); err != nil {
+		log.Panic(err)
+	}
+
+	balance := db.Balance(false)
+	fmt.Printf("Confirmed balance: %d\n", balance.Confirmed)
+	fmt.Printf("Unconfirmed balance: %d\n", balance.Unconfirmed)
+	fmt.Printf("Immature balance: %d\n", balance.Immature)
+
+	watched := db.Balance(true)
+	if watched != (walletdb.Balance{}) {
+		fmt.Printf("Watch-only balance: %d confirmed, %d unconfirmed, %d immature\n", watched.Confirmed, watched.Unconfirmed, watched.Immature)
+	}
+}
+
+func (cli *CommandLine) listUnspent(nodeID string) {
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+
+	db, addresses := openWalletDB(chain, nodeID)
+	if err := db.Save(); err != nil {
+		log.Panic(err)
+	}
+
+	for _, out := range db.Unspent() {
+		address := addresses[hex.EncodeToString(out.PubKeyHash)]
+		line := fmt.Sprintf("%x:%d %s %d, %d confirmations", out.TxID, out.Index, address, out.Value, db.Confirmations(out.Height))
+		if !db.IsMature(out) {
+			line += ", immature"
+		}
+		if out.Change {
+			line += ", change"
+		}
+		if db.Keys[hex.EncodeToString(out.PubKeyHash)].WatchOnly {
+			line += ", watch-only"
+		}
+		fmt.Println(line)
+	}
+}
+
+func (cli *CommandLine) listTransactions(nodeID string) {
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+
+	db, _ := openWalletDB(chain, nodeID)
+	if err := db.Save(); err != nil {
+		log.Panic(err)
+	}
+
+	for _, record := range db.History() {
+		status := "pending"
+		if record.Height != walletdb.Unconfirmed {
+			status = fmt.Sprintf("%d confirmations", db.Confirmations(record.Height))
+		}
+		fmt.Printf("%x received %d, change %d, sent %d, net %+d, %s\n", record.Tx.ID, record.Received, record.Change, record.Sent, record.Net(), status)
+	}
+}
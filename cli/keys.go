@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/mapfumo/golang-blockchain/wallet"
+)
+
+// dumpPrivKey prints the private key of an address in our wallet file, as
+// text for importprivkey or as a PKCS #8 PEM block for other tools.
+func (cli *CommandLine) dumpPrivKey(address string, asPEM bool, nodeID string) {
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	if _, ok := wallets.Lookup(address); !ok {
+		log.Panic("Address is not in our wallet file")
+	}
+	unlockWallets(wallets)
+	w := wallets.GetWallet(address)
+
+	if asPEM {
+		data, err := wallet.MarshalPrivateKeyPEM(&w)
+		if err != nil {
+			log.Panic(err)
+		}
+		fmt.Print(string(data))
+		return
+	}
+
+	key, err := wallet.ExportPrivateKey(&w)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Println(key)
+}
+
+// importPrivKey adds a private key, given as text or read from a PEM file,
+// to our wallet file.
+func (cli *CommandLine) importPrivKey(key, file, nodeID string) {
+	var w *wallet.Wallet
+	var err error
+	if file != "" {
+		var data []byte
+		data, err = os.ReadFile(file)
+		if err != nil {
+			log.Panic(err)
+		}
+		w, err = wallet.ParsePrivateKeyPEM(data)
+	} else {
+		w, err = wallet.ImportPrivateKey(key)
+	}
+	if err != nil {
+		log.Panic(err)
+	}
+
+	wallets, _ := wallet.CreateWallets(nodeID)
+	unlockWallets(wallets)
+	address, err := wallets.ImportWallet(w)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Imported address is: %s\n", address)
+
+	// A PEM block cannot tell whether a P-256 key came from a wallet made
+	// before key types existed, so its legacy address is imported as well.
+	if file != "" && w.KeyType == wallet.KeyTypeP256 {
+		legacy, err := wallet.LegacyP256Wallet(w)
+		if err != nil {
+			log.Panic(err)
+		}
+		if address, err := wallets.ImportWallet(legacy); err == nil {
+			fmt.Printf("Imported legacy address is: %s\n", address)
+		}
+	}
+	wallets.SaveFile(nodeID)
+	rescanWalletDB(nodeID)
+}
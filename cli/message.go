@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/mapfumo/golang-blockchain/wallet"
+)
+
+// signMessage prints a signature of message by the key of an address in our
+// wallet file, proving we control the address.
+func (cli *CommandLine) signMessage(address, message, nodeID string) {
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	if _, ok := wallets.Lookup(address); !ok {
+		log.Panic("Address is not in our wallet file")
+	}
+	unlockWallets(wallets)
+	w := wallets.GetWallet(address)
+
+	sig, err := w.SignMessage(message)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Println(sig)
+}
+
+// verifyMessage checks a signature made by signmessage against the address
+// alone.
+func (cli *CommandLine) verifyMessage(address, signature, message string) {
+	ok, err := wallet.VerifyMessage(address, signature, message)
+	if err != nil {
+		log.Panic(err)
+	}
+	if ok {
+		fmt.Println("Signature is valid")
+	} else {
+		fmt.Println("Signature is not valid")
+	}
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+)
+
+// loadPayouts reads a list of payouts from a JSON or CSV file.
+//
+// JSON files hold an array of {"address": ..., "amount": ...} objects.
+// CSV files hold one "address,amount" record per line with an optional
+// "address,amount" header.
+func loadPayouts(path string) ([]blockchain.Payout, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return parseJSONPayouts(data)
+	case ".csv":
+		return parseCSVPayouts(data)
+	}
+
+	// Fall back to sniffing the content for files without a known extension.
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		return parseJSONPayouts(data)
+	}
+
+	return parseCSVPayouts(data)
+}
+
+func parseJSONPayouts(data []byte) ([]blockchain.Payout, error) {
+	var payouts []blockchain.Payout
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payouts); err != nil {
+		return nil, fmt.Errorf("parsing JSON payouts: %w", err)
+	}
+
+	return payouts, nil
+}
+
+func parseCSVPayouts(data []byte) ([]blockchain.Payout, error) {
+	var payouts []blockchain.Payout
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing CSV payouts: %w", err)
+		}
+
+		if line == 1 && strings.EqualFold(record[0], "address") {
+			continue
+		}
+
+		amount, err := strconv.Atoi(strings.TrimSpace(record[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid amount %q", line, record[1])
+		}
+
+		payouts = append(payouts, blockchain.Payout{
+			Address: strings.TrimSpace(record[0]),
+			Amount:  amount,
+		})
+	}
+
+	return payouts, nil
+}
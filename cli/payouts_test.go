@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+)
+
+func TestLoadPayouts(t *testing.T) {
+	want := []blockchain.Payout{{Address: "alice", Amount: 5}, {Address: "bob", Amount: 7}}
+
+	for name, content := range map[string]string{
+		"payouts.json": `[{"address": "alice", "amount": 5}, {"address": "bob", "amount": 7}]`,
+		"payouts.csv":  "address,amount\nalice, 5\n\nbob,7\n",
+		"headless.csv": "alice,5\nbob, 7",
+		"sniffed.txt":  "  [{\"address\": \"alice\", \"amount\": 5},\n{\"address\": \"bob\", \"amount\": 7}]",
+		"sniffed":      "\nalice,5\n\n\nbob,7\n",
+	} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		payouts, err := loadPayouts(path)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if !reflect.DeepEqual(payouts, want) {
+			t.Errorf("%s: got %v", name, payouts)
+		}
+	}
+}
+
+func TestParsePayoutsRejectsBadInput(t *testing.T) {
+	for name, content := range map[string]string{
+		"amount":        "alice,5\nbob,seven\n",
+		"decimal":       "alice,5.5\n",
+		"missing field": "alice\n",
+		"extra field":   "alice,5,bob\n",
+		"late header":   "alice,5\naddress,amount\n",
+	} {
+		if _, err := parseCSVPayouts([]byte(content)); err == nil {
+			t.Errorf("CSV %s: expected an error", name)
+		}
+	}
+
+	for name, content := range map[string]string{
+		"amount":        `[{"address": "alice", "amount": "5"}]`,
+		"unknown field": `[{"address": "alice", "amount": 5, "memo": "rent"}]`,
+		"not an array":  `{"address": "alice", "amount": 5}`,
+	} {
+		if _, err := parseJSONPayouts([]byte(content)); err == nil {
+			t.Errorf("JSON %s: expected an error", name)
+		}
+	}
+}
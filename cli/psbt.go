@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+	"github.com/mapfumo/golang-blockchain/network"
+	"github.com/mapfumo/golang-blockchain/wallet"
+)
+
+func readPartialTransaction(path string) *blockchain.PartialTransaction {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	ptx, err := blockchain.DecodePartialTransaction(strings.TrimSpace(string(data)))
+	if err != nil {
+		log.Panic(fmt.Errorf("%s: %w", path, err))
+	}
+
+	return ptx
+}
+
+func writePartialTransaction(path string, ptx *blockchain.PartialTransaction) {
+	err := os.WriteFile(path, []byte(ptx.Encode()+"\n"), 0644)
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+func (cli *CommandLine) createPSBT(from, to string, amount, fee int, out, nodeID string) {
+	chain := blockchain.ContinueBlockChain(nodeID)
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	defer chain.Database.Close()
+
+	payouts := []blockchain.Payout{{Address: to, Amount: amount}}
+	ptx, err := blockchain.NewPartialTransaction(from, payouts, fee, &UTXOSet)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	writePartialTransaction(out, ptx)
+	fmt.Printf("Partial transaction with %d inputs written to %s\n", len(ptx.Tx.Inputs), out)
+}
+
+func (cli *CommandLine) signPSBT(in, out, sigHash, nodeID string) {
+	ptx := readPartialTransaction(in)
+
+	hashType, err := blockchain.ParseSigHashType(sigHash)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	if nodeCanSign(wallets, nodeID) {
+		signed, n, err := network.RequestSignTx(nodeID, ptx, hashType)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		writePartialTransaction(out, signed)
+		fmt.Printf("Node signed %d of %d inputs, complete: %t\n", n, len(signed.Tx.Inputs), signed.IsComplete())
+		return
+	}
+	unlockWallets(wallets)
+
+	signed := 0
+	for _, address := range wallets.GetAllAddresses() {
+		w := wallets.GetWallet(address)
+		if w.WatchOnly {
+			for _, prevOut := range ptx.PrevOutputs {
+				if prevOut.IsLockedWithKey(w.KeyHash()) {
+					fmt.Printf("Not signing for %s: %v\n", address, wallet.ErrWatchOnly)
+					break
+				}
+			}
+			continue
+		}
+		n, err := ptx.Sign(&w, hashType)
+		if err != nil {
+			log.Panic(err)
+		}
+		signed += n
+	}
+
+	writePartialTransaction(out, ptx)
+	fmt.Printf("Signed %d of %d inputs, complete: %t\n", signed, len(ptx.Tx.Inputs), ptx.IsComplete())
+}
+
+func (cli *CommandLine) combinePSBT(ins []string, out string) {
+	ptx := readPartialTransaction(ins[0])
+
+	for _, in := range ins[1:] {
+		if err := ptx.Combine(readPartialTransaction(in)); err != nil {
+			log.Panic(fmt.Errorf("%s: %w", in, err))
+		}
+	}
+
+	writePartialTransaction(out, ptx)
+	fmt.Printf("Combined %d partial transactions, complete: %t\n", len(ins), ptx.IsComplete())
+}
+
+func (cli *CommandLine) finalizePSBT(in, out string) {
+	ptx := readPartialTransaction(in)
+
+	tx, err := ptx.Finalize()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	err = os.WriteFile(out, []byte(hex.EncodeToString(tx.Serialize())+"\n"), 0644)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Transaction %x written to %s\n", tx.ID, out)
+}
+
+func (cli *CommandLine) broadcastTx(in string) {
+	data, err := os.ReadFile(in)
+	if err != nil {
+		log.Panic(err)
+	}
+	raw, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		log.Panic(err)
+	}
+
+	tx := blockchain.DeserializeTransaction(raw)
+	network.SendTx(network.KnownNodes[0], &tx)
+	fmt.Printf("send tx %x\n", tx.ID)
+}
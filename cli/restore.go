@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+	"github.com/mapfumo/golang-blockchain/wallet"
+)
+
+// restoreWallet sets the wallet seed from a recovery phrase and finds the
+// addresses of the seed that received coins in our chain.
+func (cli *CommandLine) restoreWallet(mnemonic, passphrase, nodeID string) {
+	seed, err := wallet.MnemonicSeed(mnemonic, passphrase)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	wallets, _ := wallet.CreateWallets(nodeID)
+	unlockWallets(wallets)
+	if err := wallets.SetSeed(seed); err != nil {
+		log.Panic(err)
+	}
+
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+
+	used := chain.FindUsedPubKeyHashes()
+	found, err := wallets.Restore(wallet.DefaultGapLimit, func(pubKeyHash []byte) bool {
+		return used[hex.EncodeToString(pubKeyHash)]
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	if found == 0 {
+		if _, err := wallets.DeriveAddress(0, wallet.ExternalChain); err != nil {
+			log.Panic(err)
+		}
+	}
+	wallets.SaveFile(nodeID)
+	rescanWalletDB(nodeID)
+
+	fmt.Printf("Found %d used addresses\n", found)
+	total := 0
+	for address, w := range wallets.Wallets {
+		if w.Path == "" {
+			continue
+		}
+		balance := 0
+		for _, out := range UTXOSet.FindUnspentTransactions(wallet.PublicKeyHash(w.PublicKey)) {
+			balance += out.Value
+		}
+		total += balance
+		fmt.Printf("%s %s: %d\n", address, w.Path, balance)
+	}
+	fmt.Printf("Total balance: %d\n", total)
+}
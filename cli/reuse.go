@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+	"github.com/mapfumo/golang-blockchain/wallet"
+)
+
+// warnAddressReuse lists the addresses that already received coins in the
+// chain or in the memory pool of UTXOSet, and aborts unless the user still
+// wants to pay them. Paying an address again links its payments together.
+func warnAddressReuse(UTXOSet *blockchain.UTXOSet, addresses []string) {
+	used := UTXOSet.Blockchain.FindUsedPubKeyHashes()
+	for _, tx := range UTXOSet.Unconfirmed {
+		for _, out := range tx.Outputs {
+			used[hex.EncodeToString(out.PubKeyHash)] = true
+		}
+	}
+
+	reused := 0
+	for _, address := range addresses {
+		decoded, err := wallet.DecodeAddress(address)
+		if err != nil {
+			log.Panic(err)
+		}
+		if used[hex.EncodeToString(decoded.PubKeyHash)] {
+			fmt.Printf("Warning: %s has already received coins\n", address)
+			reused++
+		}
+	}
+	if reused == 0 {
+		return
+	}
+
+	if answer := readLine("Send anyway? [y/N] "); strings.ToLower(strings.TrimSpace(answer)) != "y" {
+		log.Panic("Aborted, ask the payee for a fresh address")
+	}
+}
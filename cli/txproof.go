@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+)
+
+func (cli *CommandLine) getTxProof(txID, nodeID string) {
+	id, err := hex.DecodeString(txID)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+
+	block, err := chain.FindTransactionBlock(id)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	proof, err := blockchain.NewTxProof(&block, id)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Block: %x (height %d)\n", proof.BlockHash, proof.Height)
+	fmt.Printf("Merkle root: %x\n", proof.MerkleRoot)
+	fmt.Printf("Index: %d, path length: %d\n", proof.Proof.Index, len(proof.Proof.Siblings))
+	fmt.Printf("Proof: %x\n", proof.Serialize())
+}
+
+func (cli *CommandLine) verifyTxProof(proofHex, rootHex, nodeID string) {
+	data, err := hex.DecodeString(proofHex)
+	if err != nil {
+		log.Panic(err)
+	}
+	proof, err := blockchain.DeserializeTxProof(data)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	// The root carried by the proof is only trusted once it matches a root
+	// given by the user or the block in our own chain.
+	var root []byte
+	if rootHex != "" {
+		root, err = hex.DecodeString(rootHex)
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		chain := blockchain.ContinueBlockChain(nodeID)
+		defer chain.Database.Close()
+
+		block, err := chain.GetBlock(proof.BlockHash)
+		if err != nil {
+			log.Panic(err)
+		}
+		root = block.HashTransactions()
+	}
+
+	valid := bytes.Equal(root, proof.MerkleRoot) && proof.Verify()
+	fmt.Printf("Transaction %x in block %x: valid=%t\n", proof.TxID, proof.BlockHash, valid)
+}
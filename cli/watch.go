@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"runtime"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+	"github.com/mapfumo/golang-blockchain/wallet"
+)
+
+// importWatchOnly adds an address, a public key or the addresses of an
+// extended public key to our wallet file without any private key.
+func (cli *CommandLine) importWatchOnly(address, pubKey, xpub, nodeID string) {
+	wallets, _ := wallet.CreateWallets(nodeID)
+
+	switch {
+	case address != "":
+		if _, err := wallets.ImportAddress(address); err != nil {
+			log.Panic(err)
+		}
+		fmt.Printf("Watching %s\n", address)
+	case pubKey != "":
+		key, err := hex.DecodeString(pubKey)
+		if err != nil {
+			log.Panic(err)
+		}
+		address, err := wallets.ImportPublicKey(key)
+		if err != nil {
+			log.Panic(err)
+		}
+		fmt.Printf("Watching %s\n", address)
+	default:
+		chain := blockchain.ContinueBlockChain(nodeID)
+		used := chain.FindUsedPubKeyHashes()
+		chain.Database.Close()
+
+		found, err := wallets.ImportExtendedKey(xpub, wallet.DefaultGapLimit, func(pubKeyHash []byte) bool {
+			return used[hex.EncodeToString(pubKeyHash)]
+		})
+		if err != nil {
+			log.Panic(err)
+		}
+		fmt.Printf("Watching extended key with %d used addresses\n", found)
+	}
+
+	wallets.SaveFile(nodeID)
+	rescanWalletDB(nodeID)
+}
+
+// dumpXPub prints the extended public key of an HD account, for
+// importwatchonly on a node that should not hold its private keys.
+func (cli *CommandLine) dumpXPub(account uint, nodeID string) {
+	wallets, _ := wallet.CreateWallets(nodeID)
+	known := len(wallets.Accounts)
+	acc, err := wallets.Account(uint32(account))
+	if err == wallet.ErrWalletLocked {
+		unlockWallets(wallets)
+		acc, err = wallets.Account(uint32(account))
+	}
+	if err != nil {
+		log.Panic(err)
+	}
+	if len(wallets.Accounts) > known {
+		wallets.SaveFile(nodeID)
+	}
+
+	fmt.Println(acc.XPub)
+}
+
+// getWalletBalanceSPV prints the balance of every address in our wallet
+// file, watch-only ones included, and their total from the light client's
+// proofs.
+func (cli *CommandLine) getWalletBalanceSPV(nodeID string) {
+	wallets, _ := wallet.CreateWallets(nodeID)
+	addresses := wallets.GetAllAddresses()
+
+	if !blockchain.HeadersExist(nodeID) {
+		fmt.Println("No headers found, run startnode -spv first")
+		runtime.Goexit()
+	}
+	headers := blockchain.OpenHeaderChain(nodeID)
+	defer headers.Database.Close()
+
+	total := 0
+	for _, address := range addresses {
+		w := wallets.GetWallet(address)
+		balance := 0
+		for _, out := range headers.UnspentOutputs(w.KeyHash()) {
+			balance += out.Value
+		}
+		total += balance
+		if w.WatchOnly {
+			fmt.Printf("%s: %d (watch-only)\n", address, balance)
+		} else {
+			fmt.Printf("%s: %d\n", address, balance)
+		}
+	}
+	fmt.Printf("Total balance: %d\n", total)
+}
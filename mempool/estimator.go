@@ -0,0 +1,279 @@
+package mempool
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+)
+
+const (
+	// MaxConfirmTarget is the most blocks a fee can be estimated for.
+	// Transactions waiting longer count as not confirming in time.
+	MaxConfirmTarget = 25
+
+	// Each block scales the statistics down, so recent blocks weigh more.
+	estimatorDecay = 0.998
+	// A group of fee rate buckets needs this many transactions, after
+	// decay, before its success rate is trusted. Fewer leave a few lucky or
+	// unlucky transactions deciding the estimate.
+	sufficientTxs = 10.0
+	// successThreshold is the share of a group's transactions that must
+	// have confirmed within the target.
+	successThreshold = 0.85
+	bucketSpacing    = 1.5
+	maxBucketFeeRate = 1e7
+)
+
+var ErrNoEstimate = errors.New("not enough transactions have been seen to estimate a fee")
+
+type trackedTx struct {
+	Height  int
+	Bucket  int
+	FeeRate int
+}
+
+// feeStats is everything the estimator learnt, as saved to disk.
+type feeStats struct {
+	Height int
+	// Buckets holds the lowest fee rate of every bucket.
+	Buckets []int
+	// Confirmed counts, per target and bucket, the transactions confirmed
+	// within target+1 blocks.
+	Confirmed [][]float64
+	// Total counts the transactions of every bucket that confirmed or gave
+	// up waiting, and FeeRates sums their fee rates.
+	Total    []float64
+	FeeRates []float64
+	Pending  map[string]trackedTx
+}
+
+// Estimator learns the fee rate needed to be mined within a number of blocks
+// from how long transactions entering the memory pool took to confirm.
+type Estimator struct {
+	mu    sync.Mutex
+	stats feeStats
+}
+
+func NewEstimator() *Estimator {
+	var buckets []int
+	for rate := 1.0; rate <= maxBucketFeeRate; rate = math.Ceil(rate * bucketSpacing) {
+		buckets = append(buckets, int(rate))
+	}
+
+	confirmed := make([][]float64, MaxConfirmTarget)
+	for i := range confirmed {
+		confirmed[i] = make([]float64, len(buckets))
+	}
+
+	return &Estimator{stats: feeStats{
+		Buckets:   buckets,
+		Confirmed: confirmed,
+		Total:     make([]float64, len(buckets)),
+		FeeRates:  make([]float64, len(buckets)),
+		Pending:   make(map[string]trackedTx),
+	}}
+}
+
+func (e *Estimator) bucket(feeRate int) int {
+	b := 0
+	for b+1 < len(e.stats.Buckets) && e.stats.Buckets[b+1] <= feeRate {
+		b++
+	}
+
+	return b
+}
+
+// AddTransaction starts timing a transaction accepted to the memory pool
+// while the chain was at height.
+func (e *Estimator) AddTransaction(entry *Entry, height int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	id := hex.EncodeToString(entry.Tx.ID)
+	if _, ok := e.stats.Pending[id]; !ok {
+		e.stats.Pending[id] = trackedTx{height, e.bucket(entry.FeeRate()), entry.FeeRate()}
+	}
+}
+
+// RemoveTransaction stops timing a transaction that left the memory pool
+// without being mined. It tells nothing about the fee it paid, so it counts
+// neither as confirmed nor as failing to confirm.
+func (e *Estimator) RemoveTransaction(txID []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.stats.Pending, hex.EncodeToString(txID))
+}
+
+// BlockConnected records how long the block's tracked transactions took to
+// confirm. Blocks not above the highest one seen are ignored.
+func (e *Estimator) BlockConnected(block *blockchain.Block) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	s := &e.stats
+	if block.Height <= s.Height {
+		return
+	}
+	s.Height = block.Height
+
+	for b := range s.Buckets {
+		for t := range s.Confirmed {
+			s.Confirmed[t][b] *= estimatorDecay
+		}
+		s.Total[b] *= estimatorDecay
+		s.FeeRates[b] *= estimatorDecay
+	}
+
+	for _, tx := range block.Transactions {
+		id := hex.EncodeToString(tx.ID)
+		tracked, ok := s.Pending[id]
+		if !ok {
+			continue
+		}
+		delete(s.Pending, id)
+
+		blocks := block.Height - tracked.Height
+		if blocks < 1 {
+			blocks = 1
+		}
+		for t := blocks - 1; t < MaxConfirmTarget; t++ {
+			s.Confirmed[t][tracked.Bucket]++
+		}
+		e.resolve(tracked)
+	}
+
+	for id, tracked := range s.Pending {
+		if block.Height-tracked.Height >= MaxConfirmTarget {
+			delete(s.Pending, id)
+			e.resolve(tracked)
+		}
+	}
+}
+
+func (e *Estimator) resolve(tracked trackedTx) {
+	e.stats.Total[tracked.Bucket]++
+	e.stats.FeeRates[tracked.Bucket] += float64(tracked.FeeRate)
+}
+
+// EstimateFee returns the fee rate, in coins per 1000 bytes, that confirmed
+// within blocks blocks for nearly all the transactions seen paying it. Fee
+// rate buckets are grouped from the highest down until they hold enough
+// transactions, and the estimate is the average rate of the lowest group
+// that still confirmed in time.
+func (e *Estimator) EstimateFee(blocks int) (int, error) {
+	if blocks < 1 {
+		return 0, errors.New("target must be at least 1 block")
+	}
+	if blocks > MaxConfirmTarget {
+		blocks = MaxConfirmTarget
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	s := &e.stats
+	estimate := -1.0
+	confirmed, total, feeRates := 0.0, 0.0, 0.0
+	for b := len(s.Buckets) - 1; b >= 0; b-- {
+		confirmed += s.Confirmed[blocks-1][b]
+		total += s.Total[b]
+		feeRates += s.FeeRates[b]
+		if total < sufficientTxs {
+			continue
+		}
+		if confirmed/total < successThreshold {
+			break
+		}
+
+		estimate = feeRates / total
+		confirmed, total, feeRates = 0, 0, 0
+	}
+
+	if estimate < 0 {
+		return 0, ErrNoEstimate
+	}
+
+	return int(math.Round(estimate)), nil
+}
+
+// valid reports whether loaded statistics have a row for every target and
+// a column for every one of the buckets, so they can be indexed safely.
+func (s *feeStats) valid(buckets []int) bool {
+	if len(s.Buckets) != len(buckets) || len(s.Confirmed) != MaxConfirmTarget ||
+		len(s.Total) != len(buckets) || len(s.FeeRates) != len(buckets) {
+		return false
+	}
+	for i, rate := range s.Buckets {
+		if rate != buckets[i] {
+			return false
+		}
+	}
+	for _, row := range s.Confirmed {
+		if len(row) != len(buckets) {
+			return false
+		}
+	}
+	for _, tracked := range s.Pending {
+		if tracked.Bucket < 0 || tracked.Bucket >= len(buckets) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Save writes the statistics to path, replacing the file atomically.
+func (e *Estimator) Save(path string) error {
+	var content bytes.Buffer
+
+	e.mu.Lock()
+	err := gob.NewEncoder(&content).Encode(e.stats)
+	e.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// Load replaces the statistics with those saved at path. A missing file
+// leaves them empty.
+func (e *Estimator) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var stats feeStats
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&stats); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !stats.valid(e.stats.Buckets) {
+		return errors.New("fee statistics were saved with different buckets")
+	}
+	if stats.Pending == nil {
+		stats.Pending = make(map[string]trackedTx)
+	}
+	e.stats = stats
+
+	return nil
+}
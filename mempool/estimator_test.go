@@ -0,0 +1,106 @@
+package mempool
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+)
+
+// trackTx tracks a transaction paying feeRate that entered the pool at
+// height and returns it, to be mined later.
+func trackTx(e *Estimator, n, feeRate, height int) *blockchain.Transaction {
+	tx := &blockchain.Transaction{ID: []byte{byte(n >> 8), byte(n)}}
+	e.AddTransaction(&Entry{Tx: tx, Fee: feeRate, Size: 1000}, height)
+
+	return tx
+}
+
+func TestEstimateFee(t *testing.T) {
+	e := NewEstimator()
+	if _, err := e.EstimateFee(1); !errors.Is(err, ErrNoEstimate) {
+		t.Errorf("expected ErrNoEstimate without data, got %v", err)
+	}
+
+	// Transactions paying 5000 are mined in the next block, those paying
+	// 100 wait 10 blocks.
+	height, n := 0, 0
+	var slow [][]*blockchain.Transaction
+	for i := 0; i < 40; i++ {
+		var fast []*blockchain.Transaction
+		for j := 0; j < 3; j++ {
+			n++
+			fast = append(fast, trackTx(e, n, 5000, height))
+		}
+		n++
+		slow = append(slow, []*blockchain.Transaction{trackTx(e, n, 100, height)})
+
+		txs := fast
+		if i >= 9 {
+			txs = append(txs, slow[i-9]...)
+		}
+		height++
+		e.BlockConnected(&blockchain.Block{Height: height, Transactions: txs})
+	}
+
+	if rate, err := e.EstimateFee(1); err != nil || rate != 5000 {
+		t.Errorf("expected 5000 to confirm in 1 block, got %d, %v", rate, err)
+	}
+	if rate, err := e.EstimateFee(10); err != nil || rate != 100 {
+		t.Errorf("expected 100 to confirm in 10 blocks, got %d, %v", rate, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "feestats.data")
+	if err := e.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewEstimator()
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if rate, err := loaded.EstimateFee(10); err != nil || rate != 100 {
+		t.Errorf("expected the loaded statistics to give 100, got %d, %v", rate, err)
+	}
+
+	// Statistics with a short row must not be indexed.
+	e.stats.Confirmed[3] = e.stats.Confirmed[3][:1]
+	if err := e.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewEstimator().Load(path); err == nil {
+		t.Errorf("expected statistics with a short row to be rejected")
+	}
+}
+
+func TestEstimateFeeNeedsEnoughTransactions(t *testing.T) {
+	e := NewEstimator()
+
+	// A couple of transactions mined in the next block say little about
+	// the fee rate needed.
+	for n := 1; n <= 2; n++ {
+		tx := trackTx(e, n, 5000, n-1)
+		e.BlockConnected(&blockchain.Block{Height: n, Transactions: []*blockchain.Transaction{tx}})
+	}
+
+	if _, err := e.EstimateFee(1); !errors.Is(err, ErrNoEstimate) {
+		t.Errorf("expected ErrNoEstimate from 2 transactions, got %v", err)
+	}
+}
+
+func TestRemovedTransactionsDoNotCount(t *testing.T) {
+	e := NewEstimator()
+
+	// A replaced or evicted transaction never confirms, but that says
+	// nothing about its fee rate being too low.
+	for n := 1; n <= 3; n++ {
+		e.RemoveTransaction(trackTx(e, n, 100, 0).ID)
+	}
+	for height := 1; height <= MaxConfirmTarget; height++ {
+		e.BlockConnected(&blockchain.Block{Height: height})
+	}
+
+	if len(e.stats.Pending) != 0 || e.stats.Total[e.bucket(100)] != 0 {
+		t.Errorf("expected removed transactions to be forgotten, not counted as failing to confirm")
+	}
+}
@@ -0,0 +1,701 @@
+// Package mempool holds the transactions a node has accepted but not yet
+// seen in a block.
+package mempool
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+)
+
+const (
+	// DefaultMaxSize is the default limit on the serialized size of all
+	// transactions in the pool, in bytes.
+	DefaultMaxSize = 5 << 20
+	// MaxTxSize is the largest single transaction the pool accepts.
+	MaxTxSize = 100 << 10
+	// MaxAncestors limits the chain of unconfirmed parents a transaction
+	// may have, itself included.
+	MaxAncestors = 25
+	// DefaultExpiry is how long a transaction is kept by default before it
+	// is dropped unconfirmed.
+	DefaultExpiry = 14 * 24 * time.Hour
+)
+
+var (
+	ErrAlreadyHave      = errors.New("transaction is already in the memory pool")
+	ErrDoubleSpend      = errors.New("transaction spends an output already spent in the memory pool")
+	ErrMissingInputs    = errors.New("transaction spends an output that does not exist or is spent")
+	ErrLowFee           = errors.New("transaction fee rate is below the minimum")
+	ErrPoolFull         = errors.New("memory pool is full of transactions paying a higher fee rate")
+	ErrTooManyAncestors = fmt.Errorf("transaction has more than %d unconfirmed ancestors", MaxAncestors-1)
+	ErrReplacementFee   = errors.New("replacement does not pay a higher fee and fee rate than the transactions it replaces")
+)
+
+// UTXOView looks up unspent outputs of the confirmed chain. It is
+// implemented by blockchain.UTXOSet.
+type UTXOView interface {
+	FindOutput(txID []byte, index int) (blockchain.TxOutput, bool)
+}
+
+type Config struct {
+	// MaxSize limits the total serialized size of the pool in bytes.
+	MaxSize int
+	// MinFeeRate is the lowest fee rate accepted, in coins per 1000 bytes.
+	MinFeeRate int
+	// Expiry is how long a transaction may wait in the pool. Zero keeps
+	// transactions until they are mined or evicted.
+	Expiry time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{MaxSize: DefaultMaxSize, Expiry: DefaultExpiry}
+}
+
+// Entry is a transaction in the pool with what it pays.
+type Entry struct {
+	Tx    *blockchain.Transaction
+	Fee   int
+	Size  int
+	Added time.Time
+}
+
+// FeeRate is the fee in coins per 1000 bytes.
+func (e *Entry) FeeRate() int {
+	return feeRate(e.Fee, e.Size)
+}
+
+func feeRate(fee, size int) int {
+	return fee * 1000 / size
+}
+
+// Pool is a thread-safe set of validated transactions that do not conflict
+// with each other. A transaction may spend outputs of another in the pool,
+// its parent; together with the parent's own ancestors these form the
+// package that has to be mined with it.
+type Pool struct {
+	mu    sync.RWMutex
+	cfg   Config
+	utxo  UTXOView
+	txs   map[string]*Entry
+	spent map[string]string // outpoint -> ID of the pool transaction spending it
+	size  int
+	// onDrop is told of transactions leaving the pool without being mined.
+	onDrop func(txID []byte)
+}
+
+func New(utxo UTXOView, cfg Config) *Pool {
+	return &Pool{
+		cfg:   cfg,
+		utxo:  utxo,
+		txs:   make(map[string]*Entry),
+		spent: make(map[string]string),
+	}
+}
+
+// Add validates a transaction and admits it to the pool. If the pool is
+// full, transactions with a lower fee rate are evicted to make room.
+//
+// A transaction spending an output already spent in the pool replaces the
+// spender, and its descendants, if every transaction it conflicts with opted
+// in to replace-by-fee and it pays both a higher fee than all the replaced
+// transactions together and a higher fee rate than each conflict.
+func (p *Pool) Add(tx *blockchain.Transaction) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, replaced, err := p.check(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range replaced {
+		p.remove(e.Tx.ID)
+	}
+	if err := p.makeRoom(entry); err != nil {
+		for _, e := range replaced {
+			p.insert(e)
+		}
+		return err
+	}
+	p.insert(entry)
+	for _, e := range replaced {
+		p.dropped(e.Tx.ID)
+	}
+
+	return nil
+}
+
+// OnDrop registers f to be called, with the pool locked, with the ID of every
+// transaction that leaves the pool without being mined: replaced, evicted,
+// expired, removed, or conflicting with a block.
+func (p *Pool) OnDrop(f func(txID []byte)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.onDrop = f
+}
+
+func (p *Pool) dropped(txID []byte) {
+	if p.onDrop != nil {
+		p.onDrop(txID)
+	}
+}
+
+// check runs every admission rule and returns the entry to insert, with the
+// entries it replaces.
+func (p *Pool) check(tx *blockchain.Transaction) (*Entry, []*Entry, error) {
+	if tx.IsCoinbase() {
+		return nil, nil, errors.New("coinbase transactions are only valid in blocks")
+	}
+	if len(tx.Inputs) == 0 || len(tx.Outputs) == 0 {
+		return nil, nil, errors.New("transaction has no inputs or no outputs")
+	}
+	if !bytes.Equal(tx.ID, tx.Hash()) {
+		return nil, nil, errors.New("transaction ID does not match its contents")
+	}
+	if _, ok := p.txs[hex.EncodeToString(tx.ID)]; ok {
+		return nil, nil, ErrAlreadyHave
+	}
+
+	size := len(tx.Serialize())
+	if size > MaxTxSize {
+		return nil, nil, fmt.Errorf("transaction of %d bytes exceeds %d", size, MaxTxSize)
+	}
+
+	outputs := 0
+	for _, out := range tx.Outputs {
+		if out.Value <= 0 || outputs+out.Value < outputs {
+			return nil, nil, fmt.Errorf("invalid output value %d", out.Value)
+		}
+		outputs += out.Value
+	}
+
+	var prevOuts []blockchain.TxOutput
+	conflicts := make(map[string]*Entry)
+	inputs := 0
+	seen := make(map[string]bool)
+	for _, in := range tx.Inputs {
+		key := outpoint(in.ID, in.Out)
+		if seen[key] {
+			return nil, nil, errors.New("transaction spends the same output twice")
+		}
+		seen[key] = true
+
+		if id, ok := p.spent[key]; ok {
+			conflicts[id] = p.txs[id]
+		}
+		prevOut, ok := p.findOutput(in.ID, in.Out)
+		if !ok {
+			return nil, nil, ErrMissingInputs
+		}
+		prevOuts = append(prevOuts, prevOut)
+		inputs += prevOut.Value
+	}
+
+	fee := inputs - outputs
+	if fee < 0 {
+		return nil, nil, fmt.Errorf("outputs of %d exceed inputs of %d", outputs, inputs)
+	}
+	if feeRate(fee, size) < p.cfg.MinFeeRate {
+		return nil, nil, ErrLowFee
+	}
+
+	if len(p.ancestors(tx))+1 > MaxAncestors {
+		return nil, nil, ErrTooManyAncestors
+	}
+
+	entry := &Entry{Tx: tx, Fee: fee, Size: size, Added: time.Now()}
+	replaced, err := p.checkReplacement(entry, conflicts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !tx.VerifyOutputs(prevOuts) {
+		return nil, nil, errors.New("invalid signature")
+	}
+
+	return entry, replaced, nil
+}
+
+// checkReplacement applies the replace-by-fee rules to an entry spending
+// outputs the conflicts already spend and returns every entry it would
+// replace.
+func (p *Pool) checkReplacement(entry *Entry, conflicts map[string]*Entry) ([]*Entry, error) {
+	if len(conflicts) == 0 {
+		return nil, nil
+	}
+
+	replaced := make(map[string]*Entry)
+	for id, conflict := range conflicts {
+		if !conflict.Tx.IsReplaceable() {
+			return nil, ErrDoubleSpend
+		}
+		if entry.FeeRate() <= conflict.FeeRate() {
+			return nil, ErrReplacementFee
+		}
+
+		replaced[id] = conflict
+		for _, e := range p.descendants(conflict.Tx) {
+			replaced[hex.EncodeToString(e.Tx.ID)] = e
+		}
+	}
+
+	for _, a := range p.ancestors(entry.Tx) {
+		if _, ok := replaced[hex.EncodeToString(a.Tx.ID)]; ok {
+			return nil, errors.New("replacement spends an output of a transaction it replaces")
+		}
+	}
+
+	var entries []*Entry
+	fees := 0
+	for _, e := range replaced {
+		entries = append(entries, e)
+		fees += e.Fee
+	}
+	if entry.Fee <= fees {
+		return nil, ErrReplacementFee
+	}
+
+	return entries, nil
+}
+
+// findOutput looks an output up in the pool, then in the chain.
+func (p *Pool) findOutput(txID []byte, index int) (blockchain.TxOutput, bool) {
+	if parent, ok := p.txs[hex.EncodeToString(txID)]; ok {
+		if index < 0 || index >= len(parent.Tx.Outputs) {
+			return blockchain.TxOutput{}, false
+		}
+		return parent.Tx.Outputs[index], true
+	}
+
+	return p.utxo.FindOutput(txID, index)
+}
+
+// ancestors returns the pool transactions tx depends on, parents before
+// their children.
+func (p *Pool) ancestors(tx *blockchain.Transaction) []*Entry {
+	var found []*Entry
+	seen := make(map[string]bool)
+
+	var visit func(tx *blockchain.Transaction)
+	visit = func(tx *blockchain.Transaction) {
+		for _, in := range tx.Inputs {
+			id := hex.EncodeToString(in.ID)
+			parent, ok := p.txs[id]
+			if !ok || seen[id] {
+				continue
+			}
+			seen[id] = true
+			visit(parent.Tx)
+			found = append(found, parent)
+		}
+	}
+	visit(tx)
+
+	return found
+}
+
+// descendants returns the pool transactions spending outputs of tx, directly
+// or through other pool transactions.
+func (p *Pool) descendants(tx *blockchain.Transaction) []*Entry {
+	var found []*Entry
+	seen := make(map[string]bool)
+
+	queue := []*blockchain.Transaction{tx}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for outIdx := range current.Outputs {
+			id, ok := p.spent[outpoint(current.ID, outIdx)]
+			if !ok || seen[id] {
+				continue
+			}
+			seen[id] = true
+			child := p.txs[id]
+			found = append(found, child)
+			queue = append(queue, child.Tx)
+		}
+	}
+
+	return found
+}
+
+// makeRoom evicts the lowest fee rate transactions, with the descendants
+// that depend on them, until the entry fits, as long as they pay less than
+// it does. The entry's own ancestors are never evicted.
+func (p *Pool) makeRoom(entry *Entry) error {
+	if p.cfg.MaxSize <= 0 || p.size+entry.Size <= p.cfg.MaxSize {
+		return nil
+	}
+
+	keep := make(map[string]bool)
+	for _, e := range p.ancestors(entry.Tx) {
+		keep[hex.EncodeToString(e.Tx.ID)] = true
+	}
+
+	victims := make(map[string]bool)
+	freed := 0
+	for _, e := range p.sorted(false) {
+		if p.size-freed+entry.Size <= p.cfg.MaxSize {
+			break
+		}
+		id := hex.EncodeToString(e.Tx.ID)
+		if victims[id] || keep[id] {
+			continue
+		}
+		if e.FeeRate() >= entry.FeeRate() {
+			return ErrPoolFull
+		}
+
+		for _, v := range append([]*Entry{e}, p.descendants(e.Tx)...) {
+			if vid := hex.EncodeToString(v.Tx.ID); !victims[vid] {
+				victims[vid] = true
+				freed += v.Size
+			}
+		}
+	}
+	if p.size-freed+entry.Size > p.cfg.MaxSize {
+		return ErrPoolFull
+	}
+
+	for id := range victims {
+		txID, _ := hex.DecodeString(id)
+		p.drop(txID)
+	}
+
+	return nil
+}
+
+func (p *Pool) insert(entry *Entry) {
+	id := hex.EncodeToString(entry.Tx.ID)
+	p.txs[id] = entry
+	for _, in := range entry.Tx.Inputs {
+		p.spent[outpoint(in.ID, in.Out)] = id
+	}
+	p.size += entry.Size
+}
+
+func (p *Pool) remove(txID []byte) {
+	id := hex.EncodeToString(txID)
+	entry, ok := p.txs[id]
+	if !ok {
+		return
+	}
+
+	delete(p.txs, id)
+	for _, in := range entry.Tx.Inputs {
+		delete(p.spent, outpoint(in.ID, in.Out))
+	}
+	p.size -= entry.Size
+}
+
+// drop removes a transaction that will not be mined.
+func (p *Pool) drop(txID []byte) {
+	if _, ok := p.txs[hex.EncodeToString(txID)]; !ok {
+		return
+	}
+
+	p.remove(txID)
+	p.dropped(txID)
+}
+
+// removeWithDescendants drops a transaction and everything spending its
+// outputs, which cannot be valid without it.
+func (p *Pool) removeWithDescendants(txID []byte) {
+	entry, ok := p.txs[hex.EncodeToString(txID)]
+	if !ok {
+		return
+	}
+
+	for _, e := range p.descendants(entry.Tx) {
+		p.drop(e.Tx.ID)
+	}
+	p.drop(txID)
+}
+
+// Remove drops a transaction and its descendants from the pool.
+func (p *Pool) Remove(txID []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.removeWithDescendants(txID)
+}
+
+func (p *Pool) Has(txID []byte) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	_, ok := p.txs[hex.EncodeToString(txID)]
+	return ok
+}
+
+func (p *Pool) Get(txID []byte) (*Entry, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	entry, ok := p.txs[hex.EncodeToString(txID)]
+	return entry, ok
+}
+
+// Ancestors returns the unconfirmed transactions the transaction depends
+// on, parents first.
+func (p *Pool) Ancestors(txID []byte) []*Entry {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	entry, ok := p.txs[hex.EncodeToString(txID)]
+	if !ok {
+		return nil
+	}
+
+	return p.ancestors(entry.Tx)
+}
+
+// Descendants returns the pool transactions that depend on the transaction.
+func (p *Pool) Descendants(txID []byte) []*Entry {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	entry, ok := p.txs[hex.EncodeToString(txID)]
+	if !ok {
+		return nil
+	}
+
+	return p.descendants(entry.Tx)
+}
+
+// Len returns the number of transactions in the pool.
+func (p *Pool) Len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return len(p.txs)
+}
+
+// Size returns the total serialized size of the pool in bytes.
+func (p *Pool) Size() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.size
+}
+
+// Entries returns every entry, highest fee rate first.
+func (p *Pool) Entries() []*Entry {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.sorted(true)
+}
+
+// Transactions returns every transaction, highest fee rate first.
+func (p *Pool) Transactions() []*blockchain.Transaction {
+	var txs []*blockchain.Transaction
+	for _, entry := range p.Entries() {
+		txs = append(txs, entry.Tx)
+	}
+
+	return txs
+}
+
+func (p *Pool) sorted(highestFirst bool) []*Entry {
+	entries := make([]*Entry, 0, len(p.txs))
+	for _, entry := range p.txs {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.FeeRate() != b.FeeRate() {
+			return (a.FeeRate() > b.FeeRate()) == highestFirst
+		}
+		return a.Added.Before(b.Added)
+	})
+
+	return entries
+}
+
+// BlockTemplate selects transactions for a block of at most maxSize bytes.
+// Transactions are picked by the fee rate of their package, themselves plus
+// the ancestors not yet picked, so a child paying a high fee pulls in a
+// parent paying little (child pays for parent). Parents come before their
+// children in the result.
+func (p *Pool) BlockTemplate(maxSize int) []*blockchain.Transaction {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	// Package totals start with every ancestor and lose each ancestor as it
+	// is picked, so no package is walked more than once.
+	packages := make(map[string]*templatePackage, len(p.txs))
+	for id, entry := range p.txs {
+		packages[id] = &templatePackage{entry: entry, fee: entry.Fee, size: entry.Size}
+	}
+	descendants := make(map[string][]*templatePackage)
+	candidates := make(packageHeap, 0, len(packages))
+	for _, pkg := range packages {
+		for _, a := range p.ancestors(pkg.entry.Tx) {
+			id := hex.EncodeToString(a.Tx.ID)
+			pkg.ancestors = append(pkg.ancestors, packages[id])
+			pkg.fee += a.Fee
+			pkg.size += a.Size
+			descendants[id] = append(descendants[id], pkg)
+		}
+		candidates = append(candidates, packageScore{pkg, pkg.fee, pkg.size})
+	}
+	heap.Init(&candidates)
+
+	var txs []*blockchain.Transaction
+	size := 0
+	pick := func(picked *templatePackage) {
+		if picked.selected {
+			return
+		}
+		picked.selected = true
+		txs = append(txs, picked.entry.Tx)
+		size += picked.entry.Size
+
+		for _, d := range descendants[hex.EncodeToString(picked.entry.Tx.ID)] {
+			if d.selected {
+				continue
+			}
+			d.fee -= picked.entry.Fee
+			d.size -= picked.entry.Size
+			heap.Push(&candidates, packageScore{d, d.fee, d.size})
+		}
+	}
+
+	for candidates.Len() > 0 {
+		score := heap.Pop(&candidates).(packageScore)
+		pkg := score.pkg
+		// Scores are pushed again whenever a package changes, leaving the
+		// old ones stale.
+		if pkg.selected || score.fee != pkg.fee || score.size != pkg.size {
+			continue
+		}
+		// A package too large now comes back if one of its ancestors is
+		// picked on its own.
+		if size+pkg.size > maxSize {
+			continue
+		}
+
+		for _, a := range pkg.ancestors {
+			pick(a)
+		}
+		pick(pkg)
+	}
+
+	return txs
+}
+
+// templatePackage is a transaction while a block template is built, with
+// the fee and size of itself and its ancestors not yet picked.
+type templatePackage struct {
+	entry     *Entry
+	ancestors []*templatePackage // parents before their children
+	fee, size int
+	selected  bool
+}
+
+// packageScore is a package's fee and size when it was pushed.
+type packageScore struct {
+	pkg       *templatePackage
+	fee, size int
+}
+
+// packageHeap orders package scores highest fee rate first, then oldest
+// first.
+type packageHeap []packageScore
+
+func (h packageHeap) Len() int { return len(h) }
+
+func (h packageHeap) Less(i, j int) bool {
+	a, b := h[i], h[j]
+	if a.fee*b.size != b.fee*a.size {
+		return a.fee*b.size > b.fee*a.size
+	}
+	return a.pkg.entry.Added.Before(b.pkg.entry.Added)
+}
+
+func (h packageHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *packageHeap) Push(x any) { *h = append(*h, x.(packageScore)) }
+
+func (h *packageHeap) Pop() any {
+	old := *h
+	score := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return score
+}
+
+// PackageFeeRate is the fee rate of the transaction together with its
+// unconfirmed ancestors, the rate at which a miner values including it.
+func (p *Pool) PackageFeeRate(txID []byte) int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	entry, ok := p.txs[hex.EncodeToString(txID)]
+	if !ok {
+		return 0
+	}
+
+	fee, size := entry.Fee, entry.Size
+	for _, a := range p.ancestors(entry.Tx) {
+		fee += a.Fee
+		size += a.Size
+	}
+
+	return feeRate(fee, size)
+}
+
+// BlockConnected removes the block's transactions from the pool, along with
+// any pool transaction spending an output the block spends and their
+// descendants. It must be called after the UTXO set has been updated for the
+// block.
+func (p *Pool) BlockConnected(block *blockchain.Block) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, tx := range block.Transactions {
+		p.remove(tx.ID)
+
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Inputs {
+			if id, ok := p.spent[outpoint(in.ID, in.Out)]; ok {
+				conflict, _ := hex.DecodeString(id)
+				p.removeWithDescendants(conflict)
+			}
+		}
+	}
+}
+
+// BlockDisconnected returns the block's transactions to the pool after the
+// block left the best chain. It must be called after the UTXO set has been
+// rolled back. Transactions that are no longer valid are dropped.
+func (p *Pool) BlockDisconnected(block *blockchain.Block) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, tx := range block.Transactions {
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		p.readd(tx, time.Now())
+	}
+}
+
+func outpoint(txID []byte, index int) string {
+	return fmt.Sprintf("%x:%d", txID, index)
+}
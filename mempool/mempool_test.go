@@ -0,0 +1,374 @@
+package mempool
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+	"github.com/mapfumo/golang-blockchain/wallet"
+)
+
+// fakeUTXO is an in-memory UTXO set keyed by outpoint.
+type fakeUTXO map[string]blockchain.TxOutput
+
+func (u fakeUTXO) FindOutput(txID []byte, index int) (blockchain.TxOutput, bool) {
+	out, ok := u[outpoint(txID, index)]
+	return out, ok
+}
+
+type fixture struct {
+	t    *testing.T
+	utxo fakeUTXO
+	key  wallet.SigningKey
+	w    *wallet.Wallet
+	hash []byte
+	n    int
+}
+
+// watchDrops records the IDs of the transactions the pool drops.
+func watchDrops(pool *Pool) map[string]bool {
+	drops := make(map[string]bool)
+	pool.OnDrop(func(txID []byte) { drops[string(txID)] = true })
+
+	return drops
+}
+
+func newFixture(t *testing.T) *fixture {
+	w, err := wallet.MakeWalletOfType(wallet.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := w.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &fixture{t, fakeUTXO{}, key, w, wallet.PublicKeyHash(w.PublicKey), 0}
+}
+
+// coin adds a confirmed output of the given value and returns its outpoint.
+func (f *fixture) coin(value int) ([]byte, int) {
+	f.n++
+	txID := []byte(fmt.Sprintf("confirmed-%d", f.n))
+	f.utxo[outpoint(txID, 0)] = blockchain.TxOutput{Value: value, PubKeyHash: f.hash}
+
+	return txID, 0
+}
+
+// spendCoin spends a new confirmed output of 100 with the given fee.
+func (f *fixture) spendCoin(fee int) *blockchain.Transaction {
+	txID, index := f.coin(100)
+
+	return f.spend(txID, index, fee)
+}
+
+// spend signs a transaction spending the confirmed outpoint, paying
+// value-fee.
+func (f *fixture) spend(txID []byte, index, fee int) *blockchain.Transaction {
+	prevOut, ok := f.utxo.FindOutput(txID, index)
+	if !ok {
+		f.t.Fatalf("unknown outpoint %s", outpoint(txID, index))
+	}
+
+	return f.spendOutput(txID, index, prevOut, fee)
+}
+
+// spendReplaceable is spend for a transaction opting in to replace-by-fee.
+func (f *fixture) spendReplaceable(txID []byte, index, fee int) *blockchain.Transaction {
+	tx := f.spend(txID, index, fee)
+	tx.Inputs[0].Sequence = blockchain.SequenceReplaceable
+	tx.ID = tx.Hash()
+	prevOut, _ := f.utxo.FindOutput(txID, index)
+	if err := tx.SignInput(0, f.key, prevOut, blockchain.SigHashAll); err != nil {
+		f.t.Fatal(err)
+	}
+
+	return tx
+}
+
+// spendChild spends the first output of an unconfirmed parent.
+func (f *fixture) spendChild(parent *blockchain.Transaction, fee int) *blockchain.Transaction {
+	return f.spendOutput(parent.ID, 0, parent.Outputs[0], fee)
+}
+
+func (f *fixture) spendOutput(txID []byte, index int, prevOut blockchain.TxOutput, fee int) *blockchain.Transaction {
+	tx := &blockchain.Transaction{
+		Inputs:  []blockchain.TxInput{{ID: txID, Out: index, PubKey: f.w.PublicKey}},
+		Outputs: []blockchain.TxOutput{{Value: prevOut.Value - fee, PubKeyHash: f.hash}},
+	}
+	tx.ID = tx.Hash()
+	if err := tx.SignInput(0, f.key, prevOut, blockchain.SigHashAll); err != nil {
+		f.t.Fatal(err)
+	}
+
+	return tx
+}
+
+func TestAddValidatesTransactions(t *testing.T) {
+	f := newFixture(t)
+	pool := New(f.utxo, Config{MinFeeRate: 1})
+
+	txID, index := f.coin(100)
+	tx := f.spend(txID, index, 2)
+	if err := pool.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := pool.Get(tx.ID); entry.Fee != 2 {
+		t.Errorf("expected fee 2, got %d", entry.Fee)
+	}
+	if err := pool.Add(tx); !errors.Is(err, ErrAlreadyHave) {
+		t.Errorf("expected ErrAlreadyHave, got %v", err)
+	}
+	if err := pool.Add(f.spend(txID, index, 3)); !errors.Is(err, ErrDoubleSpend) {
+		t.Errorf("expected ErrDoubleSpend, got %v", err)
+	}
+
+	missing := f.spend(txID, index, 2)
+	missing.Inputs[0].Out = 1
+	missing.ID = missing.Hash()
+	if err := pool.Add(missing); !errors.Is(err, ErrMissingInputs) {
+		t.Errorf("expected ErrMissingInputs, got %v", err)
+	}
+
+	txID, index = f.coin(100)
+	if err := pool.Add(f.spend(txID, index, 0)); !errors.Is(err, ErrLowFee) {
+		t.Errorf("expected ErrLowFee, got %v", err)
+	}
+
+	forged := f.spendCoin(2)
+	forged.Outputs[0].Value--
+	forged.ID = forged.Hash()
+	if err := pool.Add(forged); err == nil {
+		t.Errorf("expected a transaction with a stale signature to be rejected")
+	}
+
+	if pool.Len() != 1 {
+		t.Errorf("expected 1 transaction in the pool, got %d", pool.Len())
+	}
+}
+
+func TestAddEvictsLowestFeeRate(t *testing.T) {
+	f := newFixture(t)
+
+	cheap := f.spendCoin(1)
+	size := len(cheap.Serialize())
+	pool := New(f.utxo, Config{MaxSize: 2 * size})
+	drops := watchDrops(pool)
+
+	mid := f.spendCoin(5)
+	if err := pool.Add(cheap); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Add(mid); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pool.Add(f.spendCoin(0)); !errors.Is(err, ErrPoolFull) {
+		t.Errorf("expected a lower fee transaction to be refused, got %v", err)
+	}
+
+	rich := f.spendCoin(9)
+	if err := pool.Add(rich); err != nil {
+		t.Fatal(err)
+	}
+	if pool.Has(cheap.ID) || !pool.Has(mid.ID) || !pool.Has(rich.ID) {
+		t.Errorf("expected only the cheapest transaction to be evicted")
+	}
+	if len(drops) != 1 || !drops[string(cheap.ID)] {
+		t.Errorf("expected the evicted transaction to be reported dropped, got %v", drops)
+	}
+
+	txs := pool.Transactions()
+	if len(txs) != 2 || string(txs[0].ID) != string(rich.ID) {
+		t.Errorf("expected transactions ordered by fee rate")
+	}
+	if pool.Size() > 2*size {
+		t.Errorf("pool of %d bytes exceeds its limit of %d", pool.Size(), 2*size)
+	}
+}
+
+func TestBlockHooks(t *testing.T) {
+	f := newFixture(t)
+	pool := New(f.utxo, DefaultConfig())
+	drops := watchDrops(pool)
+
+	txID, index := f.coin(100)
+	mined := f.spendCoin(1)
+	pending := f.spend(txID, index, 1)
+	for _, tx := range []*blockchain.Transaction{mined, pending} {
+		if err := pool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The block confirms one transaction and a conflicting spend of the other's input.
+	conflict := f.spend(txID, index, 4)
+	block := &blockchain.Block{Transactions: []*blockchain.Transaction{mined, conflict}}
+	pool.BlockConnected(block)
+	if pool.Len() != 0 {
+		t.Errorf("expected confirmed and conflicting transactions to leave the pool, %d left", pool.Len())
+	}
+	if len(drops) != 1 || !drops[string(pending.ID)] {
+		t.Errorf("expected only the conflicting transaction to be reported dropped, got %v", drops)
+	}
+
+	pool.BlockDisconnected(block)
+	if !pool.Has(mined.ID) || !pool.Has(conflict.ID) {
+		t.Errorf("expected the disconnected block's transactions back in the pool")
+	}
+}
+
+func TestUnconfirmedParents(t *testing.T) {
+	f := newFixture(t)
+	pool := New(f.utxo, DefaultConfig())
+
+	parent := f.spendCoin(0)
+	child := f.spendChild(parent, 1)
+	if err := pool.Add(child); !errors.Is(err, ErrMissingInputs) {
+		t.Errorf("expected an orphan to be rejected, got %v", err)
+	}
+
+	grandchild := f.spendChild(child, 1)
+	for _, tx := range []*blockchain.Transaction{parent, child, grandchild} {
+		if err := pool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := pool.Ancestors(grandchild.ID); len(got) != 2 || string(got[0].Tx.ID) != string(parent.ID) {
+		t.Errorf("expected the parent and child as ancestors, parent first")
+	}
+	if got := pool.Descendants(parent.ID); len(got) != 2 {
+		t.Errorf("expected 2 descendants, got %d", len(got))
+	}
+
+	// A block spending the parent's input another way invalidates the whole chain.
+	block := &blockchain.Block{Transactions: []*blockchain.Transaction{f.spend(parent.Inputs[0].ID, 0, 3)}}
+	pool.BlockConnected(block)
+	if pool.Len() != 0 {
+		t.Errorf("expected descendants of a conflicted transaction to be removed, %d left", pool.Len())
+	}
+}
+
+func TestAncestorLimit(t *testing.T) {
+	f := newFixture(t)
+	pool := New(f.utxo, DefaultConfig())
+
+	tx := f.spendCoin(0)
+	for i := 0; i < MaxAncestors; i++ {
+		if err := pool.Add(tx); err != nil {
+			t.Fatalf("transaction %d: %v", i, err)
+		}
+		tx = f.spendChild(tx, 0)
+	}
+
+	if err := pool.Add(tx); !errors.Is(err, ErrTooManyAncestors) {
+		t.Errorf("expected ErrTooManyAncestors, got %v", err)
+	}
+}
+
+func TestBlockTemplateChildPaysForParent(t *testing.T) {
+	f := newFixture(t)
+	pool := New(f.utxo, DefaultConfig())
+
+	parent := f.spendCoin(0)
+	child := f.spendChild(parent, 20)
+	other := f.spendCoin(5)
+	for _, tx := range []*blockchain.Transaction{parent, child, other} {
+		if err := pool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if pool.PackageFeeRate(child.ID) <= pool.PackageFeeRate(other.ID) {
+		t.Fatalf("expected the child's package to pay a higher rate")
+	}
+
+	// Room for the package only: the parent and child beat the single
+	// transaction paying more than the parent alone.
+	parentEntry, _ := pool.Get(parent.ID)
+	childEntry, _ := pool.Get(child.ID)
+	txs := pool.BlockTemplate(parentEntry.Size + childEntry.Size)
+	if len(txs) != 2 || string(txs[0].ID) != string(parent.ID) || string(txs[1].ID) != string(child.ID) {
+		t.Errorf("expected the parent then the child in the template")
+	}
+
+	if txs := pool.BlockTemplate(1 << 20); len(txs) != 3 {
+		t.Errorf("expected all 3 transactions with room for them, got %d", len(txs))
+	}
+}
+
+func TestBlockTemplateUpdatesPackages(t *testing.T) {
+	f := newFixture(t)
+	pool := New(f.utxo, DefaultConfig())
+
+	grandparent := f.spendCoin(0)
+	parent := f.spendChild(grandparent, 40)
+	child := f.spendChild(parent, 12)
+	other := f.spendCoin(15)
+	for _, tx := range []*blockchain.Transaction{grandparent, parent, child, other} {
+		if err := pool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The child's package outbids the other transaction until the parent's
+	// package is picked, leaving the child to compete on its own fee.
+	want := []*blockchain.Transaction{grandparent, parent, other, child}
+	txs := pool.BlockTemplate(1 << 20)
+	if len(txs) != len(want) {
+		t.Fatalf("expected %d transactions, got %d", len(want), len(txs))
+	}
+	for i, tx := range want {
+		if string(txs[i].ID) != string(tx.ID) {
+			t.Errorf("expected %x at position %d, got %x", tx.ID, i, txs[i].ID)
+		}
+	}
+
+	size := 0
+	for _, tx := range want[:3] {
+		entry, _ := pool.Get(tx.ID)
+		size += entry.Size
+	}
+	if txs := pool.BlockTemplate(size); len(txs) != 3 || string(txs[2].ID) != string(other.ID) {
+		t.Errorf("expected the child to be left out of a full block")
+	}
+}
+
+func TestReplaceByFee(t *testing.T) {
+	f := newFixture(t)
+	pool := New(f.utxo, DefaultConfig())
+
+	drops := watchDrops(pool)
+
+	finalID, finalIndex := f.coin(100)
+	txID, index := f.coin(100)
+	orig := f.spendReplaceable(txID, index, 2)
+	child := f.spendChild(orig, 3)
+	for _, tx := range []*blockchain.Transaction{f.spend(finalID, finalIndex, 2), orig, child} {
+		if err := pool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := pool.Add(f.spend(finalID, finalIndex, 10)); !errors.Is(err, ErrDoubleSpend) {
+		t.Errorf("expected a transaction that did not opt in to stay, got %v", err)
+	}
+
+	// A higher fee rate is not enough while the child's fee is lost.
+	if err := pool.Add(f.spendReplaceable(txID, index, 4)); !errors.Is(err, ErrReplacementFee) {
+		t.Errorf("expected ErrReplacementFee, got %v", err)
+	}
+
+	replacement := f.spendReplaceable(txID, index, 6)
+	if err := pool.Add(replacement); err != nil {
+		t.Fatal(err)
+	}
+	if pool.Has(orig.ID) || pool.Has(child.ID) || !pool.Has(replacement.ID) || pool.Len() != 2 {
+		t.Errorf("expected the replacement to evict the original and its child")
+	}
+	if len(drops) != 2 || !drops[string(orig.ID)] || !drops[string(child.ID)] {
+		t.Errorf("expected the replaced transactions to be reported dropped, got %v", drops)
+	}
+}
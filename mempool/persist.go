@@ -0,0 +1,138 @@
+package mempool
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+)
+
+// savedEntry is a pool transaction as written to disk. Fees and sizes are
+// worked out again when it is loaded.
+type savedEntry struct {
+	Tx    []byte
+	Added time.Time
+}
+
+// Save writes the pool's transactions to path, parents before their
+// children. The file is replaced atomically, so a crash while saving leaves
+// the previous one intact.
+func (p *Pool) Save(path string) error {
+	p.mu.RLock()
+	var saved []savedEntry
+	for _, entry := range p.topological() {
+		saved = append(saved, savedEntry{entry.Tx.Serialize(), entry.Added})
+	}
+	p.mu.RUnlock()
+
+	var content bytes.Buffer
+	if err := gob.NewEncoder(&content).Encode(saved); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content.Bytes(), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// Load adds the transactions saved at path back to the pool, validating
+// them against the current chain. Transactions that expired, were mined, no
+// longer fit or cannot be decoded are dropped. It returns how many were
+// added; a missing file adds none, and a file that cannot be decoded is
+// removed.
+func (p *Pool) Load(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var saved []savedEntry
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&saved); err != nil {
+		os.Remove(path)
+		return 0, fmt.Errorf("discarded unreadable %s: %w", path, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	loaded := 0
+	for _, s := range saved {
+		if p.expired(s.Added, time.Now()) {
+			continue
+		}
+
+		tx, err := blockchain.ParseTransaction(s.Tx)
+		if err != nil {
+			continue
+		}
+		if p.readd(&tx, s.Added) {
+			loaded++
+		}
+	}
+
+	return loaded, nil
+}
+
+// Expire drops the transactions that have waited longer than the configured
+// expiry, with their descendants, and returns how many it dropped.
+func (p *Pool) Expire(now time.Time) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	before := len(p.txs)
+	for _, entry := range p.sorted(true) {
+		if _, ok := p.txs[hex.EncodeToString(entry.Tx.ID)]; ok && p.expired(entry.Added, now) {
+			p.removeWithDescendants(entry.Tx.ID)
+		}
+	}
+
+	return before - len(p.txs)
+}
+
+func (p *Pool) expired(added, now time.Time) bool {
+	return p.cfg.Expiry > 0 && now.Sub(added) > p.cfg.Expiry
+}
+
+// readd admits a transaction coming back from disk or a disconnected block
+// as if added at the given time. It never replaces transactions already in
+// the pool.
+func (p *Pool) readd(tx *blockchain.Transaction, added time.Time) bool {
+	entry, replaced, err := p.check(tx)
+	if err != nil || len(replaced) > 0 {
+		return false
+	}
+	entry.Added = added
+	if p.makeRoom(entry) != nil {
+		return false
+	}
+	p.insert(entry)
+
+	return true
+}
+
+// topological returns every entry with parents before their children.
+func (p *Pool) topological() []*Entry {
+	var order []*Entry
+	seen := make(map[string]bool)
+
+	for _, entry := range p.sorted(true) {
+		for _, e := range append(p.ancestors(entry.Tx), entry) {
+			if id := hex.EncodeToString(e.Tx.ID); !seen[id] {
+				seen[id] = true
+				order = append(order, e)
+			}
+		}
+	}
+
+	return order
+}
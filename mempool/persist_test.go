@@ -0,0 +1,108 @@
+package mempool
+
+import (
+	"bytes"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	f := newFixture(t)
+	pool := New(f.utxo, DefaultConfig())
+
+	parent := f.spendCoin(1)
+	child := f.spendChild(parent, 1)
+	old := f.spendCoin(1)
+	mined := f.spendCoin(1)
+	for _, tx := range []*blockchain.Transaction{parent, child, old, mined} {
+		if err := pool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entry, _ := pool.Get(old.ID)
+	entry.Added = time.Now().Add(-DefaultExpiry - time.Hour)
+
+	path := filepath.Join(t.TempDir(), "mempool.data")
+	if err := pool.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// The chain moved on while the node was down.
+	delete(f.utxo, outpoint(mined.Inputs[0].ID, mined.Inputs[0].Out))
+
+	restarted := New(f.utxo, DefaultConfig())
+	loaded, err := restarted.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != 2 || !restarted.Has(parent.ID) || !restarted.Has(child.ID) {
+		t.Errorf("expected only the parent and child to be loaded, got %d", loaded)
+	}
+
+	if loaded, err := New(f.utxo, DefaultConfig()).Load(filepath.Join(t.TempDir(), "missing")); loaded != 0 || err != nil {
+		t.Errorf("expected a missing file to load nothing, got %d, %v", loaded, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected the file to be readable by its owner only, got %v", info.Mode())
+	}
+}
+
+func TestLoadDiscardsMalformedData(t *testing.T) {
+	f := newFixture(t)
+	tx := f.spendCoin(1)
+
+	var content bytes.Buffer
+	saved := []savedEntry{{[]byte("not a transaction"), time.Now()}, {tx.Serialize(), time.Now()}}
+	if err := gob.NewEncoder(&content).Encode(saved); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "mempool.data")
+	if err := os.WriteFile(path, content.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	pool := New(f.utxo, DefaultConfig())
+	if loaded, err := pool.Load(path); err != nil || loaded != 1 || !pool.Has(tx.ID) {
+		t.Errorf("expected the malformed entry to be skipped, got %d, %v", loaded, err)
+	}
+
+	if err := os.WriteFile(path, []byte("not a memory pool"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(f.utxo, DefaultConfig()).Load(path); err == nil {
+		t.Errorf("expected a malformed file to be an error")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the malformed file to be removed")
+	}
+}
+
+func TestExpire(t *testing.T) {
+	f := newFixture(t)
+	pool := New(f.utxo, DefaultConfig())
+
+	parent := f.spendCoin(1)
+	child := f.spendChild(parent, 1)
+	for _, tx := range []*blockchain.Transaction{parent, child, f.spendCoin(1)} {
+		if err := pool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The child goes with its expired parent.
+	entry, _ := pool.Get(parent.ID)
+	entry.Added = time.Now().Add(-DefaultExpiry - time.Hour)
+	if dropped := pool.Expire(time.Now()); dropped != 2 || pool.Has(child.ID) {
+		t.Errorf("expected the parent and child to expire, %d did", dropped)
+	}
+}
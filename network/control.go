@@ -0,0 +1,372 @@
+package network
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+	"github.com/mapfumo/golang-blockchain/wallet"
+	"github.com/mapfumo/golang-blockchain/walletdb"
+)
+
+// The node holds the wallet file of its node ID so it can be unlocked once
+// and sign for commands until it locks again. The wallet commands are not
+// part of the peer protocol: they go over a Unix socket next to the wallet
+// file, and each carries the cookie the node writes to a file only its
+// owner can read.
+const (
+	controlSocket = "./tmp/wallet_%s.sock"
+	controlCookie = "./tmp/wallet_%s.cookie"
+)
+
+var (
+	walletsMu    sync.Mutex
+	nodeWallets  *wallet.Wallets
+	walletNodeID string
+	cookie       []byte
+	control      net.Listener
+)
+
+var ErrBadCookie = errors.New("wrong control cookie, is the node of this NODE_ID running?")
+
+type UnlockWallet struct {
+	Passphrase string
+	Timeout    time.Duration
+}
+
+type SignTx struct {
+	PartialTransaction string
+	HashType           blockchain.SigHashType
+}
+
+type SendPayment struct {
+	From        string
+	Payouts     []blockchain.Payout
+	Fee         int
+	Replaceable bool
+	Unconfirmed bool
+}
+
+// ControlRequest is a wallet command sent over the control socket. Only the
+// field of its command is set.
+type ControlRequest struct {
+	Cookie  []byte
+	Command string
+	Unlock  UnlockWallet
+	SignTx  SignTx
+	Payment SendPayment
+}
+
+type ControlReply struct {
+	Unlocked           bool
+	Until              time.Time
+	PartialTransaction string
+	Signed             int
+	TxID               []byte
+	Error              string
+}
+
+func controlRequest(nodeID string, request ControlRequest) (ControlReply, error) {
+	var reply ControlReply
+
+	data, err := os.ReadFile(fmt.Sprintf(controlCookie, nodeID))
+	if err != nil {
+		return reply, err
+	}
+	request.Cookie, err = hex.DecodeString(string(data))
+	if err != nil {
+		return reply, err
+	}
+
+	conn, err := net.Dial("unix", fmt.Sprintf(controlSocket, nodeID))
+	if err != nil {
+		return reply, err
+	}
+	defer conn.Close()
+
+	if err := gob.NewEncoder(conn).Encode(request); err != nil {
+		return reply, err
+	}
+	if err := gob.NewDecoder(conn).Decode(&reply); err != nil {
+		return reply, err
+	}
+	if reply.Error != "" {
+		return reply, errors.New(reply.Error)
+	}
+
+	return reply, nil
+}
+
+// RequestUnlock asks the running node of nodeID to unlock its wallet file.
+// With a positive timeout the node locks it again once the timeout passes.
+// It returns when that is, or the zero time.
+func RequestUnlock(nodeID, passphrase string, timeout time.Duration) (time.Time, error) {
+	reply, err := controlRequest(nodeID, ControlRequest{Command: "unlock", Unlock: UnlockWallet{passphrase, timeout}})
+
+	return reply.Until, err
+}
+
+// RequestLock asks the running node of nodeID to forget the keys of its
+// wallet file.
+func RequestLock(nodeID string) error {
+	_, err := controlRequest(nodeID, ControlRequest{Command: "lock"})
+
+	return err
+}
+
+// RequestWalletStatus asks the running node of nodeID whether it can sign
+// with its wallet file, and until when.
+func RequestWalletStatus(nodeID string) (bool, time.Time, error) {
+	reply, err := controlRequest(nodeID, ControlRequest{Command: "status"})
+
+	return reply.Unlocked, reply.Until, err
+}
+
+// RequestSignTx has the running node of nodeID sign the inputs of the
+// partial transaction spending outputs of its wallet file. It returns the
+// partial transaction with the signatures and how many inputs were signed.
+func RequestSignTx(nodeID string, ptx *blockchain.PartialTransaction, hashType blockchain.SigHashType) (*blockchain.PartialTransaction, int, error) {
+	reply, err := controlRequest(nodeID, ControlRequest{Command: "signtx", SignTx: SignTx{ptx.Encode(), hashType}})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	signed, err := blockchain.DecodePartialTransaction(reply.PartialTransaction)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return signed, reply.Signed, nil
+}
+
+// RequestSendPayment has the running node of nodeID pay the payouts from the
+// address from of its wallet file, with change to a fresh address of it, and
+// relay the transaction. With unconfirmed set, outputs in its memory pool
+// can be spent. It returns the ID of the transaction.
+func RequestSendPayment(nodeID, from string, payouts []blockchain.Payout, fee int, replaceable, unconfirmed bool) ([]byte, error) {
+	payment := SendPayment{from, payouts, fee, replaceable, unconfirmed}
+	reply, err := controlRequest(nodeID, ControlRequest{Command: "sendpayment", Payment: payment})
+
+	return reply.TxID, err
+}
+
+// StartControl loads the wallet file of nodeID and listens on its control
+// socket for the wallet commands.
+func StartControl(nodeID string, chain *blockchain.BlockChain) error {
+	nodeWallets, _ = wallet.CreateWallets(nodeID)
+	walletNodeID = nodeID
+
+	cookie = make([]byte, 32)
+	if _, err := rand.Read(cookie); err != nil {
+		return err
+	}
+	if err := os.WriteFile(fmt.Sprintf(controlCookie, nodeID), []byte(hex.EncodeToString(cookie)), 0600); err != nil {
+		return err
+	}
+
+	// A node that did not shut down cleanly leaves its socket behind.
+	path := fmt.Sprintf(controlSocket, nodeID)
+	os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return err
+	}
+	control = ln
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handleControl(conn, chain)
+		}
+	}()
+
+	return nil
+}
+
+// StopControl closes the control socket and removes its cookie.
+func StopControl() {
+	if control == nil {
+		return
+	}
+	control.Close()
+	os.Remove(fmt.Sprintf(controlCookie, walletNodeID))
+}
+
+func handleControl(conn net.Conn, chain *blockchain.BlockChain) {
+	defer conn.Close()
+
+	var request ControlRequest
+	var reply ControlReply
+	if err := gob.NewDecoder(conn).Decode(&request); err != nil {
+		reply.Error = err.Error()
+	} else if subtle.ConstantTimeCompare(request.Cookie, cookie) != 1 {
+		reply.Error = ErrBadCookie.Error()
+	} else {
+		reply = runControl(request, chain)
+	}
+
+	if err := gob.NewEncoder(conn).Encode(reply); err != nil {
+		log.Println("could not reply on the control socket:", err)
+	}
+}
+
+func runControl(request ControlRequest, chain *blockchain.BlockChain) ControlReply {
+	if request.Command == "sendpayment" {
+		return sendPayment(request.Payment, chain)
+	}
+
+	walletsMu.Lock()
+	defer walletsMu.Unlock()
+
+	reply := walletStatus()
+	if reply.Error != "" {
+		return reply
+	}
+
+	switch request.Command {
+	case "status":
+	case "unlock":
+		if err := nodeWallets.Unlock(request.Unlock.Passphrase, request.Unlock.Timeout); err != nil {
+			return ControlReply{Error: err.Error()}
+		}
+		reply = ControlReply{Unlocked: true, Until: nodeWallets.UnlockedUntil()}
+	case "lock":
+		nodeWallets.Lock()
+		reply = ControlReply{}
+	case "signtx":
+		reply = signTx(request.SignTx, reply.Unlocked)
+	default:
+		reply = ControlReply{Error: fmt.Sprintf("unknown wallet command %q", request.Command)}
+	}
+
+	return reply
+}
+
+// walletStatus reports the state of the node's wallet file, reading it
+// again first to see addresses added since it was unlocked.
+func walletStatus() ControlReply {
+	if err := nodeWallets.Reload(walletNodeID); err != nil {
+		return ControlReply{Error: err.Error()}
+	}
+
+	return ControlReply{Unlocked: !nodeWallets.IsLocked(), Until: nodeWallets.UnlockedUntil()}
+}
+
+func signTx(request SignTx, unlocked bool) ControlReply {
+	if !unlocked {
+		return ControlReply{Error: wallet.ErrWalletLocked.Error()}
+	}
+	ptx, err := blockchain.DecodePartialTransaction(request.PartialTransaction)
+	if err != nil {
+		return ControlReply{Error: err.Error()}
+	}
+
+	signed, err := signPartialTransaction(ptx, nodeWallets, request.HashType)
+	if err != nil {
+		return ControlReply{Error: err.Error()}
+	}
+
+	return ControlReply{Unlocked: true, PartialTransaction: ptx.Encode(), Signed: signed}
+}
+
+// signPartialTransaction signs every input of ptx spending an output locked
+// to a private key of the wallets and returns how many it signed.
+func signPartialTransaction(ptx *blockchain.PartialTransaction, wallets *wallet.Wallets, hashType blockchain.SigHashType) (int, error) {
+	signed := 0
+	for _, address := range wallets.GetAllAddresses() {
+		w := wallets.GetWallet(address)
+		if w.WatchOnly {
+			continue
+		}
+		n, err := ptx.Sign(&w, hashType)
+		if err != nil {
+			return signed, err
+		}
+		signed += n
+	}
+
+	return signed, nil
+}
+
+// refreshWalletKeys has the wallet database follow the addresses of the
+// wallet file, such as the change addresses taken since the node started.
+func refreshWalletKeys() {
+	walletsMu.Lock()
+	defer walletsMu.Unlock()
+
+	// Without a wallet file there are no addresses to follow.
+	if err := nodeWallets.Reload(walletNodeID); err != nil {
+		return
+	}
+	walletDB.SetKeys(walletdb.WalletKeys(nodeWallets))
+}
+
+// payFromWallet builds and signs the transaction paying p from the node's
+// wallet file, saving the change address it takes.
+func payFromWallet(p SendPayment, chain *blockchain.BlockChain) (*blockchain.Transaction, error) {
+	walletsMu.Lock()
+	defer walletsMu.Unlock()
+
+	if status := walletStatus(); status.Error != "" {
+		return nil, errors.New(status.Error)
+	} else if !status.Unlocked {
+		return nil, wallet.ErrWalletLocked
+	}
+	if _, ok := nodeWallets.Lookup(p.From); !ok {
+		return nil, fmt.Errorf("%s is not an address of the wallet file", p.From)
+	}
+	w := nodeWallets.GetWallet(p.From)
+	if w.WatchOnly {
+		return nil, errors.New("cannot send from a watch-only address")
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	if p.Unconfirmed {
+		UTXOSet.Unconfirmed = memoryPool.Transactions()
+	}
+	change, err := nodeWallets.NewChangeAddress(p.From)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := blockchain.NewMultiTransaction(&w, p.Payouts, p.Fee, change, p.Replaceable, &UTXOSet)
+	if err != nil {
+		return nil, err
+	}
+	nodeWallets.SaveFile(walletNodeID)
+
+	return tx, nil
+}
+
+func sendPayment(p SendPayment, chain *blockchain.BlockChain) ControlReply {
+	tx, err := payFromWallet(p, chain)
+	if err == nil {
+		err = acceptTx(tx, chain)
+	}
+	if err != nil {
+		return ControlReply{Error: err.Error()}
+	}
+
+	if nodeAddress == KnownNodes[0] {
+		announceTx(tx, nodeAddress)
+	} else {
+		SendTx(KnownNodes[0], tx)
+	}
+
+	return ControlReply{TxID: tx.ID}
+}
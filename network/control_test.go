@@ -0,0 +1,52 @@
+package network
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+	"github.com/mapfumo/golang-blockchain/wallet"
+)
+
+func TestControlSocket(t *testing.T) {
+	chdirTemp(t)
+
+	ws := &wallet.Wallets{Wallets: make(map[string]*wallet.Wallet)}
+	address := ws.AddWallet()
+	ws.SaveFile("test")
+
+	if err := StartControl("test", nil); err != nil {
+		t.Fatal(err)
+	}
+	defer StopControl()
+
+	for _, file := range []string{controlSocket, controlCookie} {
+		info, err := os.Stat(fmt.Sprintf(file, "test"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("expected %s to be readable by its owner only, got %v", file, info.Mode())
+		}
+	}
+
+	if unlocked, _, err := RequestWalletStatus("test"); err != nil || !unlocked {
+		t.Fatalf("expected a plaintext wallet file to be unlocked: %v", err)
+	}
+	if _, err := RequestSendPayment("test", "nobody", []blockchain.Payout{{Address: address, Amount: 1}}, 0, false, false); err == nil {
+		t.Errorf("expected a payment from an unknown address to fail")
+	}
+	if _, err := controlRequest("test", ControlRequest{Command: "bogus"}); err == nil {
+		t.Errorf("expected an unknown command to fail")
+	}
+
+	path := fmt.Sprintf(controlCookie, "test")
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(make([]byte, 32))), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := RequestWalletStatus("test"); err == nil || err.Error() != ErrBadCookie.Error() {
+		t.Errorf("expected a request without the cookie to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package network
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+)
+
+// maxFilterAddSize caps a single element added with filteradd.
+const maxFilterAddSize = 520
+
+var (
+	filtersMu sync.Mutex
+	// peerFilters holds the bloom filter loaded by each light client peer,
+	// keyed by its address.
+	peerFilters = make(map[string]*blockchain.BloomFilter)
+)
+
+type FilterLoad struct {
+	AddrFrom string
+	Filter   blockchain.BloomFilter
+}
+
+type FilterAdd struct {
+	AddrFrom string
+	Data     []byte
+}
+
+type FilterClear struct {
+	AddrFrom string
+}
+
+// MerkleBlock is a block reduced to its header and the transactions that
+// match the peer's filter, each with a serialized TxProof.
+type MerkleBlock struct {
+	AddrFrom     string
+	Header       blockchain.Header
+	Transactions [][]byte
+	Proofs       [][]byte
+}
+
+func SendFilterLoad(address string, filter *blockchain.BloomFilter) {
+	payload := GobEncode(FilterLoad{nodeAddress, *filter})
+	request := append(CmdToBytes("filterload"), payload...)
+
+	SendData(address, request)
+}
+
+func SendFilterAdd(address string, data []byte) {
+	payload := GobEncode(FilterAdd{nodeAddress, data})
+	request := append(CmdToBytes("filteradd"), payload...)
+
+	SendData(address, request)
+}
+
+func SendFilterClear(address string) {
+	payload := GobEncode(FilterClear{nodeAddress})
+	request := append(CmdToBytes("filterclear"), payload...)
+
+	SendData(address, request)
+}
+
+// SendMerkleBlock sends the block filtered by the peer's bloom filter. A
+// peer without a filter gets the header only.
+func SendMerkleBlock(addr string, b *blockchain.Block) {
+	data := MerkleBlock{AddrFrom: nodeAddress, Header: b.Header()}
+
+	for _, tx := range b.Transactions {
+		if !peerWantsTx(addr, tx) {
+			continue
+		}
+
+		proof, err := blockchain.NewTxProof(b, tx.ID)
+		if err != nil {
+			log.Panic(err)
+		}
+		data.Transactions = append(data.Transactions, tx.Serialize())
+		data.Proofs = append(data.Proofs, proof.Serialize())
+	}
+
+	payload := GobEncode(data)
+	request := append(CmdToBytes("merkleblock"), payload...)
+
+	SendData(addr, request)
+}
+
+func HandleFilterLoad(request []byte) {
+	var buff bytes.Buffer
+	var payload FilterLoad
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if !payload.Filter.IsValid() {
+		fmt.Printf("Rejected oversized filter from %s\n", payload.AddrFrom)
+		return
+	}
+
+	filtersMu.Lock()
+	defer filtersMu.Unlock()
+
+	peerFilters[payload.AddrFrom] = &payload.Filter
+}
+
+func HandleFilterAdd(request []byte) {
+	var buff bytes.Buffer
+	var payload FilterAdd
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if len(payload.Data) > maxFilterAddSize {
+		fmt.Printf("Rejected oversized filter element from %s\n", payload.AddrFrom)
+		return
+	}
+
+	filtersMu.Lock()
+	defer filtersMu.Unlock()
+
+	if filter, ok := peerFilters[payload.AddrFrom]; ok {
+		filter.Add(payload.Data)
+	}
+}
+
+func HandleFilterClear(request []byte) {
+	var buff bytes.Buffer
+	var payload FilterClear
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	filtersMu.Lock()
+	defer filtersMu.Unlock()
+
+	delete(peerFilters, payload.AddrFrom)
+}
+
+// filteredPeers returns the light client peers that loaded a filter.
+func filteredPeers() []string {
+	filtersMu.Lock()
+	defer filtersMu.Unlock()
+
+	var peers []string
+	for addr := range peerFilters {
+		peers = append(peers, addr)
+	}
+
+	return peers
+}
+
+// peerWantsTx reports whether a transaction should be relayed to the peer:
+// always for peers without a filter, otherwise only if the filter matches.
+func peerWantsTx(addr string, tx *blockchain.Transaction) bool {
+	filtersMu.Lock()
+	defer filtersMu.Unlock()
+
+	filter, ok := peerFilters[addr]
+	if !ok {
+		return true
+	}
+
+	return filter.MatchTransaction(tx)
+}
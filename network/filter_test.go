@@ -0,0 +1,123 @@
+package network
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+)
+
+func filterLoadRequest(from string, filter *blockchain.BloomFilter) []byte {
+	return append(CmdToBytes("filterload"), GobEncode(FilterLoad{from, *filter})...)
+}
+
+func TestPeerFilterMatching(t *testing.T) {
+	const peer = "localhost:9999"
+	t.Cleanup(func() { delete(peerFilters, peer) })
+
+	received := blockchain.CoinbaseTx(testAddress, "received")
+	spend := &blockchain.Transaction{
+		Inputs:  []blockchain.TxInput{{ID: received.ID, Out: 0, PubKey: []byte("pubkey")}},
+		Outputs: []blockchain.TxOutput{{Value: 20, PubKeyHash: []byte("someone else")}},
+	}
+	spend.ID = spend.Hash()
+	other := blockchain.CoinbaseTx(testAddress, "other")
+	spendOther := &blockchain.Transaction{
+		Inputs:  []blockchain.TxInput{{ID: other.ID, Out: 0, PubKey: []byte("another key")}},
+		Outputs: []blockchain.TxOutput{{Value: 20, PubKeyHash: []byte("someone else")}},
+	}
+	spendOther.ID = spendOther.Hash()
+
+	if !peerWantsTx(peer, spend) {
+		t.Errorf("expected a peer without a filter to get every transaction")
+	}
+
+	filter := blockchain.NewBloomFilter(10, 0.0001, 7)
+	filter.Add(received.Outputs[0].PubKeyHash)
+	HandleFilterLoad(filterLoadRequest(peer, filter))
+
+	if peerWantsTx(peer, spend) {
+		t.Errorf("expected a spend of an output not yet matched to be filtered out")
+	}
+	if !peerWantsTx(peer, received) {
+		t.Errorf("expected an output to the filtered key hash to match")
+	}
+	if !peerWantsTx(peer, spend) {
+		t.Errorf("expected a spend of a matched outpoint to match")
+	}
+	if peerWantsTx(peer, spendOther) {
+		t.Errorf("expected a spend of an unknown outpoint to be filtered out")
+	}
+
+	add := append(CmdToBytes("filteradd"), GobEncode(FilterAdd{peer, blockchain.Outpoint(other.ID, 0)})...)
+	HandleFilterAdd(add)
+	if !peerWantsTx(peer, spendOther) {
+		t.Errorf("expected a spend of an outpoint added with filteradd to match")
+	}
+
+	HandleFilterClear(append(CmdToBytes("filterclear"), GobEncode(FilterClear{peer})...))
+	if _, ok := peerFilters[peer]; ok {
+		t.Errorf("expected filterclear to drop the filter")
+	}
+}
+
+func TestRejectOversizedFilters(t *testing.T) {
+	const peer = "localhost:9998"
+	t.Cleanup(func() { delete(peerFilters, peer) })
+
+	oversized := &blockchain.BloomFilter{Filter: make([]byte, 1<<20), HashFuncs: 1}
+	HandleFilterLoad(filterLoadRequest(peer, oversized))
+	if _, ok := peerFilters[peer]; ok {
+		t.Fatalf("expected an oversized filter to be rejected")
+	}
+
+	filter := blockchain.NewBloomFilter(10, 0.0001, 7)
+	HandleFilterLoad(filterLoadRequest(peer, filter))
+	data := make([]byte, maxFilterAddSize+1)
+	HandleFilterAdd(append(CmdToBytes("filteradd"), GobEncode(FilterAdd{peer, data})...))
+	if peerFilters[peer].Contains(data) {
+		t.Errorf("expected an oversized filter element to be rejected")
+	}
+}
+
+func TestSendMerkleBlock(t *testing.T) {
+	peer, requests := listenPeer(t)
+	t.Cleanup(func() { delete(peerFilters, peer) })
+
+	genesis := blockchain.Genesis(blockchain.CoinbaseTx(testAddress, "genesis"))
+	ours := blockchain.CoinbaseTx(testAddress, "ours")
+	theirs := blockchain.CoinbaseTx(testAddress, "theirs")
+	theirs.Outputs[0].PubKeyHash = []byte("nobody")
+	theirs.ID = theirs.Hash()
+	block := blockchain.CreateBlock([]*blockchain.Transaction{theirs, ours}, genesis.Hash, 1)
+
+	filter := blockchain.NewBloomFilter(10, 0.0001, 7)
+	filter.Add(ours.Outputs[0].PubKeyHash)
+	HandleFilterLoad(filterLoadRequest(peer, filter))
+
+	SendMerkleBlock(peer, block)
+	req := expectCommand(t, requests, "merkleblock")
+	var payload MerkleBlock
+	if err := gob.NewDecoder(bytes.NewReader(req[commandLength:])).Decode(&payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(payload.Header.Hash, block.Hash) || !payload.Header.Validate() {
+		t.Errorf("expected the valid header of the block")
+	}
+	if len(payload.Transactions) != 1 || len(payload.Proofs) != 1 {
+		t.Fatalf("expected only the matching transaction, got %d", len(payload.Transactions))
+	}
+	tx := blockchain.DeserializeTransaction(payload.Transactions[0])
+	proof, err := blockchain.DeserializeTxProof(payload.Proofs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tx.ID, ours.ID) || !bytes.Equal(proof.TxID, ours.ID) || !proof.Verify() {
+		t.Errorf("expected our transaction with a valid proof")
+	}
+	if !bytes.Equal(proof.MerkleRoot, payload.Header.MerkleRoot) {
+		t.Errorf("expected the proof to lead to the header's Merkle root")
+	}
+}
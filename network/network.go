@@ -3,7 +3,7 @@ package network
 import (
 	"bytes"
 	"encoding/gob"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,10 +11,13 @@ import (
 	"os"
 	"runtime"
 	"syscall"
+	"time"
 
 	"github.com/vrecan/death/v3"
 
 	"github.com/mapfumo/golang-blockchain/blockchain"
+	"github.com/mapfumo/golang-blockchain/mempool"
+	"github.com/mapfumo/golang-blockchain/walletdb"
 )
 
 
@@ -22,6 +25,10 @@ const (
 	protocol = "tcp"
 	version = 1
 	commandLength = 12
+	maxBlockSize = 1 << 20
+	mempoolFile = "./tmp/mempool_%s.data"
+	mempoolSaveInterval = time.Minute
+	feeStatsFile = "./tmp/feestats_%s.data"
 )
 
 var (
@@ -29,7 +36,11 @@ var (
 	mineAddress string
 	KnownNodes = []string{"localhost:3000"}
 	blocksInTransit = [][]byte{}
-	memoryPool = make(map[string]blockchain.Transaction)
+	memoryPool *mempool.Pool
+	mempoolPath string
+	feeEstimator *mempool.Estimator
+	feeStatsPath string
+	walletDB *walletdb.DB
 )
 
 type Addr struct {
@@ -61,6 +72,19 @@ type Tx struct{
 	Transaction []byte
 }
 
+type Mempool struct {
+	Transactions [][]byte
+}
+
+type EstimateFee struct {
+	Blocks int
+}
+
+type FeeEstimate struct {
+	FeeRate int
+	Error   string
+}
+
 type Version struct {
 	Version int
 	BestHeight int
@@ -182,6 +206,93 @@ func SendData(addr string, data []byte) {
 	}
 }
 
+// sendRequest sends a request to the node at addr and decodes the reply the
+// node writes back on the same connection into reply.
+func sendRequest(addr string, request []byte, reply interface{}) error {
+	conn, err := net.Dial(protocol, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+	if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+		return err
+	}
+
+	return gob.NewDecoder(conn).Decode(reply)
+}
+
+// RequestMempool asks the node at addr for the transactions in its memory
+// pool, parents first.
+func RequestMempool(addr string) ([]*blockchain.Transaction, error) {
+	var payload Mempool
+	if err := sendRequest(addr, CmdToBytes("getmempool"), &payload); err != nil {
+		return nil, err
+	}
+
+	var txs []*blockchain.Transaction
+	for _, data := range payload.Transactions {
+		tx, err := blockchain.ParseTransaction(data)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, &tx)
+	}
+
+	return txs, nil
+}
+
+func HandleGetMempool(conn net.Conn) {
+	var payload Mempool
+
+	for _, tx := range memoryPool.BlockTemplate(memoryPool.Size()) {
+		payload.Transactions = append(payload.Transactions, tx.Serialize())
+	}
+
+	if _, err := conn.Write(GobEncode(payload)); err != nil {
+		log.Println("could not send the memory pool:", err)
+	}
+}
+
+// RequestFeeEstimate asks the node at addr for the fee rate, in coins per
+// 1000 bytes, needed to confirm within the given number of blocks.
+func RequestFeeEstimate(addr string, blocks int) (int, error) {
+	request := append(CmdToBytes("estimatefee"), GobEncode(EstimateFee{blocks})...)
+
+	var payload FeeEstimate
+	if err := sendRequest(addr, request, &payload); err != nil {
+		return 0, err
+	}
+	if payload.Error != "" {
+		return 0, errors.New(payload.Error)
+	}
+
+	return payload.FeeRate, nil
+}
+
+func HandleEstimateFee(request []byte, conn net.Conn) {
+	var buff bytes.Buffer
+	var payload EstimateFee
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	var reply FeeEstimate
+	err := dec.Decode(&payload)
+	if err == nil {
+		reply.FeeRate, err = feeEstimator.EstimateFee(payload.Blocks)
+	}
+	if err != nil {
+		reply.Error = err.Error()
+	}
+
+	if _, err := conn.Write(GobEncode(reply)); err != nil {
+		log.Println("could not send the fee estimate:", err)
+	}
+}
+
 func HandleAddr(request []byte) {
 	var buff bytes.Buffer
 	var payload Addr
@@ -230,7 +341,7 @@ func HandleInv(request []byte, chain *blockchain.BlockChain) {
 	if payload.Type == "tx" {
 		txID := payload.Items[0]
 
-		if memoryPool[hex.EncodeToString(txID)].ID == nil {
+		if !memoryPool.Has(txID) {
 			SendGetData(payload.AddrFrom, "tx", txID)
 		}
 	}
@@ -252,9 +363,27 @@ func HandleBlock(request []byte, chain *blockchain.BlockChain) {
 	block := blockchain.Deserialize(blockData)
 
 	fmt.Println("Recevied a new block!")
+	prevTip := chain.LastHash
 	chain.AddBlock(block)
 
 	fmt.Printf("Added block %x\n", block.Hash)
+	// Blocks off the best chain, or ones we already had, confirm nothing.
+	newTip := !bytes.Equal(prevTip, block.Hash) && bytes.Equal(chain.LastHash, block.Hash)
+	if newTip {
+		memoryPool.BlockConnected(block)
+		feeEstimator.BlockConnected(block)
+	}
+
+	// Full nodes hear of a block from the miner, but light clients only
+	// talk to us. Tell them about the new tip once we stop downloading;
+	// one that missed blocks in between syncs headers.
+	if newTip && len(blocksInTransit) == 0 {
+		for _, node := range filteredPeers() {
+			if node != payload.AddrFrom {
+				SendInv(node, "block", [][]byte{block.Hash})
+			}
+		}
+	}
 
 	if len(blocksInTransit) > 0 {
 		blockHash := blocksInTransit[0]
@@ -262,8 +391,10 @@ func HandleBlock(request []byte, chain *blockchain.BlockChain) {
 
 		blocksInTransit = blocksInTransit[1:]
 	} else {
-		UTXOSet := blockchain.UTXOSet{chain}
+		UTXOSet := blockchain.UTXOSet{Blockchain: chain}
 		UTXOSet.Reindex()
+		refreshWalletKeys()
+		walletDB.Sync(chain)
 	}
 }
 
@@ -302,11 +433,22 @@ func HandleGetData(request []byte, chain *blockchain.BlockChain) {
 		SendBlock(payload.AddrFrom, &block)
 	}
 
+	if payload.Type == "filteredblock" {
+		block, err := chain.GetBlock([]byte(payload.ID))
+		if err != nil {
+			return
+		}
+
+		SendMerkleBlock(payload.AddrFrom, &block)
+	}
+
 	if payload.Type == "tx" {
-		txID := hex.EncodeToString(payload.ID)
-		tx := memoryPool[txID]
+		entry, ok := memoryPool.Get(payload.ID)
+		if !ok {
+			return
+		}
 
-		SendTx(payload.AddrFrom, &tx)
+		SendTx(payload.AddrFrom, entry.Tx)
 	}
 }
 
@@ -323,31 +465,62 @@ func HandleTx(request []byte, chain *blockchain.BlockChain) {
 
 	txData := payload.Transaction
 	tx := blockchain.DeserializeTransaction(txData)
-	memoryPool[hex.EncodeToString(tx.ID)] = tx
+	if err := acceptTx(&tx, chain); err != nil {
+		fmt.Printf("Rejected transaction %x: %s\n", tx.ID, err)
+		return
+	}
 
-	fmt.Printf("%s, %d", nodeAddress, len(memoryPool))
+	fmt.Printf("%s, %d\n", nodeAddress, memoryPool.Len())
 
 	if nodeAddress == KnownNodes[0] {
-		for _, node := range KnownNodes {
-			if node != nodeAddress && node != payload.AddrFrom {
-				SendInv(node, "tx", [][]byte{tx.ID})
-			}
-		}
+		announceTx(&tx, payload.AddrFrom)
 	} else {
-		if len(memoryPool) >= 2 && len(mineAddress) > 0 {
+		if memoryPool.Len() >= 2 && len(mineAddress) > 0 {
 			MineTx(chain)
 		}
 	}
 }
 
+// acceptTx adds tx to the memory pool, and to the fee estimator and wallet
+// database once it is in.
+func acceptTx(tx *blockchain.Transaction, chain *blockchain.BlockChain) error {
+	if err := memoryPool.Add(tx); err != nil {
+		return err
+	}
+	if entry, ok := memoryPool.Get(tx.ID); ok {
+		feeEstimator.AddTransaction(entry, chain.GetBestHeight())
+	}
+	refreshWalletKeys()
+	walletDB.AddTransaction(tx)
+
+	return nil
+}
+
+// announceTx tells the peers other than addrFrom that want tx about it.
+func announceTx(tx *blockchain.Transaction, addrFrom string) {
+	for _, node := range KnownNodes {
+		if node != nodeAddress && node != addrFrom && peerWantsTx(node, tx) {
+			SendInv(node, "tx", [][]byte{tx.ID})
+		}
+	}
+}
+
 func MineTx(chain *blockchain.BlockChain) {
 	var txs []*blockchain.Transaction
+	fees := 0
 
-	for id := range memoryPool {
-		fmt.Printf("tx: %s\n", memoryPool[id].ID)
-		tx := memoryPool[id]
-		if chain.VerifyTransaction(&tx) {
-			txs = append(txs, &tx)
+	for _, tx := range memoryPool.BlockTemplate(maxBlockSize) {
+		// Removing an invalid transaction also removes its descendants.
+		entry, ok := memoryPool.Get(tx.ID)
+		if !ok {
+			continue
+		}
+		fmt.Printf("tx: %x\n", tx.ID)
+		if chain.VerifyTransactions(append(txs, tx)) {
+			txs = append(txs, tx)
+			fees += entry.Fee
+		} else {
+			memoryPool.Remove(tx.ID)
 		}
 	}
 
@@ -356,19 +529,19 @@ func MineTx(chain *blockchain.BlockChain) {
 		return
 	}
 
-	cbTx := blockchain.CoinbaseTx(mineAddress, "")
+	cbTx := blockchain.CoinbaseTxWithFees(mineAddress, "", fees)
 	txs = append(txs, cbTx)
 
 	newBlock := chain.MineBlock(txs)
-	UTXOSet  := blockchain.UTXOSet{chain}
+	UTXOSet  := blockchain.UTXOSet{Blockchain: chain}
 	UTXOSet.Reindex()
 
 	fmt.Println("New Block mined")
 
-	for _, tx := range txs {
-		txID := hex.EncodeToString(tx.ID)
-		delete(memoryPool, txID)
-	}
+	memoryPool.BlockConnected(newBlock)
+	feeEstimator.BlockConnected(newBlock)
+	refreshWalletKeys()
+	walletDB.Sync(chain)
 
 	for _, node := range KnownNodes {
 		if node != nodeAddress {
@@ -376,7 +549,7 @@ func MineTx(chain *blockchain.BlockChain) {
 		}
 	}
 
-	if len(memoryPool) > 0 {
+	if memoryPool.Len() > 0 {
 		MineTx(chain)
 	}
 }
@@ -432,6 +605,20 @@ func HandleConnection(conn net.Conn, chain *blockchain.BlockChain) {
 		HandleTx(req, chain)
 	case "version":
 		HandleVersion(req, chain)
+	case "getheaders":
+		HandleGetHeaders(req, chain)
+	case "getproofs":
+		HandleGetProofs(req, chain)
+	case "filterload":
+		HandleFilterLoad(req)
+	case "filteradd":
+		HandleFilterAdd(req)
+	case "filterclear":
+		HandleFilterClear(req)
+	case "getmempool":
+		HandleGetMempool(conn)
+	case "estimatefee":
+		HandleEstimateFee(req, conn)
 	default:
 		fmt.Println("Unknown command")
 	}
@@ -448,6 +635,32 @@ func StartServer(nodeID, minerAddress string) {
 
 	chain := blockchain.ContinueBlockChain(nodeID)
 	defer chain.Database.Close()
+
+	memoryPool = mempool.New(blockchain.UTXOSet{Blockchain: chain}, mempool.DefaultConfig())
+	mempoolPath = fmt.Sprintf(mempoolFile, nodeID)
+	if loaded, err := memoryPool.Load(mempoolPath); err != nil {
+		fmt.Printf("Could not load the memory pool: %s\n", err)
+	} else if loaded > 0 {
+		fmt.Printf("Loaded %d transactions into the memory pool\n", loaded)
+	}
+	feeEstimator = mempool.NewEstimator()
+	feeStatsPath = fmt.Sprintf(feeStatsFile, nodeID)
+	if err := feeEstimator.Load(feeStatsPath); err != nil {
+		fmt.Printf("Could not load the fee statistics: %s\n", err)
+	}
+	memoryPool.OnDrop(feeEstimator.RemoveTransaction)
+	if err := StartControl(nodeID, chain); err != nil {
+		log.Panic(err)
+	}
+	walletDB, err = walletdb.Open(nodeID, walletdb.WalletKeys(nodeWallets))
+	if err != nil {
+		log.Panic(err)
+	}
+	walletDB.Sync(chain)
+	for _, tx := range memoryPool.BlockTemplate(memoryPool.Size()) {
+		walletDB.AddTransaction(tx)
+	}
+	go SaveMempool()
 	go CloseDB(chain)
 
 	if nodeAddress != KnownNodes[0] {
@@ -487,12 +700,37 @@ func NodeIsKnown(addr string) bool {
 }
 
 
+// SaveMempool periodically drops expired transactions and saves the memory
+// pool, fee statistics and wallet database, so a crash loses little of
+// them.
+func SaveMempool() {
+	for range time.Tick(mempoolSaveInterval) {
+		memoryPool.Expire(time.Now())
+		walletDB.Expire(time.Now(), mempool.DefaultExpiry)
+		saveMempool()
+	}
+}
+
+func saveMempool() {
+	if err := memoryPool.Save(mempoolPath); err != nil {
+		log.Println("could not save the memory pool:", err)
+	}
+	if err := feeEstimator.Save(feeStatsPath); err != nil {
+		log.Println("could not save the fee statistics:", err)
+	}
+	if err := walletDB.Save(); err != nil {
+		log.Println("could not save the wallet database:", err)
+	}
+}
+
 func CloseDB(chain *blockchain.BlockChain) {
 	d := death.NewDeath(syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 
 	d.WaitForDeathWithFunc(func() {
 		defer os.Exit(1)
 		defer runtime.Goexit()
+		saveMempool()
+		StopControl()
 		chain.Database.Close()
 	})
 }
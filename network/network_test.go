@@ -0,0 +1,44 @@
+package network
+
+import (
+	"encoding/gob"
+	"net"
+	"testing"
+
+	"github.com/mapfumo/golang-blockchain/mempool"
+)
+
+func TestHandleEstimateFeeReplies(t *testing.T) {
+	feeEstimator = mempool.NewEstimator()
+
+	estimate := func(request []byte) FeeEstimate {
+		t.Helper()
+
+		client, server := net.Pipe()
+		defer client.Close()
+		go func() {
+			HandleEstimateFee(request, server)
+			server.Close()
+		}()
+
+		var reply FeeEstimate
+		if err := gob.NewDecoder(client).Decode(&reply); err != nil {
+			t.Fatal(err)
+		}
+
+		return reply
+	}
+
+	if reply := estimate(append(CmdToBytes("estimatefee"), "garbage"...)); reply.Error == "" {
+		t.Errorf("expected an error reply to a malformed request")
+	}
+	reply := estimate(append(CmdToBytes("estimatefee"), GobEncode(EstimateFee{1})...))
+	if reply.Error != mempool.ErrNoEstimate.Error() {
+		t.Errorf("expected %v, got %q", mempool.ErrNoEstimate, reply.Error)
+	}
+
+	// A client that hung up must not take the node down.
+	client, server := net.Pipe()
+	client.Close()
+	HandleEstimateFee(append(CmdToBytes("estimatefee"), GobEncode(EstimateFee{1})...), server)
+}
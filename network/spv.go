@@ -0,0 +1,369 @@
+package network
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"syscall"
+
+	"github.com/vrecan/death/v3"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+	"github.com/mapfumo/golang-blockchain/wallet"
+)
+
+// maxHeaders caps the headers sent in one reply; the light client asks
+// again from its new tip until it has caught up.
+const maxHeaders = 2000
+
+// bloomFPRate is the false positive rate of the filter a light client
+// loads. Higher rates hide better which addresses are ours.
+const bloomFPRate = 0.0005
+
+type GetHeaders struct {
+	AddrFrom   string
+	FromHeight int
+}
+
+type Headers struct {
+	AddrFrom string
+	Headers  []blockchain.Header
+}
+
+type GetProofs struct {
+	AddrFrom     string
+	PubKeyHashes [][]byte
+}
+
+// Proofs pairs every serialized transaction with its serialized TxProof.
+type Proofs struct {
+	AddrFrom     string
+	Transactions [][]byte
+	Proofs       [][]byte
+}
+
+func SendGetHeaders(address string, fromHeight int) {
+	payload := GobEncode(GetHeaders{nodeAddress, fromHeight})
+	request := append(CmdToBytes("getheaders"), payload...)
+
+	SendData(address, request)
+}
+
+func SendHeaders(address string, headers []blockchain.Header) {
+	payload := GobEncode(Headers{nodeAddress, headers})
+	request := append(CmdToBytes("headers"), payload...)
+
+	SendData(address, request)
+}
+
+func SendGetProofs(address string, pubKeyHashes [][]byte) {
+	payload := GobEncode(GetProofs{nodeAddress, pubKeyHashes})
+	request := append(CmdToBytes("getproofs"), payload...)
+
+	SendData(address, request)
+}
+
+func SendSPVVersion(addr string, headers *blockchain.HeaderChain) {
+	payload := GobEncode(Version{version, headers.GetBestHeight(), nodeAddress})
+	request := append(CmdToBytes("version"), payload...)
+
+	SendData(addr, request)
+}
+
+// HandleGetHeaders answers a light client with the headers above its tip.
+func HandleGetHeaders(request []byte, chain *blockchain.BlockChain) {
+	var buff bytes.Buffer
+	var payload GetHeaders
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	headers := chain.GetHeaders(payload.FromHeight)
+	if len(headers) > maxHeaders {
+		headers = headers[:maxHeaders]
+	}
+
+	SendHeaders(payload.AddrFrom, headers)
+}
+
+// HandleGetProofs answers a light client with the transactions touching its
+// addresses and the Merkle proofs placing them in blocks.
+func HandleGetProofs(request []byte, chain *blockchain.BlockChain) {
+	var buff bytes.Buffer
+	var payload GetProofs
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	txs, proofs := chain.FindTxProofs(payload.PubKeyHashes)
+
+	response := Proofs{AddrFrom: nodeAddress}
+	for i, tx := range txs {
+		response.Transactions = append(response.Transactions, tx.Serialize())
+		response.Proofs = append(response.Proofs, proofs[i].Serialize())
+	}
+
+	request = append(CmdToBytes("proofs"), GobEncode(response)...)
+	SendData(payload.AddrFrom, request)
+}
+
+// spvNode is the state of a light client: its headers and the public key
+// hashes of the wallet it watches. Messages are handled one at a time.
+type spvNode struct {
+	mu           sync.Mutex
+	headers      *blockchain.HeaderChain
+	addresses    []string
+	pubKeyHashes [][]byte
+}
+
+func (node *spvNode) HandleHeaders(request []byte) {
+	var buff bytes.Buffer
+	var payload Headers
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Received %d headers\n", len(payload.Headers))
+
+	for _, header := range payload.Headers {
+		if err := node.headers.AddHeader(header); err != nil {
+			fmt.Printf("Rejected header: %s\n", err)
+			return
+		}
+	}
+
+	if len(payload.Headers) == maxHeaders {
+		SendGetHeaders(payload.AddrFrom, node.headers.GetBestHeight())
+		return
+	}
+
+	fmt.Printf("Synced headers up to height %d\n", node.headers.GetBestHeight())
+	SendGetProofs(payload.AddrFrom, node.pubKeyHashes)
+}
+
+func (node *spvNode) HandleProofs(request []byte) {
+	var buff bytes.Buffer
+	var payload Proofs
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	node.addProvenTransactions(payload.Transactions, payload.Proofs)
+	node.printBalances()
+}
+
+func (node *spvNode) addProvenTransactions(txs, proofs [][]byte) {
+	if len(txs) != len(proofs) {
+		fmt.Println("Rejected proofs: count does not match transactions")
+		return
+	}
+
+	for i, txData := range txs {
+		tx := blockchain.DeserializeTransaction(txData)
+		proof, err := blockchain.DeserializeTxProof(proofs[i])
+		if err == nil {
+			err = node.headers.AddProvenTransaction(&tx, proof)
+		}
+		if err != nil {
+			fmt.Printf("Rejected transaction: %s\n", err)
+		}
+	}
+}
+
+// HandleMerkleBlock stores the header of a new block and the transactions
+// the full node matched against our filter. If we missed blocks in between
+// we fall back to syncing headers.
+func (node *spvNode) HandleMerkleBlock(request []byte) {
+	var buff bytes.Buffer
+	var payload MerkleBlock
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if _, err := node.headers.GetHeader(payload.Header.PrevHash); err != nil && len(payload.Header.PrevHash) > 0 {
+		SendGetHeaders(payload.AddrFrom, node.headers.GetBestHeight())
+		return
+	}
+	if err := node.headers.AddHeader(payload.Header); err != nil {
+		fmt.Printf("Rejected header: %s\n", err)
+		return
+	}
+
+	node.addProvenTransactions(payload.Transactions, payload.Proofs)
+	node.printBalances()
+}
+
+// HandleTx reports an unconfirmed transaction relayed because it matched
+// our filter. It only counts towards balances once proven in a block.
+func (node *spvNode) HandleTx(request []byte) {
+	var buff bytes.Buffer
+	var payload Tx
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	tx := blockchain.DeserializeTransaction(payload.Transaction)
+	fmt.Printf("Unconfirmed transaction %x\n", tx.ID)
+}
+
+func (node *spvNode) HandleInv(request []byte) {
+	var buff bytes.Buffer
+	var payload Inv
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if payload.Type == "block" {
+		for _, hash := range payload.Items {
+			SendGetData(payload.AddrFrom, "filteredblock", hash)
+		}
+	}
+
+	if payload.Type == "tx" {
+		SendGetData(payload.AddrFrom, "tx", payload.Items[0])
+	}
+}
+
+func (node *spvNode) HandleVersion(request []byte) {
+	var buff bytes.Buffer
+	var payload Version
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if payload.BestHeight > node.headers.GetBestHeight() {
+		SendGetHeaders(payload.AddrFrom, node.headers.GetBestHeight())
+	}
+}
+
+func (node *spvNode) HandleConnection(conn net.Conn) {
+	req, err := io.ReadAll(conn)
+	defer conn.Close()
+
+	if err != nil {
+		log.Panic(err)
+	}
+	command := BytesToCmd(req[:commandLength])
+	fmt.Printf("Received %s command\n", command)
+
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	switch command {
+	case "headers":
+		node.HandleHeaders(req)
+	case "proofs":
+		node.HandleProofs(req)
+	case "merkleblock":
+		node.HandleMerkleBlock(req)
+	case "tx":
+		node.HandleTx(req)
+	case "inv":
+		node.HandleInv(req)
+	case "version":
+		node.HandleVersion(req)
+	default:
+		fmt.Println("Ignoring command in SPV mode")
+	}
+}
+
+func (node *spvNode) printBalances() {
+	for i, address := range node.addresses {
+		balance := 0
+		for _, out := range node.headers.UnspentOutputs(node.pubKeyHashes[i]) {
+			balance += out.Value
+			fmt.Printf("  %x:%d %d (%d confirmations)\n", out.TxID, out.Index, out.Value, out.Confirmations)
+		}
+		fmt.Printf("Balance of %s: %d\n", address, balance)
+	}
+}
+
+// StartSPVServer runs a light client. It keeps only block headers, checking
+// their proof of work and linkage, and asks the first known node for Merkle
+// proofs of the transactions touching this node's wallet addresses.
+func StartSPVServer(nodeID string) {
+	nodeAddress = fmt.Sprintf("localhost:%s", nodeID)
+	ln, err := net.Listen(protocol, nodeAddress)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer ln.Close()
+
+	node := &spvNode{headers: blockchain.OpenHeaderChain(nodeID)}
+	defer node.headers.Database.Close()
+	go CloseHeaderDB(node.headers)
+
+	wallets, _ := wallet.CreateWallets(nodeID)
+	addresses := wallets.GetAllAddresses()
+	filter := blockchain.NewBloomFilter(2*len(addresses), bloomFPRate, rand.Uint32())
+	for _, address := range addresses {
+		w := wallets.GetWallet(address)
+		node.addresses = append(node.addresses, address)
+		node.pubKeyHashes = append(node.pubKeyHashes, w.KeyHash())
+		filter.Add(w.KeyHash())
+		if len(w.PublicKey) > 0 {
+			filter.Add(w.PublicKey)
+		}
+	}
+
+	SendFilterLoad(KnownNodes[0], filter)
+	SendSPVVersion(KnownNodes[0], node.headers)
+	SendGetHeaders(KnownNodes[0], node.headers.GetBestHeight())
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Panic(err)
+		}
+		go node.HandleConnection(conn)
+	}
+}
+
+func CloseHeaderDB(headers *blockchain.HeaderChain) {
+	d := death.NewDeath(syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+
+	d.WaitForDeathWithFunc(func() {
+		defer os.Exit(1)
+		defer runtime.Goexit()
+		headers.Database.Close()
+	})
+}
@@ -0,0 +1,183 @@
+package network
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+)
+
+const testAddress = "1111111111111111111114oLvT2"
+
+// chdirTemp moves into a temporary working directory with a tmp directory
+// in it, since database and socket paths are relative.
+func chdirTemp(t *testing.T) {
+	t.Helper()
+
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.Mkdir("tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// listenPeer stands in for the full node a light client talks to,
+// returning its address and the requests sent to it.
+func listenPeer(t *testing.T) (string, <-chan []byte) {
+	t.Helper()
+
+	ln, err := net.Listen(protocol, "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	requests := make(chan []byte, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			req, _ := io.ReadAll(conn)
+			conn.Close()
+			requests <- req
+		}
+	}()
+
+	return ln.Addr().String(), requests
+}
+
+func expectCommand(t *testing.T, requests <-chan []byte, command string) []byte {
+	t.Helper()
+
+	select {
+	case req := <-requests:
+		if got := BytesToCmd(req[:commandLength]); got != command {
+			t.Fatalf("expected a %s request, got %s", command, got)
+		}
+		return req
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected a %s request", command)
+	}
+
+	return nil
+}
+
+func openTestSPVNode(t *testing.T) *spvNode {
+	t.Helper()
+	chdirTemp(t)
+
+	node := &spvNode{headers: blockchain.OpenHeaderChain("test")}
+	t.Cleanup(func() { node.headers.Database.Close() })
+
+	return node
+}
+
+func headersRequest(from string, blocks ...*blockchain.Block) []byte {
+	payload := Headers{AddrFrom: from}
+	for _, b := range blocks {
+		payload.Headers = append(payload.Headers, b.Header())
+	}
+
+	return append(CmdToBytes("headers"), GobEncode(payload)...)
+}
+
+func mineOn(prev *blockchain.Block, data string) *blockchain.Block {
+	return blockchain.CreateBlock([]*blockchain.Transaction{blockchain.CoinbaseTx(testAddress, data)}, prev.Hash, prev.Height+1)
+}
+
+func TestSPVHeaderSyncAndForkChoice(t *testing.T) {
+	node := openTestSPVNode(t)
+	peer, requests := listenPeer(t)
+
+	genesis := blockchain.Genesis(blockchain.CoinbaseTx(testAddress, "genesis"))
+	a1 := mineOn(genesis, "a1")
+	a2 := mineOn(a1, "a2")
+	b1 := mineOn(genesis, "b1")
+	b2 := mineOn(b1, "b2")
+	b3 := mineOn(b2, "b3")
+
+	node.HandleHeaders(headersRequest(peer, genesis, a1, a2))
+	expectCommand(t, requests, "getproofs")
+	if !bytes.Equal(node.headers.LastHash, a2.Hash) {
+		t.Fatalf("expected the tip to be a2 after syncing")
+	}
+
+	node.HandleHeaders(headersRequest(peer, b1, b2))
+	expectCommand(t, requests, "getproofs")
+	if !bytes.Equal(node.headers.LastHash, a2.Hash) {
+		t.Errorf("expected a fork of the same height not to take over the tip")
+	}
+
+	tampered := b3.Header()
+	tampered.Height++
+	payload := Headers{AddrFrom: peer, Headers: []blockchain.Header{tampered}}
+	node.HandleHeaders(append(CmdToBytes("headers"), GobEncode(payload)...))
+	if !bytes.Equal(node.headers.LastHash, a2.Hash) {
+		t.Errorf("expected a header failing proof of work to be rejected")
+	}
+
+	node.HandleHeaders(headersRequest(peer, b3))
+	expectCommand(t, requests, "getproofs")
+	if !bytes.Equal(node.headers.LastHash, b3.Hash) {
+		t.Errorf("expected the longer fork to become the best chain")
+	}
+	if node.headers.InBestChain(a1.Hash) || !node.headers.InBestChain(b1.Hash) {
+		t.Errorf("expected only the longer fork in the best chain")
+	}
+}
+
+func TestSPVMerkleBlock(t *testing.T) {
+	node := openTestSPVNode(t)
+	peer, requests := listenPeer(t)
+
+	genesis := blockchain.Genesis(blockchain.CoinbaseTx(testAddress, "genesis"))
+	second := mineOn(genesis, "second")
+	third := mineOn(second, "third")
+
+	node.HandleHeaders(headersRequest(peer, genesis))
+	expectCommand(t, requests, "getproofs")
+
+	merkleBlock := func(b *blockchain.Block) []byte {
+		proof, err := blockchain.NewTxProof(b, b.Transactions[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload := MerkleBlock{
+			AddrFrom:     peer,
+			Header:       b.Header(),
+			Transactions: [][]byte{b.Transactions[0].Serialize()},
+			Proofs:       [][]byte{proof.Serialize()},
+		}
+
+		return append(CmdToBytes("merkleblock"), GobEncode(payload)...)
+	}
+
+	node.HandleMerkleBlock(merkleBlock(third))
+	req := expectCommand(t, requests, "getheaders")
+	var getHeaders GetHeaders
+	if err := gob.NewDecoder(bytes.NewReader(req[commandLength:])).Decode(&getHeaders); err != nil {
+		t.Fatal(err)
+	}
+	if getHeaders.FromHeight != 0 {
+		t.Errorf("expected a block after a gap to sync headers from height 0, got %d", getHeaders.FromHeight)
+	}
+
+	node.HandleMerkleBlock(merkleBlock(second))
+	if !bytes.Equal(node.headers.LastHash, second.Hash) {
+		t.Fatalf("expected the merkle block to extend the tip")
+	}
+	pubKeyHash := second.Transactions[0].Outputs[0].PubKeyHash
+	if outputs := node.headers.UnspentOutputs(pubKeyHash); len(outputs) != 1 || outputs[0].Confirmations != 1 {
+		t.Errorf("expected the proven output with 1 confirmation, got %+v", outputs)
+	}
+}
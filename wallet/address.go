@@ -0,0 +1,165 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Network is a chain that addresses are meant for, told apart by the
+// human-readable prefix of their bech32m form.
+type Network struct {
+	Name string
+	HRP  string
+}
+
+var (
+	Mainnet = &Network{Name: "mainnet", HRP: "gb"}
+	Testnet = &Network{Name: "testnet", HRP: "tgb"}
+	Regtest = &Network{Name: "regtest", HRP: "rgb"}
+)
+
+var Networks = []*Network{Mainnet, Testnet, Regtest}
+
+// ActiveNetwork is the network new addresses are encoded for and that
+// addresses are validated against.
+var ActiveNetwork = Mainnet
+
+var ErrWrongNetwork = errors.New("address is for another network")
+
+const pubKeyHashLength = sha256.Size
+
+// NetworkByName returns the network of a name as used on the command line.
+func NetworkByName(name string) (*Network, error) {
+	for _, network := range Networks {
+		if strings.EqualFold(network.Name, name) {
+			return network, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown network %q", name)
+}
+
+func networkByHRP(hrp string) *Network {
+	for _, network := range Networks {
+		if network.HRP == hrp {
+			return network
+		}
+	}
+
+	return nil
+}
+
+// Address is a decoded address: the key hash outputs paying it are locked
+// to and the type of the key.
+type Address struct {
+	// Network is nil for a legacy base58 address, which is valid on every
+	// network.
+	Network    *Network
+	KeyType    KeyType
+	PubKeyHash []byte
+}
+
+// String encodes the address in bech32m, with the key type as the first
+// value after the separator, or in base58 for a legacy address.
+func (a Address) String() string {
+	if a.Network == nil {
+		versionedHash := append([]byte{byte(a.KeyType)}, a.PubKeyHash...)
+
+		return string(Base58Encode(append(versionedHash, Checksum(versionedHash)...)))
+	}
+
+	data, err := convertBits(a.PubKeyHash, 8, 5, true)
+	if err != nil {
+		log.Panic(err)
+	}
+	address, err := EncodeBech32(a.Network.HRP, append([]byte{byte(a.KeyType)}, data...))
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return address
+}
+
+// ParseAddress decodes a bech32m address of any known network or a legacy
+// base58 address.
+func ParseAddress(address string) (Address, error) {
+	sep := strings.LastIndexByte(strings.ToLower(address), bech32Separator)
+	if sep > 0 && networkByHRP(strings.ToLower(address[:sep])) != nil {
+		a, err := parseBech32Address(address)
+		if err != nil {
+			// A base58 address can start like a prefix too.
+			if legacy, legacyErr := parseLegacyAddress(address); legacyErr == nil {
+				return legacy, nil
+			}
+		}
+
+		return a, err
+	}
+
+	return parseLegacyAddress(address)
+}
+
+func parseBech32Address(address string) (Address, error) {
+	hrp, data, err := DecodeBech32(address)
+	if err != nil {
+		return Address{}, err
+	}
+	if len(data) == 0 || !KeyType(data[0]).IsValid() {
+		return Address{}, errors.New("unknown address key type")
+	}
+	pubKeyHash, err := convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return Address{}, err
+	}
+	if len(pubKeyHash) != pubKeyHashLength {
+		return Address{}, fmt.Errorf("address key hash is %d bytes, not %d", len(pubKeyHash), pubKeyHashLength)
+	}
+
+	return Address{Network: networkByHRP(hrp), KeyType: KeyType(data[0]), PubKeyHash: pubKeyHash}, nil
+}
+
+func parseLegacyAddress(address string) (Address, error) {
+	data, err := Base58Decode([]byte(address))
+	if err != nil {
+		return Address{}, errors.New("address is neither bech32m of a known network nor base58")
+	}
+	// Legacy addresses never had their key hash length checked.
+	if len(data) <= 1+checksumLength {
+		return Address{}, errors.New("invalid address length")
+	}
+	version := data[0]
+	pubKeyHash := data[1 : len(data)-checksumLength]
+	if !KeyType(version).IsValid() {
+		return Address{}, errors.New("unknown address key type")
+	}
+	if !bytes.Equal(data[len(data)-checksumLength:], Checksum(append([]byte{version}, pubKeyHash...))) {
+		return Address{}, errors.New("invalid address checksum")
+	}
+
+	return Address{KeyType: KeyType(version), PubKeyHash: pubKeyHash}, nil
+}
+
+// DecodeAddress decodes an address that can be used on the active network.
+func DecodeAddress(address string) (Address, error) {
+	a, err := ParseAddress(address)
+	if err != nil {
+		return a, err
+	}
+	if a.Network != nil && a.Network != ActiveNetwork {
+		return a, fmt.Errorf("%w: %s is a %s address, not %s", ErrWrongNetwork, address, a.Network.Name, ActiveNetwork.Name)
+	}
+
+	return a, nil
+}
+
+// ValidateAddress checks that an address is well formed and can be used on
+// the active network.
+func ValidateAddress(address string) error {
+	_, err := DecodeAddress(address)
+
+	return err
+}
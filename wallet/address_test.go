@@ -0,0 +1,140 @@
+package wallet
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// legacyAddress returns the base58 address w had before bech32m addresses.
+func legacyAddress(w *Wallet) string {
+	return Address{KeyType: w.KeyType, PubKeyHash: w.KeyHash()}.String()
+}
+
+// Test vectors of BIP 350.
+func TestBech32mVectors(t *testing.T) {
+	valid := []string{
+		"A1LQFN3A",
+		"a1lqfn3a",
+		"an83characterlonghumanreadablepartthatcontainsthetheexcludedcharactersbioandnumber11sg7hg6",
+		"abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx",
+		"11llllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllludsr8",
+		"split1checkupstagehandshakeupstreamerranterredcaperredlc445v",
+		"?1v759aa",
+	}
+	for _, s := range valid {
+		hrp, data, err := DecodeBech32(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if encoded, err := EncodeBech32(hrp, data); err != nil || encoded != strings.ToLower(s) {
+			t.Errorf("%s: encoded back as %s, %v", s, encoded, err)
+		}
+	}
+
+	invalid := []string{
+		"an84characterslonghumanreadablepartthatcontainsthetheexcludedcharactersbioandnumber11nhrtld",
+		"qyrz8wqd2c9m",
+		"1qyrz8wqd2c9m",
+		"y1b0jsk6g",
+		"lt1igcx5c0",
+		"in1muywd",
+		"mm1crxm3i",
+		"au1s5cgom",
+		"M1VUXWEZ",
+		"16plkw9",
+		"1p2gdwpf",
+		"A1lqfn3a",
+	}
+	for _, s := range invalid {
+		if _, _, err := DecodeBech32(s); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
+
+func TestAddresses(t *testing.T) {
+	t.Cleanup(func() { ActiveNetwork = Mainnet })
+
+	for _, keyType := range []KeyType{KeyTypeP256, KeyTypeEd25519} {
+		w, _ := MakeWalletOfType(keyType)
+		address := string(w.Address())
+		if address[:3] != "gb1" {
+			t.Errorf("expected a mainnet address, got %s", address)
+		}
+
+		for _, s := range []string{address, legacyAddress(w)} {
+			decoded, err := DecodeAddress(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.KeyType != keyType || string(decoded.PubKeyHash) != string(w.KeyHash()) {
+				t.Errorf("%s: decoded to %+v", s, decoded)
+			}
+			if decoded.String() != s {
+				t.Errorf("%s: encoded back as %s", s, decoded.String())
+			}
+		}
+	}
+
+	w := MakeWallet()
+	mainnet := string(w.Address())
+	ActiveNetwork = Testnet
+	testnet := string(w.Address())
+	if testnet[:4] != "tgb1" {
+		t.Errorf("expected a testnet address, got %s", testnet)
+	}
+	if err := ValidateAddress(mainnet); !errors.Is(err, ErrWrongNetwork) {
+		t.Errorf("expected a mainnet address to be rejected on testnet, got %v", err)
+	}
+	if err := ValidateAddress(legacyAddress(w)); err != nil {
+		t.Errorf("expected a legacy address to be valid on every network, got %v", err)
+	}
+	ActiveNetwork = Mainnet
+
+	// A single typo is located, and errors are returned, not panics.
+	typo := []byte(mainnet)
+	typo[10] = map[bool]byte{true: 'q', false: 'p'}[typo[10] != 'q']
+	var checksumErr *ChecksumError
+	if err := ValidateAddress(string(typo)); !errors.As(err, &checksumErr) || len(checksumErr.Positions) != 1 || checksumErr.Positions[0] != 10 {
+		t.Errorf("expected the typo at index 10 to be located, got %v", err)
+	}
+	for _, s := range []string{"", "0OIl", "gb1", "gb1qqqqqqqqqqqq", string(typo[:20])} {
+		if err := ValidateAddress(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestLegacyWalletFile(t *testing.T) {
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.Mkdir("tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A file from before bech32m addresses keeps wallets under base58.
+	w := MakeWallet()
+	legacy := legacyAddress(w)
+	ws := &Wallets{Wallets: map[string]*Wallet{legacy: w}}
+	ws.SaveFile("test")
+
+	loaded, err := CreateWallets("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.Wallets[string(w.Address())]; !ok {
+		t.Errorf("expected the wallet to be kept under its bech32m address")
+	}
+	if address, ok := loaded.Lookup(legacy); !ok || address != string(w.Address()) {
+		t.Errorf("expected the legacy address to find the wallet")
+	}
+	if _, ok := loaded.Lookup(string(MakeWallet().Address())); ok {
+		t.Errorf("expected another address not to be found")
+	}
+}
@@ -0,0 +1,114 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Contact is an address of someone else kept in the address book.
+type Contact struct {
+	Label   string
+	Address string
+	Created time.Time
+}
+
+// checkLabel makes sure a label names one address only, so it can be
+// used wherever an address is expected. except is the address of ours
+// being relabelled.
+func (ws *Wallets) checkLabel(label, except string) error {
+	if strings.TrimSpace(label) != label || label == "" {
+		return errors.New("labels cannot be empty or start or end with spaces")
+	}
+	if _, err := ParseAddress(label); err == nil {
+		return errors.New("a label cannot be an address")
+	}
+	for address, w := range ws.Wallets {
+		if w.Label == label && address != except {
+			return fmt.Errorf("label %q is already used by %s", label, address)
+		}
+	}
+	if _, ok := ws.Contacts[label]; ok {
+		return fmt.Errorf("label %q is already used by a contact", label)
+	}
+
+	return nil
+}
+
+// SetLabel labels one of our addresses. An empty label removes it.
+func (ws *Wallets) SetLabel(address, label string) error {
+	address, ok := ws.Lookup(address)
+	if !ok {
+		return errors.New("address is not in the wallet file")
+	}
+	if label != "" {
+		if err := ws.checkLabel(label, address); err != nil {
+			return err
+		}
+	}
+	ws.Wallets[address].Label = label
+
+	return nil
+}
+
+// AddContact adds someone else's address to the address book.
+func (ws *Wallets) AddContact(label, address string) error {
+	if err := ws.checkLabel(label, ""); err != nil {
+		return err
+	}
+	if err := ValidateAddress(address); err != nil {
+		return err
+	}
+	if _, ok := ws.Lookup(address); ok {
+		return errors.New("address is in the wallet file, label it instead")
+	}
+
+	if ws.Contacts == nil {
+		ws.Contacts = make(map[string]*Contact)
+	}
+	ws.Contacts[label] = &Contact{Label: label, Address: address, Created: time.Now()}
+
+	return nil
+}
+
+func (ws *Wallets) RemoveContact(label string) error {
+	if _, ok := ws.Contacts[label]; !ok {
+		return fmt.Errorf("no contact labelled %q", label)
+	}
+	delete(ws.Contacts, label)
+
+	return nil
+}
+
+// GetContacts returns the address book sorted by label.
+func (ws *Wallets) GetContacts() []*Contact {
+	var contacts []*Contact
+	for _, contact := range ws.Contacts {
+		contacts = append(contacts, contact)
+	}
+	sort.Slice(contacts, func(i, j int) bool {
+		return contacts[i].Label < contacts[j].Label
+	})
+
+	return contacts
+}
+
+// Resolve returns the address a label of ours or of a contact names, or
+// the address itself when given one.
+func (ws *Wallets) Resolve(name string) (string, error) {
+	if _, err := ParseAddress(name); err == nil {
+		return name, ValidateAddress(name)
+	}
+	for address, w := range ws.Wallets {
+		if w.Label == name {
+			return address, nil
+		}
+	}
+	if contact, ok := ws.Contacts[name]; ok {
+		return contact.Address, ValidateAddress(contact.Address)
+	}
+
+	return "", fmt.Errorf("%q is neither a valid address nor a label", name)
+}
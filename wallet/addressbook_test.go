@@ -0,0 +1,114 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestLabelsAndContacts(t *testing.T) {
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.Mkdir("tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ws := &Wallets{Wallets: make(map[string]*Wallet)}
+	savings := ws.AddWallet()
+	spending := ws.AddWallet()
+	friend := string(MakeWallet().Address())
+
+	if err := ws.SetLabel(savings, "savings"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.SetLabel(spending, "savings"); err == nil {
+		t.Errorf("expected a label to name one address only")
+	}
+	if err := ws.SetLabel(spending, friend); err == nil {
+		t.Errorf("expected an address not to be a label")
+	}
+	if err := ws.AddContact("alice", friend); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct{ label, address string }{
+		{"savings", string(MakeWallet().Address())},
+		{"bob", "not an address"},
+		{"bob", savings},
+		{" bob", string(MakeWallet().Address())},
+	} {
+		if err := ws.AddContact(c.label, c.address); err == nil {
+			t.Errorf("expected contact %q at %q to be rejected", c.label, c.address)
+		}
+	}
+
+	for name, want := range map[string]string{"savings": savings, "alice": friend, spending: spending} {
+		if got, err := ws.Resolve(name); err != nil || got != want {
+			t.Errorf("%s: resolved to %s, %v", name, got, err)
+		}
+	}
+	if _, err := ws.Resolve("carol"); err == nil {
+		t.Errorf("expected an unknown label to be an error")
+	}
+
+	// Importing the key of a labelled watched address keeps the label.
+	cold := MakeWallet()
+	watched, _ := ws.ImportAddress(string(cold.Address()))
+	ws.SetLabel(watched, "cold")
+	created := ws.Wallets[watched].Created
+	if _, err := ws.ImportWallet(cold); err != nil {
+		t.Fatal(err)
+	}
+	if w := ws.Wallets[watched]; w.Label != "cold" || !w.Created.Equal(created) || w.WatchOnly {
+		t.Errorf("expected the imported key to keep the label and creation time")
+	}
+
+	ws.SaveFile("test")
+	loaded, err := CreateWallets("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Version != walletFileVersion || loaded.Wallets[savings].Label != "savings" || loaded.Contacts["alice"].Address != friend {
+		t.Errorf("expected labels and contacts to be saved")
+	}
+	if addresses := loaded.GetAllAddresses(); addresses[0] != savings || addresses[1] != spending {
+		t.Errorf("expected addresses oldest first, got %v", addresses)
+	}
+	if err := loaded.RemoveContact("alice"); err != nil || loaded.RemoveContact("alice") == nil {
+		t.Errorf("expected a contact to be removed once")
+	}
+}
+
+func TestNewerWalletFileVersion(t *testing.T) {
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.Mkdir("tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var content bytes.Buffer
+	if err := gob.NewEncoder(&content).Encode(&Wallets{Version: walletFileVersion + 1, Wallets: map[string]*Wallet{}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fmt.Sprintf(walletFile, "test"), content.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ws, err := CreateWallets("test")
+	if err == nil {
+		t.Fatalf("expected a newer wallet file to be refused")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected saving over a newer wallet file to panic")
+		}
+	}()
+	ws.SaveFile("test")
+}
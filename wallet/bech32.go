@@ -0,0 +1,198 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The bech32m encoding of BIP 350: a human-readable prefix, the separator
+// 1 and data in a 32 character alphabet ending with a 6 character BCH
+// checksum. The checksum detects any error in up to 4 characters, and a
+// single mistyped character can be located.
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+const (
+	bech32mConst      = 0x2bc830a3
+	bech32ChecksumLen = 6
+	bech32MaxLength   = 90
+	bech32Separator   = '1'
+)
+
+var bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+// ChecksumError is a bech32 string with a checksum that does not match.
+// Positions holds the index of a single mistyped character that would fix
+// it, if there is one.
+type ChecksumError struct {
+	Positions []int
+}
+
+func (e *ChecksumError) Error() string {
+	if len(e.Positions) == 0 {
+		return "invalid checksum"
+	}
+
+	return fmt.Sprintf("invalid checksum, check the character at position %d", e.Positions[0]+1)
+}
+
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= bech32Generator[i]
+			}
+		}
+	}
+
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	expanded := make([]byte, 0, 2*len(hrp)+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+
+	return expanded
+}
+
+func bech32Checksum(hrp string, data []byte) []byte {
+	values := append(bech32HRPExpand(hrp), data...)
+	values = append(values, make([]byte, bech32ChecksumLen)...)
+	mod := bech32Polymod(values) ^ bech32mConst
+
+	checksum := make([]byte, bech32ChecksumLen)
+	for i := range checksum {
+		checksum[i] = byte(mod>>(5*(5-i))) & 31
+	}
+
+	return checksum
+}
+
+func bech32Verify(hrp string, data []byte) bool {
+	return bech32Polymod(append(bech32HRPExpand(hrp), data...)) == bech32mConst
+}
+
+// EncodeBech32 encodes 5 bit values under a lowercase prefix.
+func EncodeBech32(hrp string, data []byte) (string, error) {
+	if len(hrp)+1+len(data)+bech32ChecksumLen > bech32MaxLength {
+		return "", errors.New("bech32 string too long")
+	}
+
+	var s strings.Builder
+	s.WriteString(hrp)
+	s.WriteByte(bech32Separator)
+	values := append(append([]byte{}, data...), bech32Checksum(hrp, data)...)
+	for _, v := range values {
+		if v > 31 {
+			return "", errors.New("bech32 data value out of range")
+		}
+		s.WriteByte(bech32Charset[v])
+	}
+
+	return s.String(), nil
+}
+
+// DecodeBech32 splits a bech32m string into its lowercase prefix and its 5
+// bit values without the checksum. A checksum mismatch is a ChecksumError.
+func DecodeBech32(s string) (string, []byte, error) {
+	if len(s) > bech32MaxLength {
+		return "", nil, errors.New("bech32 string too long")
+	}
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, errors.New("bech32 string mixes upper and lower case")
+	}
+	s = strings.ToLower(s)
+
+	sep := strings.LastIndexByte(s, bech32Separator)
+	if sep < 1 || len(s)-sep-1 < bech32ChecksumLen {
+		return "", nil, errors.New("bech32 string has no prefix or is too short")
+	}
+	hrp := s[:sep]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, fmt.Errorf("invalid prefix character at position %d", i+1)
+		}
+	}
+
+	data := make([]byte, 0, len(s)-sep-1)
+	for i := sep + 1; i < len(s); i++ {
+		v := strings.IndexByte(bech32Charset, s[i])
+		if v < 0 {
+			return "", nil, fmt.Errorf("invalid character %q at position %d", s[i], i+1)
+		}
+		data = append(data, byte(v))
+	}
+
+	if !bech32Verify(hrp, data) {
+		return "", nil, &ChecksumError{Positions: locateBech32Error(hrp, data, sep+1)}
+	}
+
+	return hrp, data[:len(data)-bech32ChecksumLen], nil
+}
+
+// locateBech32Error returns the position of the one data character that,
+// changed, makes the checksum valid, trying every substitution. offset is
+// the position of the first data character.
+func locateBech32Error(hrp string, data []byte, offset int) []int {
+	var positions []int
+	fixed := make([]byte, len(data))
+	for i := range data {
+		copy(fixed, data)
+		for v := byte(0); v < 32; v++ {
+			if v == data[i] {
+				continue
+			}
+			fixed[i] = v
+			if bech32Verify(hrp, fixed) {
+				positions = append(positions, offset+i)
+				break
+			}
+		}
+	}
+	// More than one fix means the mistake is not a single character.
+	if len(positions) != 1 {
+		return nil
+	}
+
+	return positions
+}
+
+// convertBits regroups values of fromBits bits into values of toBits bits.
+// With pad set, leftover bits are padded with zeros; without it they must
+// be zero padding of fewer than fromBits bits.
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var out []byte
+	acc, bits := uint32(0), uint(0)
+	maxv := uint32(1)<<toBits - 1
+	for _, v := range data {
+		if uint32(v)>>fromBits != 0 {
+			return nil, errors.New("value out of range")
+		}
+		acc = acc<<fromBits | uint32(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil, errors.New("invalid padding")
+	}
+
+	return out, nil
+}
@@ -0,0 +1,282 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/gob"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2id parameters for new wallet files, the second recommended option of
+// RFC 9106. They are stored in the file so they can be raised later.
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024 // KiB
+	argonThreads = 4
+	argonKeyLen  = 32
+	saltLength   = 16
+)
+
+var (
+	ErrWrongPassphrase = errors.New("wrong wallet passphrase")
+	ErrWalletLocked    = errors.New("wallet is locked, unlock it with its passphrase")
+	ErrNotEncrypted    = errors.New("wallet file is not encrypted")
+)
+
+// EncryptedSecrets is the seed and private keys of a wallet file sealed
+// with AES-256-GCM under a key derived from the passphrase with Argon2id.
+type EncryptedSecrets struct {
+	Salt       []byte
+	Time       uint32
+	Memory     uint32
+	Threads    uint8
+	Nonce      []byte
+	Ciphertext []byte
+	// HasSeed tells whether a seed is sealed, so a locked wallet knows it
+	// is an HD wallet.
+	HasSeed bool
+}
+
+// secrets is what gets sealed: the seed and the private key of every
+// address.
+type secrets struct {
+	Seed []byte
+	Keys map[string][]byte
+}
+
+func (e *EncryptedSecrets) deriveKey(passphrase string) []byte {
+	return argon2.IDKey([]byte(passphrase), e.Salt, e.Time, e.Memory, e.Threads, argonKeyLen)
+}
+
+func (e *EncryptedSecrets) seal(key []byte, s secrets) error {
+	var plaintext bytes.Buffer
+	if err := gob.NewEncoder(&plaintext).Encode(s); err != nil {
+		return err
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	e.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(e.Nonce); err != nil {
+		return err
+	}
+	e.Ciphertext = aead.Seal(nil, e.Nonce, plaintext.Bytes(), nil)
+	e.HasSeed = len(s.Seed) > 0
+
+	return nil
+}
+
+func (e *EncryptedSecrets) open(key []byte) (secrets, error) {
+	var s secrets
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return s, err
+	}
+	plaintext, err := aead.Open(nil, e.Nonce, e.Ciphertext, nil)
+	if err != nil {
+		return s, ErrWrongPassphrase
+	}
+	err = gob.NewDecoder(bytes.NewReader(plaintext)).Decode(&s)
+
+	return s, err
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func newEncryptedSecrets() (*EncryptedSecrets, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	return &EncryptedSecrets{Salt: salt, Time: argonTime, Memory: argonMemory, Threads: argonThreads}, nil
+}
+
+func (ws *Wallets) IsEncrypted() bool {
+	return ws.Crypto != nil
+}
+
+// IsLocked reports whether the private keys of an encrypted wallet file are
+// unavailable.
+func (ws *Wallets) IsLocked() bool {
+	ws.expire()
+
+	return ws.Crypto != nil && ws.key == nil
+}
+
+// expire locks the wallet once the timeout given to Unlock has passed. It is
+// checked whenever the keys are about to be used, rather than on a timer, so
+// the wallet is never changed behind its user's back.
+func (ws *Wallets) expire() {
+	if !ws.lockAt.IsZero() && !time.Now().Before(ws.lockAt) {
+		ws.Lock()
+	}
+}
+
+// UnlockedUntil returns when an unlocked wallet locks itself, or the zero
+// time if it stays unlocked until Lock.
+func (ws *Wallets) UnlockedUntil() time.Time {
+	return ws.lockAt
+}
+
+func (ws *Wallets) secrets() secrets {
+	s := secrets{Seed: ws.Seed, Keys: make(map[string][]byte)}
+	for address, w := range ws.Wallets {
+		if w.PrivateKey != nil {
+			s.Keys[address] = w.PrivateKey
+		}
+	}
+
+	return s
+}
+
+// Encrypt seals the seed and private keys of a plaintext wallet file with
+// the passphrase and locks it. Save the file to write it encrypted.
+func (ws *Wallets) Encrypt(passphrase string) error {
+	if ws.IsEncrypted() {
+		return errors.New("wallet file is already encrypted")
+	}
+	if passphrase == "" {
+		return errors.New("empty passphrase")
+	}
+
+	crypto, err := newEncryptedSecrets()
+	if err != nil {
+		return err
+	}
+	if err := crypto.seal(crypto.deriveKey(passphrase), ws.secrets()); err != nil {
+		return err
+	}
+	ws.Crypto = crypto
+	ws.Lock()
+
+	return nil
+}
+
+// Unlock decrypts the seed and private keys of an encrypted wallet file.
+// With a positive timeout the wallet locks itself again once it passes, the
+// next time its keys are asked for.
+func (ws *Wallets) Unlock(passphrase string, timeout time.Duration) error {
+	if !ws.IsEncrypted() {
+		return ErrNotEncrypted
+	}
+
+	if err := ws.unlockWithKey(ws.Crypto.deriveKey(passphrase)); err != nil {
+		return err
+	}
+
+	ws.lockAt = time.Time{}
+	if timeout > 0 {
+		ws.lockAt = time.Now().Add(timeout)
+	}
+
+	return nil
+}
+
+func (ws *Wallets) unlockWithKey(key []byte) error {
+	s, err := ws.Crypto.open(key)
+	if err != nil {
+		return err
+	}
+
+	ws.key = key
+	ws.Seed = s.Seed
+	for address, private := range s.Keys {
+		if address, ok := ws.Lookup(address); ok {
+			ws.Wallets[address].PrivateKey = private
+		}
+	}
+	// Addresses derived while locked only have their public key yet.
+	for _, w := range ws.Wallets {
+		if w.PrivateKey == nil && !w.WatchOnly && w.Path != "" && len(ws.Seed) > 0 {
+			key, err := ws.deriveKey(w.Path)
+			if err != nil {
+				return err
+			}
+			w.PrivateKey = key.Key
+		}
+	}
+
+	return nil
+}
+
+// Reload reads the wallet file again, for a process that keeps it open
+// while commands add addresses to it. An unlocked wallet stays unlocked
+// until the same time, unless the passphrase was changed meanwhile.
+func (ws *Wallets) Reload(nodeId string) error {
+	fresh, err := CreateWallets(nodeId)
+	if err != nil {
+		return err
+	}
+	if fresh.IsEncrypted() && ws.IsEncrypted() && !ws.IsLocked() {
+		if fresh.unlockWithKey(append([]byte{}, ws.key...)) == nil {
+			fresh.lockAt = ws.lockAt
+		}
+	}
+
+	ws.Lock()
+	*ws = *fresh
+
+	return nil
+}
+
+// Lock forgets the decrypted seed and private keys of an encrypted wallet
+// file. It does nothing to a plaintext one.
+func (ws *Wallets) Lock() {
+	if !ws.IsEncrypted() {
+		return
+	}
+
+	wipe(ws.key)
+	wipe(ws.Seed)
+	ws.key, ws.Seed = nil, nil
+	for _, w := range ws.Wallets {
+		wipe(w.PrivateKey)
+		w.PrivateKey = nil
+	}
+	ws.lockAt = time.Time{}
+}
+
+// ChangePassphrase encrypts the wallet file's secrets under a new passphrase
+// and a new salt. The wallet is left locked.
+func (ws *Wallets) ChangePassphrase(old, passphrase string) error {
+	if passphrase == "" {
+		return errors.New("empty passphrase")
+	}
+	if err := ws.Unlock(old, 0); err != nil {
+		return err
+	}
+	defer ws.Lock()
+
+	crypto, err := newEncryptedSecrets()
+	if err != nil {
+		return err
+	}
+	if err := crypto.seal(crypto.deriveKey(passphrase), ws.secrets()); err != nil {
+		return err
+	}
+	ws.Crypto = crypto
+
+	return nil
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,166 @@
+package wallet
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEncryptedWalletFile(t *testing.T) {
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.Mkdir("tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ws := &Wallets{Wallets: make(map[string]*Wallet)}
+	if err := ws.SetSeed(bytes.Repeat([]byte{2}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	address, _ := ws.DeriveAddress(0, ExternalChain)
+	random := ws.AddWallet()
+	private := append([]byte{}, ws.Wallets[random].PrivateKey...)
+
+	// A plaintext file from before encryption is made private on load.
+	ws.SaveFile("test")
+	file := fmt.Sprintf(walletFile, "test")
+	if err := os.Chmod(file, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateWallets("test"); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(file); info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600, got %v", info.Mode().Perm())
+	}
+
+	if err := ws.Encrypt("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	if !ws.IsLocked() || ws.Wallets[random].PrivateKey != nil || ws.Seed != nil {
+		t.Fatalf("expected the wallet to be locked after encrypting")
+	}
+	ws.SaveFile("test")
+
+	content, _ := os.ReadFile(file)
+	if bytes.Contains(content, private) || bytes.Contains(content, bytes.Repeat([]byte{2}, 32)) {
+		t.Errorf("expected no plaintext key material in the file")
+	}
+
+	loaded, err := CreateWallets("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.IsLocked() || !loaded.HasSeed() {
+		t.Fatalf("expected a locked HD wallet file")
+	}
+	if err := loaded.SetSeed(bytes.Repeat([]byte{3}, 32)); err == nil {
+		t.Errorf("expected a locked wallet to keep its seed")
+	}
+	if err := loaded.Unlock("wrong", 0); err != ErrWrongPassphrase {
+		t.Errorf("expected ErrWrongPassphrase, got %v", err)
+	}
+
+	// Addresses of an existing account are derived while locked, and get
+	// their private key on unlock.
+	next, err := loaded.DeriveAddress(0, ExternalChain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Wallets[next].PrivateKey != nil {
+		t.Errorf("expected no private key while locked")
+	}
+	if _, err := loaded.Account(1); err != ErrWalletLocked {
+		t.Errorf("expected a new account to need the passphrase, got %v", err)
+	}
+
+	if err := loaded.Unlock("correct horse", 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded.Wallets[random].PrivateKey, private) || loaded.Wallets[address].PrivateKey == nil {
+		t.Errorf("expected unlocking to restore the private keys")
+	}
+	key, _ := loaded.deriveKey(loaded.Wallets[next].Path)
+	if !bytes.Equal(loaded.Wallets[next].PrivateKey, key.Key) {
+		t.Errorf("expected the address derived while locked to get its private key")
+	}
+
+	if err := loaded.ChangePassphrase("wrong", "battery staple"); err != ErrWrongPassphrase {
+		t.Errorf("expected ErrWrongPassphrase, got %v", err)
+	}
+	if err := loaded.ChangePassphrase("correct horse", "battery staple"); err != nil {
+		t.Fatal(err)
+	}
+	loaded.SaveFile("test")
+
+	reloaded, _ := CreateWallets("test")
+	if err := reloaded.Unlock("correct horse", 0); err != ErrWrongPassphrase {
+		t.Errorf("expected the old passphrase to stop working, got %v", err)
+	}
+	if err := reloaded.Unlock("battery staple", 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Wallets[next].PrivateKey == nil {
+		t.Errorf("expected the derived address's key to be sealed")
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if reloaded.GetWallet(random).PrivateKey != nil || !reloaded.IsLocked() {
+		t.Errorf("expected the wallet to lock itself after the timeout")
+	}
+}
+
+func TestReloadKeepsWalletUnlocked(t *testing.T) {
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.Mkdir("tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ws := &Wallets{Wallets: make(map[string]*Wallet)}
+	ws.AddWallet()
+	if err := ws.Encrypt("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	ws.SaveFile("test")
+
+	node, _ := CreateWallets("test")
+	if err := node.Unlock("correct horse", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	until := node.UnlockedUntil()
+
+	// Another process adds an address while the node holds the file.
+	other, _ := CreateWallets("test")
+	if err := other.Unlock("correct horse", 0); err != nil {
+		t.Fatal(err)
+	}
+	added := other.AddWallet()
+	other.SaveFile("test")
+
+	if err := node.Reload("test"); err != nil {
+		t.Fatal(err)
+	}
+	if node.IsLocked() || node.GetWallet(added).PrivateKey == nil || !node.UnlockedUntil().Equal(until) {
+		t.Errorf("expected the reloaded wallet to stay unlocked with the new address's key")
+	}
+
+	if err := other.ChangePassphrase("correct horse", "battery staple"); err != nil {
+		t.Fatal(err)
+	}
+	other.SaveFile("test")
+	if err := node.Reload("test"); err != nil {
+		t.Fatal(err)
+	}
+	if !node.IsLocked() {
+		t.Errorf("expected a changed passphrase to lock the reloaded wallet")
+	}
+}
@@ -0,0 +1,160 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// privateKeyVersion starts every exported private key, so the text form
+// cannot be mistaken for an address.
+const privateKeyVersion = 0x80
+
+const privateKeyLength = 32
+
+// legacyKeyFlag follows the key of a P-256 wallet made before key types
+// existed, whose address hashes the untagged public key.
+const legacyKeyFlag = 0x01
+
+var ErrInvalidPrivateKey = errors.New("invalid private key")
+
+// ExportPrivateKey encodes the wallet's private key as text, in the manner of
+// Bitcoin's WIF: base58 of the version byte, the key type, the 32 byte key,
+// legacyKeyFlag for a legacy P-256 wallet and a checksum.
+func ExportPrivateKey(w *Wallet) (string, error) {
+	// Legacy wallets stored the P-256 scalar without its leading zeros.
+	if len(w.PrivateKey) == 0 || len(w.PrivateKey) > privateKeyLength ||
+		(w.KeyType != KeyTypeP256 && len(w.PrivateKey) != privateKeyLength) {
+		return "", ErrInvalidPrivateKey
+	}
+	key := make([]byte, privateKeyLength)
+	copy(key[privateKeyLength-len(w.PrivateKey):], w.PrivateKey)
+
+	payload := append([]byte{privateKeyVersion, byte(w.KeyType)}, key...)
+	if w.hasLegacyPublicKey() {
+		payload = append(payload, legacyKeyFlag)
+	}
+
+	return string(Base58Encode(append(payload, Checksum(payload)...))), nil
+}
+
+// ImportPrivateKey decodes a key written by ExportPrivateKey into a wallet.
+func ImportPrivateKey(s string) (*Wallet, error) {
+	data, err := Base58Decode([]byte(s))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPrivateKey, err)
+	}
+	if len(data) < 2+privateKeyLength+checksumLength || len(data) > 3+privateKeyLength+checksumLength ||
+		data[0] != privateKeyVersion {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	payload, checksum := data[:len(data)-checksumLength], data[len(data)-checksumLength:]
+	if !bytes.Equal(Checksum(payload), checksum) {
+		return nil, fmt.Errorf("%w: bad checksum", ErrInvalidPrivateKey)
+	}
+
+	w, err := walletFromPrivateKey(KeyType(payload[1]), payload[2:2+privateKeyLength])
+	if err != nil || len(payload) == 2+privateKeyLength {
+		return w, err
+	}
+	if payload[len(payload)-1] != legacyKeyFlag || w.KeyType != KeyTypeP256 {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	return LegacyP256Wallet(w)
+}
+
+// LegacyP256Wallet returns the wallet of the same P-256 key with the
+// untagged public key of wallets made before key types existed, which has
+// another address.
+func LegacyP256Wallet(w *Wallet) (*Wallet, error) {
+	signer, err := NewSigningKey(KeyTypeP256, w.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPrivateKey, err)
+	}
+	key := signer.(p256Key).key
+
+	return &Wallet{
+		PrivateKey: append([]byte{}, w.PrivateKey...),
+		PublicKey:  legacyP256PublicKey(key.X, key.Y),
+		KeyType:    KeyTypeP256,
+	}, nil
+}
+
+// MarshalPrivateKeyPEM encodes the wallet's private key as a PKCS #8
+// "PRIVATE KEY" PEM block, which OpenSSL and most libraries read.
+func MarshalPrivateKeyPEM(w *Wallet) ([]byte, error) {
+	var key interface{}
+	switch w.KeyType {
+	case KeyTypeP256:
+		signer, err := NewSigningKey(w.KeyType, w.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		key = signer.(p256Key).key
+	case KeyTypeEd25519:
+		if len(w.PrivateKey) != ed25519.SeedSize {
+			return nil, ErrInvalidPrivateKey
+		}
+		key = ed25519.NewKeyFromSeed(w.PrivateKey)
+	default:
+		return nil, fmt.Errorf("unknown key type %s", w.KeyType)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParsePrivateKeyPEM reads a P-256 or Ed25519 key from a PKCS #8 "PRIVATE
+// KEY" or SEC 1 "EC PRIVATE KEY" PEM block into a wallet.
+func ParsePrivateKeyPEM(data []byte) (*Wallet, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM block found", ErrInvalidPrivateKey)
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: unsupported PEM block %q", ErrInvalidPrivateKey, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPrivateKey, err)
+	}
+
+	switch key := key.(type) {
+	case *ecdsa.PrivateKey:
+		if key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%w: curve %s is not supported", ErrInvalidPrivateKey, key.Curve.Params().Name)
+		}
+		return walletFromPrivateKey(KeyTypeP256, key.D.FillBytes(make([]byte, privateKeyLength)))
+	case ed25519.PrivateKey:
+		return walletFromPrivateKey(KeyTypeEd25519, key.Seed())
+	}
+
+	return nil, fmt.Errorf("%w: unsupported key algorithm %T", ErrInvalidPrivateKey, key)
+}
+
+func walletFromPrivateKey(keyType KeyType, private []byte) (*Wallet, error) {
+	signer, err := NewSigningKey(keyType, private)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPrivateKey, err)
+	}
+
+	return &Wallet{PrivateKey: append([]byte{}, private...), PublicKey: signer.PublicKey(), KeyType: keyType}, nil
+}
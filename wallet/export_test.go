@@ -0,0 +1,142 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+func TestExportImportPrivateKey(t *testing.T) {
+	for _, keyType := range []KeyType{KeyTypeP256, KeyTypeEd25519} {
+		w, err := MakeWalletOfType(keyType)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		text, err := ExportPrivateKey(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		imported, err := ImportPrivateKey(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(imported.Address()) != string(w.Address()) {
+			t.Errorf("%s: imported key has a different address", keyType)
+		}
+
+		data, err := MarshalPrivateKeyPEM(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		imported, err = ParsePrivateKeyPEM(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(imported.Address()) != string(w.Address()) {
+			t.Errorf("%s: PEM key has a different address", keyType)
+		}
+
+		// Other tools must read the PEM block as a standard PKCS #8 key.
+		block, _ := pem.Decode(data)
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch key.(type) {
+		case *ecdsa.PrivateKey, ed25519.PrivateKey:
+		default:
+			t.Errorf("%s: unexpected key %T", keyType, key)
+		}
+	}
+}
+
+func TestImportPrivateKeyRejectsMistakes(t *testing.T) {
+	w := MakeWallet()
+	text, _ := ExportPrivateKey(w)
+
+	typo := []byte(text)
+	if typo[10] == 'a' {
+		typo[10] = 'b'
+	} else {
+		typo[10] = 'a'
+	}
+	for _, bad := range []string{string(typo), text[:len(text)-1], string(w.Address()), "0OIl"} {
+		if _, err := ImportPrivateKey(bad); !errors.Is(err, ErrInvalidPrivateKey) {
+			t.Errorf("expected %q to be rejected, got %v", bad, err)
+		}
+	}
+}
+
+// makeLegacyWallet makes a P-256 wallet the way wallets were made before
+// key types existed: the scalar and the X||Y public key without their
+// leading zero bytes. The scalar is kept short to show that form.
+func makeLegacyWallet(t *testing.T) *Wallet {
+	t.Helper()
+
+	private := make([]byte, privateKeyLength-1)
+	if _, err := rand.Read(private); err != nil {
+		t.Fatal(err)
+	}
+	private[0] |= 0x01
+	x, y := elliptic.P256().ScalarBaseMult(private)
+
+	return &Wallet{PrivateKey: private, PublicKey: append(x.Bytes(), y.Bytes()...), KeyType: KeyTypeP256}
+}
+
+func TestExportImportLegacyPrivateKey(t *testing.T) {
+	w := makeLegacyWallet(t)
+
+	text, err := ExportPrivateKey(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ImportPrivateKey(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(imported.Address()) != string(w.Address()) || !bytes.Equal(imported.PublicKey, w.PublicKey) {
+		t.Errorf("expected the imported key to keep the legacy public key and address")
+	}
+
+	// The key of a tagged wallet must not come back legacy.
+	tagged, _ := walletFromPrivateKey(KeyTypeP256, imported.PrivateKey)
+	text, _ = ExportPrivateKey(tagged)
+	if imported, err := ImportPrivateKey(text); err != nil || string(imported.Address()) != string(tagged.Address()) {
+		t.Errorf("expected a tagged key to keep its address, got %v", err)
+	}
+
+	legacy, err := LegacyP256Wallet(tagged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(legacy.Address()) != string(w.Address()) {
+		t.Errorf("expected LegacyP256Wallet to give the legacy address")
+	}
+}
+
+func TestImportSEC1PrivateKey(t *testing.T) {
+	w := MakeWallet()
+	signer, err := w.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(signer.(p256Key).key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := ParsePrivateKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(imported.Address()) != string(w.Address()) {
+		t.Errorf("SEC 1 key has a different address")
+	}
+}
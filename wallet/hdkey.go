@@ -0,0 +1,295 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// HardenedKeyStart is the first hardened child index. Hardened children can
+// only be derived from a private key.
+const HardenedKeyStart uint32 = 0x80000000
+
+// masterKeySalt is the HMAC key turning a seed into a master key, as in
+// SLIP-0010, the BIP32 variant for NIST P-256.
+var masterKeySalt = []byte("Nist256p1 seed")
+
+// Version bytes of serialized extended keys.
+var (
+	extendedPrivateVersion = []byte{0x04, 0x3d, 0x9c, 0x51}
+	extendedPublicVersion  = []byte{0x04, 0x3d, 0x9c, 0x52}
+)
+
+const extendedKeyLength = 4 + 1 + 4 + 4 + 32 + 33
+
+var ErrHardenedFromPublic = errors.New("cannot derive a hardened child from a public key")
+
+// ExtendedKey is a node of a BIP32-style tree of P-256 keys. A private
+// extended key derives every child; a public one only non-hardened children,
+// which lets a watch-only wallet find the addresses of an account without
+// its private keys.
+type ExtendedKey struct {
+	// Key is the 32 byte private scalar, or the compressed public key.
+	Key         []byte
+	ChainCode   []byte
+	Depth       byte
+	Fingerprint []byte // of the parent
+	Index       uint32
+	private     bool
+}
+
+// NewMasterKey derives the root of the key tree from a seed of 16 to 64
+// bytes.
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("seed must be 16 to 64 bytes, not %d", len(seed))
+	}
+
+	curve := elliptic.P256()
+	data := seed
+	for {
+		mac := hmac.New(sha512.New, masterKeySalt)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+
+		k := new(big.Int).SetBytes(sum[:32])
+		if k.Sign() != 0 && k.Cmp(curve.Params().N) < 0 {
+			return &ExtendedKey{sum[:32], sum[32:], 0, []byte{0, 0, 0, 0}, 0, true}, nil
+		}
+		data = sum
+	}
+}
+
+func (k *ExtendedKey) IsPrivate() bool {
+	return k.private
+}
+
+// publicKey returns the compressed public key.
+func (k *ExtendedKey) publicKey() []byte {
+	if !k.private {
+		return k.Key
+	}
+
+	curve := elliptic.P256()
+	x, y := curve.ScalarBaseMult(k.Key)
+
+	return elliptic.MarshalCompressed(curve, x, y)
+}
+
+// Child derives the child key at index, hardened from HardenedKeyStart.
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	hardened := index >= HardenedKeyStart
+	if hardened && !k.private {
+		return nil, ErrHardenedFromPublic
+	}
+
+	var data []byte
+	if hardened {
+		data = append([]byte{0}, k.Key...)
+	} else {
+		data = append([]byte{}, k.publicKey()...)
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	curve := elliptic.P256()
+	n := curve.Params().N
+	child := &ExtendedKey{
+		Depth:       k.Depth + 1,
+		Fingerprint: PublicKeyHash(k.publicKey())[:4],
+		Index:       index,
+		private:     k.private,
+	}
+
+	// An invalid key, with odds of about 2^-127, is skipped by hashing
+	// again from the right half, as SLIP-0010 does.
+	for {
+		mac := hmac.New(sha512.New, k.ChainCode)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		il := new(big.Int).SetBytes(sum[:32])
+		child.ChainCode = sum[32:]
+
+		if il.Cmp(n) < 0 {
+			if k.private {
+				key := il.Add(il, new(big.Int).SetBytes(k.Key))
+				key.Mod(key, n)
+				if key.Sign() != 0 {
+					child.Key = key.FillBytes(make([]byte, 32))
+					return child, nil
+				}
+			} else {
+				px, py := elliptic.UnmarshalCompressed(curve, k.Key)
+				x, y := curve.ScalarBaseMult(sum[:32])
+				x, y = curve.Add(x, y, px, py)
+				if x.Sign() != 0 || y.Sign() != 0 {
+					child.Key = elliptic.MarshalCompressed(curve, x, y)
+					return child, nil
+				}
+			}
+		}
+
+		data = binary.BigEndian.AppendUint32(append([]byte{1}, sum[32:]...), index)
+	}
+}
+
+// Derive follows a path such as m/0'/1/5 from the key, which must be the
+// master key if the path starts with m.
+func (k *ExtendedKey) Derive(path string) (*ExtendedKey, error) {
+	indices, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(path, "m") && k.Depth != 0 {
+		return nil, errors.New("absolute path needs the master key")
+	}
+
+	key := k
+	for _, index := range indices {
+		if key, err = key.Child(index); err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+// ParsePath parses a derivation path like m/0'/1/5, where ' or h marks a
+// hardened index.
+func ParsePath(path string) ([]uint32, error) {
+	var indices []uint32
+
+	parts := strings.Split(path, "/")
+	if parts[0] == "m" {
+		parts = parts[1:]
+	}
+	for _, part := range parts {
+		offset := uint32(0)
+		if strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h") {
+			offset = HardenedKeyStart
+			part = part[:len(part)-1]
+		}
+
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || uint32(index) >= HardenedKeyStart {
+			return nil, fmt.Errorf("invalid path element %q in %q", part, path)
+		}
+		indices = append(indices, uint32(index)+offset)
+	}
+
+	return indices, nil
+}
+
+// FormatPath is the inverse of ParsePath.
+func FormatPath(indices []uint32) string {
+	path := "m"
+	for _, index := range indices {
+		if index >= HardenedKeyStart {
+			path += fmt.Sprintf("/%d'", index-HardenedKeyStart)
+		} else {
+			path += fmt.Sprintf("/%d", index)
+		}
+	}
+
+	return path
+}
+
+// Neuter returns the public extended key, which derives the same public
+// keys for non-hardened paths.
+func (k *ExtendedKey) Neuter() *ExtendedKey {
+	if !k.private {
+		return k
+	}
+
+	return &ExtendedKey{k.publicKey(), k.ChainCode, k.Depth, k.Fingerprint, k.Index, false}
+}
+
+// Wallet returns the wallet holding the key. The wallet of a public
+// extended key has no private key.
+func (k *ExtendedKey) Wallet() *Wallet {
+	curve := elliptic.P256()
+	x, y := elliptic.UnmarshalCompressed(curve, k.publicKey())
+
+	pub := make([]byte, p256PublicKeyLength)
+	x.FillBytes(pub[:32])
+	y.FillBytes(pub[32:])
+
+	w := &Wallet{PublicKey: tagPublicKey(KeyTypeP256, pub), KeyType: KeyTypeP256}
+	if k.private {
+		w.PrivateKey = append([]byte{}, k.Key...)
+	}
+
+	return w
+}
+
+// String serializes the key in base58 with a checksum.
+func (k *ExtendedKey) String() string {
+	var data bytes.Buffer
+
+	if k.private {
+		data.Write(extendedPrivateVersion)
+	} else {
+		data.Write(extendedPublicVersion)
+	}
+	data.WriteByte(k.Depth)
+	data.Write(k.Fingerprint)
+	data.Write(binary.BigEndian.AppendUint32(nil, k.Index))
+	data.Write(k.ChainCode)
+	if k.private {
+		data.WriteByte(0)
+	}
+	data.Write(k.Key)
+
+	payload := data.Bytes()
+
+	return string(Base58Encode(append(payload, Checksum(payload)...)))
+}
+
+// ParseExtendedKey parses a key serialized by String.
+func ParseExtendedKey(s string) (*ExtendedKey, error) {
+	data, err := Base58Decode([]byte(s))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != extendedKeyLength+checksumLength {
+		return nil, errors.New("invalid extended key length")
+	}
+
+	payload, checksum := data[:extendedKeyLength], data[extendedKeyLength:]
+	if !bytes.Equal(Checksum(payload), checksum) {
+		return nil, errors.New("invalid extended key checksum")
+	}
+
+	k := &ExtendedKey{
+		Depth:       payload[4],
+		Fingerprint: payload[5:9],
+		Index:       binary.BigEndian.Uint32(payload[9:13]),
+		ChainCode:   payload[13:45],
+	}
+	key := payload[45:]
+
+	curve := elliptic.P256()
+	switch {
+	case bytes.Equal(payload[:4], extendedPrivateVersion) && key[0] == 0:
+		d := new(big.Int).SetBytes(key[1:])
+		if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+			return nil, errors.New("invalid extended private key")
+		}
+		k.Key, k.private = key[1:], true
+	case bytes.Equal(payload[:4], extendedPublicVersion):
+		if x, _ := elliptic.UnmarshalCompressed(curve, key); x == nil {
+			return nil, errors.New("invalid extended public key")
+		}
+		k.Key = key
+	default:
+		return nil, errors.New("unknown extended key version")
+	}
+
+	return k, nil
+}
@@ -0,0 +1,206 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"testing"
+)
+
+// SLIP-0010 test vector 1 for nist256p1.
+func TestExtendedKeyVectors(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, err := NewMasterKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path, chainCode, private, public string
+	}{
+		{"m", "beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea", "612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2", "0266874dc6ade47b3ecd096745ca09bcd29638dd52c2c12117b11ed3e458cfa9e8"},
+		{"m/0'", "3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11", "6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c", "0384610f5ecffe8fda089363a41f56a5c7ffc1d81b59a612d0d649b2d22355590c"},
+	}
+
+	for _, test := range tests {
+		key, err := master.Derive(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(key.ChainCode); got != test.chainCode {
+			t.Errorf("%s: chain code %s, want %s", test.path, got, test.chainCode)
+		}
+		if got := hex.EncodeToString(key.Key); got != test.private {
+			t.Errorf("%s: private key %s, want %s", test.path, got, test.private)
+		}
+		if got := hex.EncodeToString(key.publicKey()); got != test.public {
+			t.Errorf("%s: public key %s, want %s", test.path, got, test.public)
+		}
+	}
+}
+
+func TestExtendedPublicKeyDerivation(t *testing.T) {
+	master, err := NewMasterKey(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := master.Derive("m/0'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xpub, err := ParseExtendedKey(account.Neuter().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xpub.IsPrivate() {
+		t.Fatalf("expected a public key")
+	}
+	if _, err := xpub.Child(HardenedKeyStart); !errors.Is(err, ErrHardenedFromPublic) {
+		t.Errorf("expected ErrHardenedFromPublic, got %v", err)
+	}
+
+	private, err := account.Derive("0/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := xpub.Derive("0/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(private.Wallet().Address(), public.Wallet().Address()) {
+		t.Errorf("public derivation gave a different address")
+	}
+	if public.Wallet().PrivateKey != nil {
+		t.Errorf("expected a watch-only wallet")
+	}
+
+	xprv, err := ParseExtendedKey(private.String())
+	if err != nil || !bytes.Equal(xprv.Key, private.Key) || !xprv.IsPrivate() {
+		t.Errorf("extended private key did not round trip: %v", err)
+	}
+	if _, err := ParseExtendedKey(private.String()[1:]); err == nil {
+		t.Errorf("expected a corrupted key to be rejected")
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	indices, err := ParsePath("m/44'/0h/7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indices) != 3 || indices[0] != HardenedKeyStart+44 || indices[1] != HardenedKeyStart || indices[2] != 7 {
+		t.Errorf("unexpected indices %v", indices)
+	}
+	if path := FormatPath(indices); path != "m/44'/0'/7" {
+		t.Errorf("unexpected path %s", path)
+	}
+	if _, err := ParsePath("m/x"); err == nil {
+		t.Errorf("expected an invalid path to be rejected")
+	}
+}
+
+func TestWalletsDeriveAddress(t *testing.T) {
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.Mkdir("tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ws := &Wallets{Wallets: make(map[string]*Wallet)}
+	if _, err := ws.DeriveAddress(0, ExternalChain); err == nil {
+		t.Errorf("expected derivation without a seed to fail")
+	}
+	if err := ws.SetSeed(bytes.Repeat([]byte{1}, 32)); err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ := ws.DeriveAddress(0, ExternalChain)
+	second, _ := ws.DeriveAddress(0, ExternalChain)
+	change, err := ws.DeriveAddress(0, ChangeChain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second || ws.Wallets[second].Path != "m/0'/0/1" || ws.Wallets[change].Path != "m/0'/1/0" {
+		t.Errorf("unexpected paths %s, %s", ws.Wallets[second].Path, ws.Wallets[change].Path)
+	}
+
+	ws.SaveFile("test")
+	loaded, err := CreateWallets("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, _ := loaded.Account(0)
+	if account.Next != [2]uint32{2, 1} {
+		t.Errorf("expected next indices 2 and 1, got %v", account.Next)
+	}
+
+	xpub, err := ParseExtendedKey(account.XPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := xpub.Derive("0/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(key.Wallet().Address()) != second {
+		t.Errorf("expected the account's extended public key to derive its addresses")
+	}
+}
+
+func TestNewChangeAddress(t *testing.T) {
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.Mkdir("tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a seed, change goes to a new random key of the sender's type.
+	ws := &Wallets{Wallets: make(map[string]*Wallet)}
+	random, _ := ws.AddWalletOfType(KeyTypeEd25519)
+	change, err := ws.NewChangeAddress(random)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change == random || !ws.Wallets[change].Internal || ws.Wallets[change].KeyType != KeyTypeEd25519 {
+		t.Errorf("expected a fresh internal Ed25519 change address")
+	}
+
+	// An HD address gets the next change address of its account.
+	if err := ws.SetSeed(bytes.Repeat([]byte{6}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	from, _ := ws.DeriveAddress(1, ExternalChain)
+	first, _ := ws.NewChangeAddress(from)
+	second, _ := ws.NewChangeAddress(from)
+	if first == second || ws.Wallets[second].Path != "m/1'/1/1" || !ws.Wallets[second].Internal {
+		t.Errorf("unexpected change address path %s", ws.Wallets[second].Path)
+	}
+	if ws.Wallets[from].Internal {
+		t.Errorf("expected an external address not to be internal")
+	}
+	if change, _ := ws.NewChangeAddress(random); ws.Wallets[change].Path != "m/0'/1/0" {
+		t.Errorf("expected a random key to use the seed's first account, got %s", ws.Wallets[change].Path)
+	}
+
+	watched, _ := ws.ImportAddress(string(MakeWallet().Address()))
+	if _, err := ws.NewChangeAddress(watched); err != ErrWatchOnly {
+		t.Errorf("expected ErrWatchOnly, got %v", err)
+	}
+
+	ws.SaveFile("test")
+	loaded, err := CreateWallets("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Wallets[first].Internal || loaded.Wallets[from].Internal {
+		t.Errorf("expected the wallet file to keep which addresses are internal")
+	}
+}
@@ -0,0 +1,223 @@
+package wallet
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// KeyType identifies a signature scheme. It tags public keys and is the
+// version byte of addresses.
+type KeyType byte
+
+const (
+	// KeyTypeP256 is ECDSA over NIST P-256. Its tag is 0x00 so addresses
+	// created before key types existed keep their meaning.
+	KeyTypeP256 KeyType = 0x00
+	// KeyTypeEd25519 is Ed25519 as specified in RFC 8032.
+	KeyTypeEd25519 KeyType = 0x01
+)
+
+const (
+	p256PublicKeyLength    = 64
+	ed25519PublicKeyLength = ed25519.PublicKeySize
+)
+
+// ParseKeyType parses the name of a key type as used on the command line.
+func ParseKeyType(name string) (KeyType, error) {
+	switch strings.ToLower(name) {
+	case "p256", "ecdsa":
+		return KeyTypeP256, nil
+	case "ed25519":
+		return KeyTypeEd25519, nil
+	}
+
+	return 0, fmt.Errorf("unknown key type %q", name)
+}
+
+func (t KeyType) String() string {
+	switch t {
+	case KeyTypeP256:
+		return "p256"
+	case KeyTypeEd25519:
+		return "ed25519"
+	}
+
+	return fmt.Sprintf("unknown(0x%02x)", byte(t))
+}
+
+// IsValid reports whether the key type is supported.
+func (t KeyType) IsValid() bool {
+	return t == KeyTypeP256 || t == KeyTypeEd25519
+}
+
+// SigningKey is a private key of any supported scheme.
+type SigningKey interface {
+	Type() KeyType
+	// PublicKey returns the tagged public key.
+	PublicKey() []byte
+	// Sign signs a 32 byte digest.
+	Sign(hash []byte) ([]byte, error)
+}
+
+type p256Key struct {
+	key *ecdsa.PrivateKey
+}
+
+func (k p256Key) Type() KeyType {
+	return KeyTypeP256
+}
+
+func (k p256Key) PublicKey() []byte {
+	pub := make([]byte, p256PublicKeyLength)
+	k.key.X.FillBytes(pub[:32])
+	k.key.Y.FillBytes(pub[32:])
+
+	return tagPublicKey(KeyTypeP256, pub)
+}
+
+func (k p256Key) Sign(hash []byte) ([]byte, error) {
+	return SignECDSA(k.key, hash)
+}
+
+type ed25519Key struct {
+	key ed25519.PrivateKey
+}
+
+func (k ed25519Key) Type() KeyType {
+	return KeyTypeEd25519
+}
+
+func (k ed25519Key) PublicKey() []byte {
+	return tagPublicKey(KeyTypeEd25519, k.key.Public().(ed25519.PublicKey))
+}
+
+func (k ed25519Key) Sign(hash []byte) ([]byte, error) {
+	return ed25519.Sign(k.key, hash), nil
+}
+
+// NewP256SigningKey wraps an ECDSA P-256 private key.
+func NewP256SigningKey(key *ecdsa.PrivateKey) SigningKey {
+	return p256Key{key}
+}
+
+// NewSigningKey rebuilds a signing key from the private key bytes stored in
+// a wallet: the big-endian scalar for P-256 and the RFC 8032 seed for Ed25519.
+func NewSigningKey(keyType KeyType, private []byte) (SigningKey, error) {
+	switch keyType {
+	case KeyTypeP256:
+		d := new(big.Int).SetBytes(private)
+		if d.Sign() == 0 || d.Cmp(elliptic.P256().Params().N) >= 0 {
+			return nil, errors.New("invalid P-256 private key")
+		}
+
+		priv := new(ecdsa.PrivateKey)
+		priv.D = d
+		priv.PublicKey.Curve = elliptic.P256()
+		priv.PublicKey.X, priv.PublicKey.Y = priv.PublicKey.Curve.ScalarBaseMult(private)
+
+		return p256Key{priv}, nil
+	case KeyTypeEd25519:
+		if len(private) != ed25519.SeedSize {
+			return nil, errors.New("invalid Ed25519 private key")
+		}
+
+		return ed25519Key{ed25519.NewKeyFromSeed(private)}, nil
+	}
+
+	return nil, fmt.Errorf("unknown key type %s", keyType)
+}
+
+// generateKey creates a random key of the given type and returns its
+// private key bytes and tagged public key.
+func generateKey(keyType KeyType) ([]byte, []byte, error) {
+	switch keyType {
+	case KeyTypeP256:
+		private, public := NewKeyPair()
+
+		return private.D.FillBytes(make([]byte, 32)), public, nil
+	case KeyTypeEd25519:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return private.Seed(), tagPublicKey(KeyTypeEd25519, public), nil
+	}
+
+	return nil, nil, fmt.Errorf("unknown key type %s", keyType)
+}
+
+// legacyP256PublicKey is the untagged X||Y encoding of a P-256 key, without
+// leading zero bytes, that wallets made before key types existed hashed
+// into their addresses.
+func legacyP256PublicKey(x, y *big.Int) []byte {
+	return append(x.Bytes(), y.Bytes()...)
+}
+
+func tagPublicKey(keyType KeyType, key []byte) []byte {
+	return append([]byte{byte(keyType)}, key...)
+}
+
+// ParsePublicKey splits a tagged public key into its type and raw key.
+// Untagged keys of at most 64 bytes are the X||Y encoding of P-256 keys made
+// before key types existed.
+func ParsePublicKey(pubKey []byte) (KeyType, []byte, error) {
+	switch {
+	case len(pubKey) == 1+p256PublicKeyLength && KeyType(pubKey[0]) == KeyTypeP256:
+		return KeyTypeP256, pubKey[1:], nil
+	case len(pubKey) == 1+ed25519PublicKeyLength && KeyType(pubKey[0]) == KeyTypeEd25519:
+		return KeyTypeEd25519, pubKey[1:], nil
+	case len(pubKey) > 0 && len(pubKey) <= p256PublicKeyLength:
+		return KeyTypeP256, pubKey, nil
+	}
+
+	return 0, nil, errors.New("unrecognised public key encoding")
+}
+
+// VerifySignature checks sig over hash with the scheme named by the tagged
+// public key.
+func VerifySignature(pubKey, hash, sig []byte) bool {
+	keyType, key, err := ParsePublicKey(pubKey)
+	if err != nil {
+		return false
+	}
+
+	switch keyType {
+	case KeyTypeP256:
+		pub, err := p256PublicKey(key)
+		if err != nil {
+			return false
+		}
+
+		return VerifyECDSA(pub, hash, sig)
+	case KeyTypeEd25519:
+		return ed25519.Verify(ed25519.PublicKey(key), hash, sig)
+	}
+
+	return false
+}
+
+// p256PublicKey decodes the X||Y encoding of a P-256 key, rejecting points
+// that are not on the curve.
+func p256PublicKey(key []byte) (*ecdsa.PublicKey, error) {
+	keyLen := len(key)
+	x := new(big.Int).SetBytes(key[:(keyLen / 2)])
+	y := new(big.Int).SetBytes(key[(keyLen / 2):])
+
+	point := make([]byte, 1+p256PublicKeyLength)
+	point[0] = 0x04
+	x.FillBytes(point[1:33])
+	y.FillBytes(point[33:])
+	if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+		return nil, err
+	}
+
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+}
@@ -0,0 +1,88 @@
+package wallet
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+func TestKeyTypes(t *testing.T) {
+	hash := sha256.Sum256([]byte("message"))
+
+	for _, keyType := range []KeyType{KeyTypeP256, KeyTypeEd25519} {
+		w, err := MakeWalletOfType(keyType)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parsedType, _, err := ParsePublicKey(w.PublicKey)
+		if err != nil || parsedType != keyType {
+			t.Errorf("%s: public key parsed as %s, %v", keyType, parsedType, err)
+		}
+
+		for _, address := range []string{string(w.Address()), legacyAddress(w)} {
+			decoded, err := DecodeAddress(address)
+			if err != nil {
+				t.Errorf("%s: address %s is not valid: %v", keyType, address, err)
+			}
+			if decoded.KeyType != keyType {
+				t.Errorf("%s: expected address key type %d, got %d", keyType, keyType, decoded.KeyType)
+			}
+		}
+
+		key, err := w.SigningKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := key.Sign(hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !VerifySignature(w.PublicKey, hash[:], sig) {
+			t.Errorf("%s: signature does not verify", keyType)
+		}
+
+		other := sha256.Sum256([]byte("other"))
+		if VerifySignature(w.PublicKey, other[:], sig) {
+			t.Errorf("%s: signature verifies for another message", keyType)
+		}
+	}
+}
+
+func TestParseLegacyPublicKey(t *testing.T) {
+	private, tagged := NewKeyPair()
+	legacy := tagged[1:]
+
+	keyType, _, err := ParsePublicKey(legacy)
+	if err != nil || keyType != KeyTypeP256 {
+		t.Fatalf("expected untagged key to parse as P-256, got %s, %v", keyType, err)
+	}
+
+	hash := sha256.Sum256([]byte("legacy"))
+	sig, err := SignECDSA(&private, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifySignature(legacy, hash[:], sig) {
+		t.Errorf("expected signature to verify against the untagged key")
+	}
+}
+
+func TestWalletGobKeepsKeyType(t *testing.T) {
+	w, err := MakeWalletOfType(KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := w.GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Wallet
+	if err := decoded.GobDecode(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.KeyType != KeyTypeEd25519 || string(decoded.Address()) != string(w.Address()) {
+		t.Errorf("expected decoded wallet to keep its key type and address")
+	}
+}
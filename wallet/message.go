@@ -0,0 +1,204 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math/big"
+)
+
+// messageMagic prefixes every signed message, so a message signature can
+// never be passed off as a transaction signature or the other way round.
+const messageMagic = "Golang Blockchain Signed Message:\n"
+
+// Message signatures are the key type followed by, for P-256, the recovery
+// id and r and s, and for Ed25519, the public key and signature. A P-256
+// public key is recovered from the signature, so both verify against an
+// address alone.
+const (
+	p256MessageSignatureLength    = 2 + 64
+	ed25519MessageSignatureLength = 1 + ed25519PublicKeyLength + ed25519.SignatureSize
+)
+
+var ErrInvalidMessageSignature = errors.New("invalid message signature")
+
+// MessageHash is the double SHA-256 of the magic prefix and the length
+// prefixed message that message signatures sign.
+func MessageHash(message string) []byte {
+	var data bytes.Buffer
+	data.WriteString(messageMagic)
+	var length [binary.MaxVarintLen64]byte
+	data.Write(length[:binary.PutUvarint(length[:], uint64(len(message)))])
+	data.WriteString(message)
+
+	first := sha256.Sum256(data.Bytes())
+	hash := sha256.Sum256(first[:])
+
+	return hash[:]
+}
+
+// SignMessage signs a message with the wallet's key, proving control of
+// its address. The signature is base64 encoded.
+func (w *Wallet) SignMessage(message string) (string, error) {
+	key, err := w.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	hash := MessageHash(message)
+	sig, err := key.Sign(hash)
+	if err != nil {
+		return "", err
+	}
+
+	var compact []byte
+	switch key.Type() {
+	case KeyTypeP256:
+		r, s, err := ParseDERSignature(sig, elliptic.P256())
+		if err != nil {
+			return "", err
+		}
+		compact, err = recoverableSignature(key.PublicKey(), hash, r, s)
+		if err != nil {
+			return "", err
+		}
+	case KeyTypeEd25519:
+		compact = append([]byte{byte(KeyTypeEd25519)}, key.PublicKey()[1:]...)
+		compact = append(compact, sig...)
+	}
+
+	return base64.StdEncoding.EncodeToString(compact), nil
+}
+
+// recoverableSignature finds the recovery id that gives back pubKey from
+// the signature and returns the compact signature.
+func recoverableSignature(pubKey, hash []byte, r, s *big.Int) ([]byte, error) {
+	compact := make([]byte, p256MessageSignatureLength)
+	compact[0] = byte(KeyTypeP256)
+	r.FillBytes(compact[2:34])
+	s.FillBytes(compact[34:])
+
+	for id := byte(0); id < 4; id++ {
+		compact[1] = id
+		recovered, err := recoverP256(hash, compact)
+		if err == nil && bytes.Equal(recovered, pubKey) {
+			return compact, nil
+		}
+	}
+
+	return nil, errors.New("no recovery id matches the public key")
+}
+
+// recoverP256 returns the tagged public key that made a compact P-256
+// message signature of hash, as in SEC 1 section 4.1.6.
+func recoverP256(hash, compact []byte) ([]byte, error) {
+	curve := elliptic.P256()
+	params := curve.Params()
+	id := compact[1]
+	r := new(big.Int).SetBytes(compact[2:34])
+	s := new(big.Int).SetBytes(compact[34:])
+	if id > 3 || r.Sign() == 0 || r.Cmp(params.N) >= 0 || s.Sign() == 0 || s.Cmp(halfOrder(curve)) > 0 {
+		return nil, ErrInvalidMessageSignature
+	}
+
+	// R is the point k*G of the nonce, whose x coordinate is r or r+n and
+	// whose y parity is the low bit of the id.
+	x := new(big.Int).Set(r)
+	if id&2 != 0 {
+		x.Add(x, params.N)
+	}
+	if x.Cmp(params.P) >= 0 {
+		return nil, ErrInvalidMessageSignature
+	}
+	point := make([]byte, 33)
+	point[0] = 2 | id&1
+	x.FillBytes(point[1:])
+	rx, ry := elliptic.UnmarshalCompressed(curve, point)
+	if rx == nil {
+		return nil, ErrInvalidMessageSignature
+	}
+
+	// Q = r^-1 * (s*R - e*G)
+	rInv := new(big.Int).ModInverse(r, params.N)
+	e := hashToInt(hash, params.N)
+	u1 := new(big.Int).Neg(e)
+	u1.Mul(u1, rInv)
+	u1.Mod(u1, params.N)
+	u2 := new(big.Int).Mul(s, rInv)
+	u2.Mod(u2, params.N)
+
+	x1, y1 := curve.ScalarBaseMult(u1.FillBytes(make([]byte, 32)))
+	x2, y2 := curve.ScalarMult(rx, ry, u2.FillBytes(make([]byte, 32)))
+	qx, qy := curve.Add(x1, y1, x2, y2)
+	if qx.Sign() == 0 && qy.Sign() == 0 {
+		return nil, ErrInvalidMessageSignature
+	}
+
+	pub := make([]byte, p256PublicKeyLength)
+	qx.FillBytes(pub[:32])
+	qy.FillBytes(pub[32:])
+
+	return tagPublicKey(KeyTypeP256, pub), nil
+}
+
+// VerifyMessage reports whether signature is a signature of message by the
+// key of address. It returns an error for a malformed address or signature.
+func VerifyMessage(address, signature, message string) (bool, error) {
+	decoded, err := ParseAddress(address)
+	if err != nil {
+		return false, err
+	}
+	keyType := decoded.KeyType
+
+	compact, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(compact) == 0 {
+		return false, ErrInvalidMessageSignature
+	}
+	if KeyType(compact[0]) != keyType {
+		return false, nil
+	}
+
+	hash := MessageHash(message)
+	var pubKey []byte
+	switch keyType {
+	case KeyTypeP256:
+		if len(compact) != p256MessageSignatureLength {
+			return false, ErrInvalidMessageSignature
+		}
+		pubKey, err = recoverP256(hash, compact)
+		if err != nil {
+			// A signature of another message may recover no key at all.
+			return false, nil
+		}
+		r := new(big.Int).SetBytes(compact[2:34])
+		s := new(big.Int).SetBytes(compact[34:])
+		sig, err := EncodeDERSignature(r, s)
+		if err != nil || !VerifySignature(pubKey, hash, sig) {
+			return false, nil
+		}
+	case KeyTypeEd25519:
+		if len(compact) != ed25519MessageSignatureLength {
+			return false, ErrInvalidMessageSignature
+		}
+		pubKey = tagPublicKey(KeyTypeEd25519, compact[1:1+ed25519PublicKeyLength])
+		if !VerifySignature(pubKey, hash, compact[1+ed25519PublicKeyLength:]) {
+			return false, nil
+		}
+	}
+
+	if bytes.Equal(PublicKeyHash(pubKey), decoded.PubKeyHash) {
+		return true, nil
+	}
+	// Addresses of P-256 wallets made before key types existed hash the
+	// untagged public key.
+	if keyType == KeyTypeP256 {
+		x := new(big.Int).SetBytes(pubKey[1:33])
+		y := new(big.Int).SetBytes(pubKey[33:])
+		return bytes.Equal(PublicKeyHash(legacyP256PublicKey(x, y)), decoded.PubKeyHash), nil
+	}
+
+	return false, nil
+}
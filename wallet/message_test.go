@@ -0,0 +1,76 @@
+package wallet
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestSignAndVerifyMessage(t *testing.T) {
+	for _, keyType := range []KeyType{KeyTypeP256, KeyTypeEd25519} {
+		w, _ := MakeWalletOfType(keyType)
+		other, _ := MakeWalletOfType(keyType)
+		address := string(w.Address())
+
+		for i := 0; i < 8; i++ {
+			message := string(rune('a'+i)) + " I control this address"
+			sig, err := w.SignMessage(message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			again, _ := w.SignMessage(message)
+			if again != sig {
+				t.Errorf("%s: expected deterministic signatures", keyType)
+			}
+
+			if ok, err := VerifyMessage(address, sig, message); !ok || err != nil {
+				t.Errorf("%s: expected the signature to verify, got %v %v", keyType, ok, err)
+			}
+			if ok, _ := VerifyMessage(address, sig, message+"!"); ok {
+				t.Errorf("%s: expected another message not to verify", keyType)
+			}
+			if ok, _ := VerifyMessage(string(other.Address()), sig, message); ok {
+				t.Errorf("%s: expected another address not to verify", keyType)
+			}
+		}
+
+		// Flipping a bit of the signature breaks it.
+		sig, _ := w.SignMessage("hello")
+		raw, _ := base64.StdEncoding.DecodeString(sig)
+		raw[len(raw)-1] ^= 1
+		if ok, _ := VerifyMessage(address, base64.StdEncoding.EncodeToString(raw), "hello"); ok {
+			t.Errorf("%s: expected a corrupted signature not to verify", keyType)
+		}
+		if _, err := VerifyMessage(address, "not base64!", "hello"); err == nil {
+			t.Errorf("%s: expected a malformed signature to be an error", keyType)
+		}
+		if _, err := VerifyMessage(address, base64.StdEncoding.EncodeToString(raw[:10]), "hello"); err == nil {
+			t.Errorf("%s: expected a short signature to be an error", keyType)
+		}
+	}
+
+	if _, err := VerifyMessage("0OIl", "", "hello"); err == nil {
+		t.Errorf("expected an invalid address to be an error")
+	}
+
+	// A watch-only wallet has no key to sign with.
+	w := MakeWallet()
+	watch := &Wallet{PublicKey: w.PublicKey, KeyType: w.KeyType, WatchOnly: true}
+	if _, err := watch.SignMessage("hello"); err != ErrWatchOnly {
+		t.Errorf("expected ErrWatchOnly, got %v", err)
+	}
+}
+
+func TestVerifyMessageOfLegacyWallet(t *testing.T) {
+	w := makeLegacyWallet(t)
+	sig, err := w.SignMessage("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := VerifyMessage(string(w.Address()), sig, "hello"); !ok || err != nil {
+		t.Errorf("expected the signature to verify against the legacy address, got %v %v", ok, err)
+	}
+	if ok, _ := VerifyMessage(string(makeLegacyWallet(t).Address()), sig, "hello"); ok {
+		t.Errorf("expected another legacy address not to verify")
+	}
+}
@@ -0,0 +1,117 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Test vectors from the BIP39 reference implementation, passphrase TREZOR.
+func TestMnemonicVectors(t *testing.T) {
+	tests := []struct {
+		entropy, mnemonic, seed string
+	}{
+		{
+			"00000000000000000000000000000000",
+			"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+		},
+		{
+			"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+			"legal winner thank year wave sausage worth useful legal winner thank yellow",
+			"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+		},
+	}
+
+	for _, test := range tests {
+		entropy, _ := hex.DecodeString(test.entropy)
+		mnemonic, err := EntropyToMnemonic(entropy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mnemonic != test.mnemonic {
+			t.Errorf("mnemonic of %s: got %q", test.entropy, mnemonic)
+		}
+
+		decoded, err := MnemonicToEntropy(mnemonic)
+		if err != nil || hex.EncodeToString(decoded) != test.entropy {
+			t.Errorf("decoding %q: got %x, %v", mnemonic, decoded, err)
+		}
+
+		seed, err := MnemonicSeed(mnemonic, "TREZOR")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(seed) != test.seed {
+			t.Errorf("seed of %q: got %x", mnemonic, seed)
+		}
+	}
+}
+
+func TestMnemonicRejectsMistakes(t *testing.T) {
+	mnemonic, err := NewMnemonic(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if words := strings.Fields(mnemonic); len(words) != 24 {
+		t.Fatalf("expected 24 words, got %d", len(words))
+	}
+
+	words := strings.Fields("legal winner thank year wave sausage worth useful legal winner thank yellow")
+	for _, bad := range []string{
+		strings.Join(words[:11], " "),
+		strings.Join(append(words[:11:11], "notaword"), " "),
+		strings.Join(append([]string{words[1], words[0]}, words[2:]...), " "),
+	} {
+		if _, err := MnemonicSeed(bad, ""); !errors.Is(err, ErrInvalidMnemonic) {
+			t.Errorf("expected %q to be rejected, got %v", bad, err)
+		}
+	}
+}
+
+func TestRestoreFindsUsedAddresses(t *testing.T) {
+	seed, err := MnemonicSeed("legal winner thank year wave sausage worth useful legal winner thank yellow", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := &Wallets{Wallets: make(map[string]*Wallet)}
+	original.SetSeed(seed)
+	used := make(map[string]bool)
+	use := func(number, chain uint32, skip int) {
+		for i := 0; i < skip; i++ {
+			original.DeriveAddress(number, chain)
+		}
+		address, err := original.DeriveAddress(number, chain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		used[hex.EncodeToString(PublicKeyHash(original.Wallets[address].PublicKey))] = true
+	}
+	use(0, ExternalChain, 0)
+	use(0, ExternalChain, 1)
+	use(0, ChangeChain, 1)
+	use(1, ExternalChain, 0)
+
+	restored := &Wallets{Wallets: make(map[string]*Wallet)}
+	restored.SetSeed(seed)
+	found, err := restored.Restore(DefaultGapLimit, func(pubKeyHash []byte) bool {
+		return used[hex.EncodeToString(pubKeyHash)]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found != 4 || len(restored.Accounts) != 2 {
+		t.Fatalf("expected 4 addresses in 2 accounts, got %d in %d", found, len(restored.Accounts))
+	}
+	if restored.Accounts[0].Next != [2]uint32{3, 2} || restored.Accounts[1].Next != [2]uint32{1, 0} {
+		t.Errorf("unexpected next indices %v and %v", restored.Accounts[0].Next, restored.Accounts[1].Next)
+	}
+	for address, w := range restored.Wallets {
+		if original.Wallets[address] == nil || original.Wallets[address].Path != w.Path {
+			t.Errorf("restored unknown address %s at %s", address, w.Path)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+)
+
+// ecdsaSignature is the ASN.1 structure of a DER encoded ECDSA signature.
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// SignECDSA signs hash with a deterministic nonce (RFC 6979, HMAC-SHA256) and
+// returns the strict DER encoding of the low-S signature. Signing the same
+// hash with the same key always produces the same bytes.
+func SignECDSA(priv *ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	r, s, err := signRFC6979(priv, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	// (r, n-s) is just as valid as (r, s), so only the low form is produced.
+	if s.Cmp(halfOrder(priv.Curve)) > 0 {
+		s.Sub(priv.Curve.Params().N, s)
+	}
+
+	return EncodeDERSignature(r, s)
+}
+
+// VerifyECDSA checks a strict DER, low-S signature of hash.
+func VerifyECDSA(pub *ecdsa.PublicKey, hash, sig []byte) bool {
+	r, s, err := ParseDERSignature(sig, pub.Curve)
+	if err != nil {
+		return false
+	}
+	if s.Cmp(halfOrder(pub.Curve)) > 0 {
+		return false
+	}
+
+	return ecdsa.Verify(pub, hash, r, s)
+}
+
+// EncodeDERSignature encodes r and s as an ASN.1 DER sequence.
+func EncodeDERSignature(r, s *big.Int) ([]byte, error) {
+	return asn1.Marshal(ecdsaSignature{r, s})
+}
+
+// ParseDERSignature decodes a DER signature, accepting only the one canonical
+// encoding of each (r, s) pair: no padding, no long-form lengths where short
+// ones fit and no trailing data. r and s must lie in [1, n-1].
+func ParseDERSignature(sig []byte, curve elliptic.Curve) (*big.Int, *big.Int, error) {
+	var parsed ecdsaSignature
+
+	rest, err := asn1.Unmarshal(sig, &parsed)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rest) > 0 {
+		return nil, nil, errors.New("trailing data after signature")
+	}
+
+	canonical, err := EncodeDERSignature(parsed.R, parsed.S)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(canonical, sig) {
+		return nil, nil, errors.New("signature is not strictly DER encoded")
+	}
+
+	n := curve.Params().N
+	for _, v := range []*big.Int{parsed.R, parsed.S} {
+		if v.Sign() <= 0 || v.Cmp(n) >= 0 {
+			return nil, nil, errors.New("signature value out of range")
+		}
+	}
+
+	return parsed.R, parsed.S, nil
+}
+
+func halfOrder(curve elliptic.Curve) *big.Int {
+	return new(big.Int).Rsh(curve.Params().N, 1)
+}
+
+// signRFC6979 computes an ECDSA signature over P-256 using the nonce
+// generation of RFC 6979 section 3.2 with HMAC-SHA256.
+func signRFC6979(priv *ecdsa.PrivateKey, hash []byte) (*big.Int, *big.Int, error) {
+	if priv.Curve != elliptic.P256() {
+		return nil, nil, errors.New("deterministic signing supports P-256 keys only")
+	}
+
+	params := priv.Curve.Params()
+	n := params.N
+	qlen := n.BitLen()
+	rlen := (qlen + 7) / 8
+
+	e := hashToInt(hash, n)
+	nonces := newRFC6979Nonces(priv.D, e, n, rlen)
+
+	for {
+		k := nonces.next()
+
+		point, err := scalarBaseMult(k, rlen)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		r := new(big.Int).Mod(point, n)
+		if r.Sign() == 0 {
+			continue
+		}
+
+		// s = k^-1 * (e + r*d) mod n
+		s := new(big.Int).Mul(r, priv.D)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(k, n))
+		s.Mod(s, n)
+		if s.Sign() == 0 {
+			continue
+		}
+
+		return r, s, nil
+	}
+}
+
+// scalarBaseMult returns the x coordinate of k*G on P-256.
+func scalarBaseMult(k *big.Int, rlen int) (*big.Int, error) {
+	key, err := ecdh.P256().NewPrivateKey(k.FillBytes(make([]byte, rlen)))
+	if err != nil {
+		return nil, err
+	}
+
+	// The public key is encoded as 0x04 || X || Y.
+	point := key.PublicKey().Bytes()
+
+	return new(big.Int).SetBytes(point[1 : 1+rlen]), nil
+}
+
+// hashToInt implements bits2int of RFC 6979: the leftmost qlen bits of hash.
+func hashToInt(hash []byte, n *big.Int) *big.Int {
+	qlen := n.BitLen()
+	if len(hash) > (qlen+7)/8 {
+		hash = hash[:(qlen+7)/8]
+	}
+
+	v := new(big.Int).SetBytes(hash)
+	if excess := len(hash)*8 - qlen; excess > 0 {
+		v.Rsh(v, uint(excess))
+	}
+
+	return v
+}
+
+// rfc6979Nonces is the HMAC_DRBG of RFC 6979 section 3.2.
+type rfc6979Nonces struct {
+	k, v []byte
+	n    *big.Int
+	rlen int
+}
+
+func newRFC6979Nonces(d, e, n *big.Int, rlen int) *rfc6979Nonces {
+	g := &rfc6979Nonces{
+		k:    make([]byte, sha256.Size),
+		v:    bytes.Repeat([]byte{0x01}, sha256.Size),
+		n:    n,
+		rlen: rlen,
+	}
+
+	x := d.FillBytes(make([]byte, rlen))
+	h := new(big.Int).Mod(e, n).FillBytes(make([]byte, rlen))
+
+	g.k = g.mac(g.v, []byte{0x00}, x, h)
+	g.v = g.mac(g.v)
+	g.k = g.mac(g.v, []byte{0x01}, x, h)
+	g.v = g.mac(g.v)
+
+	return g
+}
+
+// next returns the next candidate nonce in [1, n-1].
+func (g *rfc6979Nonces) next() *big.Int {
+	for {
+		var t []byte
+		for len(t) < g.rlen {
+			g.v = g.mac(g.v)
+			t = append(t, g.v...)
+		}
+
+		k := hashToInt(t, g.n)
+
+		// Prepare the state for the next candidate, whether this one is
+		// used or not.
+		g.k = g.mac(g.v, []byte{0x00})
+		g.v = g.mac(g.v)
+
+		if k.Sign() > 0 && k.Cmp(g.n) < 0 {
+			return k
+		}
+	}
+}
+
+func (g *rfc6979Nonces) mac(data ...[]byte) []byte {
+	h := hmac.New(sha256.New, g.k)
+	for _, d := range data {
+		h.Write(d)
+	}
+
+	return h.Sum(nil)
+}
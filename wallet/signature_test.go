@@ -0,0 +1,195 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+)
+
+func hexInt(t *testing.T, s string) *big.Int {
+	t.Helper()
+
+	v, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("invalid hex integer %q", s)
+	}
+
+	return v
+}
+
+// rfc6979Key is the P-256 key of RFC 6979 appendix A.2.5.
+func rfc6979Key(t *testing.T) *ecdsa.PrivateKey {
+	priv := &ecdsa.PrivateKey{D: hexInt(t, "C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721")}
+	priv.Curve = elliptic.P256()
+	priv.X = hexInt(t, "60FED4BA255A9D31C961EB74C6356D68C049B8923B61FA6CE669622E60F29FB6")
+	priv.Y = hexInt(t, "7903FE1008B8BC99A41AE9E95628BC64F2F1B20C2D7E9F5177A3C294D4462299")
+
+	return priv
+}
+
+// Test vectors for P-256 with SHA-256 from RFC 6979 appendix A.2.5.
+var rfc6979Vectors = []struct {
+	message string
+	k, r, s string
+}{
+	{
+		"sample",
+		"A6E3C57DD01ABE90086538398355DD4C3B17AA873382B0F24D6129493D8AAD60",
+		"EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716",
+		"F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8",
+	},
+	{
+		"test",
+		"D16B6AE827F17175E040871A1C7EC3500192C4C92677336EC2537ACAEE0008E0",
+		"F1ABB023518351CD71D881567B1EA663ED3EFCF6C5132B354F28D3B0B7D38367",
+		"019F4113742A2B14BD25926B49C649155F267E60D3814B4C0CC84250E46F0083",
+	},
+}
+
+func TestRFC6979Vectors(t *testing.T) {
+	priv := rfc6979Key(t)
+	n := priv.Curve.Params().N
+
+	for _, v := range rfc6979Vectors {
+		hash := sha256.Sum256([]byte(v.message))
+
+		k := newRFC6979Nonces(priv.D, hashToInt(hash[:], n), n, 32).next()
+		if k.Cmp(hexInt(t, v.k)) != 0 {
+			t.Errorf("%q: expected k %s, got %X", v.message, v.k, k)
+		}
+
+		r, s, err := signRFC6979(priv, hash[:])
+		if err != nil {
+			t.Fatalf("%q: %v", v.message, err)
+		}
+		if r.Cmp(hexInt(t, v.r)) != 0 {
+			t.Errorf("%q: expected r %s, got %X", v.message, v.r, r)
+		}
+		if s.Cmp(hexInt(t, v.s)) != 0 {
+			t.Errorf("%q: expected s %s, got %X", v.message, v.s, s)
+		}
+
+		// SignECDSA returns the same signature in its low-S form.
+		sig, err := SignECDSA(priv, hash[:])
+		if err != nil {
+			t.Fatalf("%q: %v", v.message, err)
+		}
+		gotR, gotS, err := ParseDERSignature(sig, priv.Curve)
+		if err != nil {
+			t.Fatalf("%q: %v", v.message, err)
+		}
+		lowS := hexInt(t, v.s)
+		if lowS.Cmp(halfOrder(priv.Curve)) > 0 {
+			lowS.Sub(n, lowS)
+		}
+		if gotR.Cmp(r) != 0 || gotS.Cmp(lowS) != 0 {
+			t.Errorf("%q: expected low-S signature (%X, %X), got (%X, %X)", v.message, r, lowS, gotR, gotS)
+		}
+		if !VerifyECDSA(&priv.PublicKey, hash[:], sig) {
+			t.Errorf("%q: signature does not verify", v.message)
+		}
+	}
+}
+
+func TestSignECDSAIsDeterministic(t *testing.T) {
+	private, _ := NewKeyPair()
+	hash := sha256.Sum256([]byte("deterministic"))
+
+	first, err := SignECDSA(&private, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		sig, err := SignECDSA(&private, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sig, first) {
+			t.Fatalf("expected identical signatures, got %x and %x", first, sig)
+		}
+	}
+
+	other := sha256.Sum256([]byte("other"))
+	sig, _ := SignECDSA(&private, other[:])
+	if bytes.Equal(sig, first) {
+		t.Errorf("expected different messages to give different signatures")
+	}
+}
+
+func TestSignECDSAShortValues(t *testing.T) {
+	// Roughly one signature in 128 has an r or s with a leading zero byte,
+	// which used to break splitting the concatenated r||s encoding.
+	private, _ := NewKeyPair()
+
+	for i := 0; i < 512; i++ {
+		hash := sha256.Sum256([]byte{byte(i), byte(i >> 8)})
+		sig, err := SignECDSA(&private, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !VerifyECDSA(&private.PublicKey, hash[:], sig) {
+			t.Fatalf("signature %d does not verify: %x", i, sig)
+		}
+	}
+}
+
+func TestVerifyECDSARejectsNonCanonical(t *testing.T) {
+	priv := rfc6979Key(t)
+	hash := sha256.Sum256([]byte("sample"))
+	sig, err := SignECDSA(priv, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, s, _ := ParseDERSignature(sig, priv.Curve)
+
+	highS, _ := EncodeDERSignature(r, new(big.Int).Sub(priv.Curve.Params().N, s))
+
+	// Pad r with a redundant leading zero byte.
+	padded := append([]byte{}, sig[:4]...)
+	padded[1]++
+	padded[3]++
+	padded = append(padded, 0x00)
+	padded = append(padded, sig[4:]...)
+
+	// Encode the sequence length in long form.
+	longLength := append([]byte{0x30, 0x81}, sig[1:]...)
+
+	wrongTag := append([]byte{0x31}, sig[1:]...)
+
+	tests := map[string][]byte{
+		"high S":             highS,
+		"padded integer":     padded,
+		"long form length":   longLength,
+		"trailing data":      append(append([]byte{}, sig...), 0x00),
+		"wrong tag":          wrongTag,
+		"truncated":          sig[:len(sig)-1],
+		"empty":              {},
+		"raw concatenation":  append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...),
+		"zero r":             mustEncode(t, big.NewInt(0), s),
+		"negative s":         mustEncode(t, r, new(big.Int).Neg(s)),
+		"r equal to order n": mustEncode(t, priv.Curve.Params().N, s),
+	}
+
+	if !VerifyECDSA(&priv.PublicKey, hash[:], sig) {
+		t.Fatalf("canonical signature does not verify")
+	}
+	for name, bad := range tests {
+		if VerifyECDSA(&priv.PublicKey, hash[:], bad) {
+			t.Errorf("%s: expected signature %x to be rejected", name, bad)
+		}
+	}
+}
+
+func mustEncode(t *testing.T, r, s *big.Int) []byte {
+	t.Helper()
+
+	sig, err := EncodeDERSignature(r, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sig
+}
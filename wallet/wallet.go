@@ -7,20 +7,43 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/gob"
+	"errors"
+	"io"
 	"log"
-	"math/big"
+	"time"
 )
 
 const (
 	checksumLength = 4
-	version        = byte(0x00)
 )
 
 type Wallet struct {
+	// PrivateKey is the 32 byte big-endian scalar of a P-256 key or the
+	// 32 byte RFC 8032 seed of an Ed25519 key. Use ExportPrivateKey or
+	// MarshalPrivateKeyPEM to move it to another wallet.
 	PrivateKey []byte
 	PublicKey  []byte
+	KeyType    KeyType
+	// Path is where the key was derived from the master seed, empty for
+	// random keys.
+	Path string
+	// WatchOnly marks an address whose private key is kept elsewhere. Its
+	// balance is tracked but nothing can be signed with it.
+	WatchOnly bool
+	// PubKeyHash is set instead of PublicKey for a watched address whose
+	// public key is not known.
+	PubKeyHash []byte
+	// Internal marks a change address, which the wallet pays itself and
+	// never hands out.
+	Internal bool
+	Label    string
+	// Created is when the address was added to the wallet file, zero for
+	// addresses from before it was recorded.
+	Created time.Time
 }
 
+var ErrWatchOnly = errors.New("address is watch-only, its private key is not in the wallet file")
+
 // Serialize Wallet to gob format
 func (w *Wallet) GobEncode() ([]byte, error) {
 	var buf bytes.Buffer
@@ -37,6 +60,41 @@ func (w *Wallet) GobEncode() ([]byte, error) {
 		return nil, err
 	}
 
+	err = encoder.Encode(w.KeyType)
+	if err != nil {
+		return nil, err
+	}
+
+	err = encoder.Encode(w.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = encoder.Encode(w.WatchOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	err = encoder.Encode(w.PubKeyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	err = encoder.Encode(w.Internal)
+	if err != nil {
+		return nil, err
+	}
+
+	err = encoder.Encode(w.Label)
+	if err != nil {
+		return nil, err
+	}
+
+	err = encoder.Encode(w.Created)
+	if err != nil {
+		return nil, err
+	}
+
 	return buf.Bytes(), nil
 }
 
@@ -55,28 +113,78 @@ func (w *Wallet) GobDecode(data []byte) error {
 		return err
 	}
 
+	// Wallets saved before key types existed are all P-256.
+	w.KeyType = KeyTypeP256
+	err = decoder.Decode(&w.KeyType)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = decoder.Decode(&w.Path)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = decoder.Decode(&w.WatchOnly)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = decoder.Decode(&w.PubKeyHash)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = decoder.Decode(&w.Internal)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = decoder.Decode(&w.Label)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = decoder.Decode(&w.Created)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
 	return nil
 }
 
-func (w Wallet) Address() []byte {
-	pubHash := PublicKeyHash(w.PublicKey)
-
-	versionedHash := append([]byte{version}, pubHash...)
-	checksum := Checksum(versionedHash)
+// KeyHash returns the hash outputs paying the wallet are locked to.
+func (w Wallet) KeyHash() []byte {
+	if len(w.PublicKey) == 0 {
+		return w.PubKeyHash
+	}
 
-	fullHash := append(versionedHash, checksum...)
-	address := Base58Encode(fullHash)
-	return address
+	return PublicKeyHash(w.PublicKey)
 }
 
-func ValidateAddress(address string) bool {
-	pubKeyHash := Base58Decode([]byte(address))
-	actualChecksum := pubKeyHash[len(pubKeyHash)-checksumLength:]
-	version := pubKeyHash[0]
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-checksumLength]
-	targetChecksum := Checksum(append([]byte{version}, pubKeyHash...))
+// Address returns the wallet's bech32m address on the active network.
+func (w Wallet) Address() []byte {
+	address := Address{Network: ActiveNetwork, KeyType: w.KeyType, PubKeyHash: w.KeyHash()}
 
-	return bytes.Equal(actualChecksum, targetChecksum)
+	return []byte(address.String())
 }
 
 // Create new key pair and return the Wallet
@@ -88,27 +196,45 @@ func NewKeyPair() (ecdsa.PrivateKey, []byte) {
 		log.Panic(err)
 	}
 
-	pub := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
+	pub := NewP256SigningKey(private).PublicKey()
 	return *private, pub
 }
 
 func MakeWallet() *Wallet {
 	private, public := NewKeyPair()
 	wallet := Wallet{
-		PrivateKey: private.D.Bytes(),
+		PrivateKey: private.D.FillBytes(make([]byte, 32)),
 		PublicKey:  public,
+		KeyType:    KeyTypeP256,
 	}
 
 	return &wallet
 }
 
-// Retrieve the ecdsa.PrivateKey from the serialized data
-func (w *Wallet) GetPrivateKey() *ecdsa.PrivateKey {
-	priv := new(ecdsa.PrivateKey)
-	priv.D = new(big.Int).SetBytes(w.PrivateKey)
-	priv.PublicKey.Curve = elliptic.P256()
-	priv.PublicKey.X, priv.PublicKey.Y = priv.PublicKey.Curve.ScalarBaseMult(w.PrivateKey)
-	return priv
+// MakeWalletOfType creates a wallet with a new random key of the given type.
+func MakeWalletOfType(keyType KeyType) (*Wallet, error) {
+	private, public, err := generateKey(keyType)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Wallet{PrivateKey: private, PublicKey: public, KeyType: keyType}, nil
+}
+
+// SigningKey returns the wallet's private key for signing, whatever its type.
+func (w *Wallet) SigningKey() (SigningKey, error) {
+	if w.WatchOnly {
+		return nil, ErrWatchOnly
+	}
+
+	return NewSigningKey(w.KeyType, w.PrivateKey)
+}
+
+// hasLegacyPublicKey reports whether the wallet holds the untagged X||Y
+// public key of P-256 wallets made before key types existed.
+func (w *Wallet) hasLegacyPublicKey() bool {
+	return w.KeyType == KeyTypeP256 && len(w.PublicKey) > 0 &&
+		(len(w.PublicKey) != 1+p256PublicKeyLength || KeyType(w.PublicKey[0]) != KeyTypeP256)
 }
 
 func PublicKeyHash(pubKey []byte) []byte {
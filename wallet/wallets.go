@@ -3,16 +3,63 @@ package wallet
 import (
 	"bytes"
 	"crypto/elliptic"
+	"crypto/rand"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"sort"
+	"time"
 )
 
 const walletFile = "./tmp/wallets_%s.data"
 
+// walletFileVersion is the schema version of wallet files written now.
+// Version 1 added labels, creation times and contacts; files without a
+// version are older.
+const walletFileVersion = 1
+
+// DefaultGapLimit is how many unused addresses in a row end the search for
+// used ones when a wallet is restored from its seed.
+const DefaultGapLimit = 20
+
+// The chains of an HD account: addresses handed out to payers, and change.
+const (
+	ExternalChain uint32 = 0
+	ChangeChain   uint32 = 1
+)
+
+// Account is an HD account. Its keys are derived at m/Number'/chain/index,
+// and Next holds the next index of the external and change chains.
+type Account struct {
+	Number uint32
+	// XPub is the account's extended public key, from which a watch-only
+	// wallet can derive its addresses.
+	XPub string
+	Next [2]uint32
+}
+
 type Wallets struct {
+	// Version is the schema version the wallet file was written with.
+	Version int
 	Wallets map[string]*Wallet
+	// Seed is the master seed HD keys are derived from. Wallet files from
+	// before HD keys have none.
+	Seed     []byte
+	Accounts []*Account
+	// Watched are the accounts of extended public keys imported as
+	// watch-only, numbered in import order.
+	Watched []*Account
+	// Crypto holds the seed and private keys of an encrypted wallet file,
+	// which are only in Seed and the wallets while it is unlocked.
+	Crypto *EncryptedSecrets
+	// Contacts is the address book of other people's addresses by label.
+	Contacts map[string]*Contact
+
+	key []byte
+	// lockAt is when an unlocked wallet locks itself, zero for never.
+	lockAt time.Time
 }
 
 // Create new Wallets instance
@@ -31,29 +78,314 @@ func (ws *Wallets) getWallet(address string) Wallet {
 
 // Add a new wallet and return the address
 func (ws *Wallets) AddWallet() string {
-	wallet := MakeWallet()
-	address := string(wallet.Address())
+	if ws.IsLocked() {
+		log.Panic(ErrWalletLocked)
+	}
+	return ws.add(MakeWallet())
+}
 
-	ws.Wallets[address] = wallet
+// add keeps a wallet under its address, recording when it was added. A
+// wallet replacing one of the same address, such as a watched address
+// whose key is imported, keeps its label and creation time.
+func (ws *Wallets) add(w *Wallet) string {
+	address := string(w.Address())
+	if existing, ok := ws.Wallets[address]; ok {
+		w.Label, w.Created = existing.Label, existing.Created
+	}
+	if w.Created.IsZero() {
+		w.Created = time.Now()
+	}
+	ws.Wallets[address] = w
 
 	return address
 }
 
-// Get all wallet addresses
+// Add a new wallet with a key of the given type and return the address
+func (ws *Wallets) AddWalletOfType(keyType KeyType) (string, error) {
+	if ws.IsLocked() {
+		return "", ErrWalletLocked
+	}
+	wallet, err := MakeWalletOfType(keyType)
+	if err != nil {
+		return "", err
+	}
+
+	return ws.add(wallet), nil
+}
+
+// ImportWallet adds a wallet holding an imported private key and returns
+// its address.
+func (ws *Wallets) ImportWallet(w *Wallet) (string, error) {
+	if ws.IsLocked() {
+		return "", ErrWalletLocked
+	}
+	address := string(w.Address())
+	if existing, ok := ws.Wallets[address]; ok && existing.PrivateKey != nil {
+		return "", fmt.Errorf("address %s is already in the wallet file", address)
+	}
+
+	return ws.add(w), nil
+}
+
+func (ws *Wallets) HasSeed() bool {
+	return len(ws.Seed) > 0 || (ws.Crypto != nil && ws.Crypto.HasSeed)
+}
+
+// SetSeed sets the master seed of a wallet file that has none.
+func (ws *Wallets) SetSeed(seed []byte) error {
+	if ws.HasSeed() {
+		return errors.New("wallet file already has a seed")
+	}
+	if ws.IsLocked() {
+		return ErrWalletLocked
+	}
+	if _, err := NewMasterKey(seed); err != nil {
+		return err
+	}
+	ws.Seed = seed
+
+	return nil
+}
+
+// NewSeed sets a random master seed.
+func (ws *Wallets) NewSeed() error {
+	seed := make([]byte, 32)
+	if _, err := rand.Read(seed); err != nil {
+		return err
+	}
+
+	return ws.SetSeed(seed)
+}
+
+// Account returns the HD account, creating it on first use.
+func (ws *Wallets) Account(number uint32) (*Account, error) {
+	for _, account := range ws.Accounts {
+		if account.Number == number {
+			return account, nil
+		}
+	}
+
+	if !ws.HasSeed() {
+		return nil, errors.New("wallet file has no seed")
+	}
+	if ws.IsLocked() {
+		return nil, ErrWalletLocked
+	}
+	master, err := NewMasterKey(ws.Seed)
+	if err != nil {
+		return nil, err
+	}
+	key, err := master.Child(HardenedKeyStart + number)
+	if err != nil {
+		return nil, err
+	}
+
+	account := &Account{Number: number, XPub: key.Neuter().String()}
+	ws.Accounts = append(ws.Accounts, account)
+
+	return account, nil
+}
+
+// DeriveAddress derives the next key of a chain of the account, adds its
+// wallet and returns the address. While the wallet file is locked the key
+// is derived from the account's extended public key, and its private key is
+// derived on the next unlock.
+func (ws *Wallets) DeriveAddress(number, chain uint32) (string, error) {
+	if chain != ExternalChain && chain != ChangeChain {
+		return "", fmt.Errorf("unknown chain %d", chain)
+	}
+	account, err := ws.Account(number)
+	if err != nil {
+		return "", err
+	}
+
+	path := FormatPath([]uint32{HardenedKeyStart + number, chain, account.Next[chain]})
+	var key *ExtendedKey
+	if ws.IsLocked() {
+		key, err = ParseExtendedKey(account.XPub)
+		if err == nil {
+			key, err = key.Derive(fmt.Sprintf("%d/%d", chain, account.Next[chain]))
+		}
+	} else {
+		key, err = ws.deriveKey(path)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	wallet := key.Wallet()
+	wallet.Path = path
+	wallet.Internal = chain == ChangeChain
+	address := ws.add(wallet)
+	account.Next[chain]++
+
+	return address, nil
+}
+
+// NewChangeAddress adds a fresh address to receive the change of a payment
+// from the address from, so the payment does not link back to it. An HD
+// address gets the next change address of its account, and a random key
+// falls back to the first account of the seed or a new random key of the
+// same type.
+func (ws *Wallets) NewChangeAddress(from string) (string, error) {
+	stored, ok := ws.Lookup(from)
+	if !ok {
+		return "", fmt.Errorf("address %s is not in the wallet file", from)
+	}
+	sender := ws.Wallets[stored]
+	if sender.WatchOnly {
+		return "", ErrWatchOnly
+	}
+
+	var address string
+	path, err := ParsePath(sender.Path)
+	switch {
+	case err == nil && len(path) == 3 && path[0] >= HardenedKeyStart:
+		address, err = ws.DeriveAddress(path[0]-HardenedKeyStart, ChangeChain)
+	case ws.HasSeed():
+		address, err = ws.DeriveAddress(0, ChangeChain)
+	default:
+		address, err = ws.AddWalletOfType(sender.KeyType)
+	}
+	if err != nil {
+		return "", err
+	}
+	ws.Wallets[address].Internal = true
+
+	return address, nil
+}
+
+// deriveKey derives the private key at path from the seed.
+func (ws *Wallets) deriveKey(path string) (*ExtendedKey, error) {
+	master, err := NewMasterKey(ws.Seed)
+	if err != nil {
+		return nil, err
+	}
+
+	return master.Derive(path)
+}
+
+// Restore derives the addresses of the seed that used reports as used,
+// account after account, and returns how many it found. The search of a
+// chain stops after gap unused addresses in a row, and the search of
+// accounts at the first account with no used address.
+func (ws *Wallets) Restore(gap int, used func(pubKeyHash []byte) bool) (int, error) {
+	master, err := NewMasterKey(ws.Seed)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for number := uint32(0); number < HardenedKeyStart; number++ {
+		known := len(ws.Accounts)
+		account, err := ws.Account(number)
+		if err != nil {
+			return total, err
+		}
+		accountKey, err := master.Child(HardenedKeyStart + number)
+		if err != nil {
+			return total, err
+		}
+
+		found, err := scanAccount(accountKey, account, gap, used, func(wallet *Wallet, chain, index uint32) {
+			wallet.Path = FormatPath([]uint32{HardenedKeyStart + number, chain, index})
+			ws.add(wallet)
+		})
+		total += found
+		if err != nil {
+			return total, err
+		}
+		if found == 0 {
+			if len(ws.Accounts) > known && number > 0 {
+				ws.Accounts = ws.Accounts[:known]
+			}
+			break
+		}
+	}
+
+	return total, nil
+}
+
+// scanAccount derives the keys of both chains of an account key, calling
+// add with the wallet of every key that used reports as used, until gap
+// unused keys in a row. It advances account.Next past the keys found.
+func scanAccount(accountKey *ExtendedKey, account *Account, gap int, used func(pubKeyHash []byte) bool, add func(wallet *Wallet, chain, index uint32)) (int, error) {
+	found := 0
+	for _, chain := range []uint32{ExternalChain, ChangeChain} {
+		chainKey, err := accountKey.Child(chain)
+		if err != nil {
+			return found, err
+		}
+
+		for index, unused := uint32(0), 0; unused < gap; index++ {
+			key, err := chainKey.Child(index)
+			if err != nil {
+				return found, err
+			}
+			wallet := key.Wallet()
+			if !used(PublicKeyHash(wallet.PublicKey)) {
+				unused++
+				continue
+			}
+
+			wallet.Internal = chain == ChangeChain
+			add(wallet, chain, index)
+			if index >= account.Next[chain] {
+				account.Next[chain] = index + 1
+			}
+			found++
+			unused = 0
+		}
+	}
+
+	return found, nil
+}
+
+// Get all wallet addresses, oldest first
 func (ws *Wallets) GetAllAddresses() []string {
 	var addresses []string
 
 	for address := range ws.Wallets {
 		addresses = append(addresses, address)
 	}
+	sort.Slice(addresses, func(i, j int) bool {
+		a, b := ws.Wallets[addresses[i]], ws.Wallets[addresses[j]]
+		if !a.Created.Equal(b.Created) {
+			return a.Created.Before(b.Created)
+		}
+		return addresses[i] < addresses[j]
+	})
 
 	return addresses
 }
 
-func (ws Wallets) GetWallet(address string) Wallet {
+func (ws *Wallets) GetWallet(address string) Wallet {
+	ws.expire()
+	address, _ = ws.Lookup(address)
+
 	return *ws.Wallets[address]
 }
 
+// Lookup finds the wallet of an address in any format, returning the
+// address it is kept under.
+func (ws *Wallets) Lookup(address string) (string, bool) {
+	if _, ok := ws.Wallets[address]; ok {
+		return address, true
+	}
+
+	decoded, err := ParseAddress(address)
+	if err != nil {
+		return "", false
+	}
+	for stored, w := range ws.Wallets {
+		if w.KeyType == decoded.KeyType && bytes.Equal(w.KeyHash(), decoded.PubKeyHash) {
+			return stored, true
+		}
+	}
+
+	return "", false
+}
+
 // Load wallets from file
 func (ws *Wallets) LoadFile(nodeId string) error {
 	walletFile := fmt.Sprintf(walletFile, nodeId)
@@ -75,25 +407,80 @@ func (ws *Wallets) LoadFile(nodeId string) error {
 	if err != nil {
 		return err
 	}
+	ws.Version = wallets.Version
+	if wallets.Version > walletFileVersion {
+		return fmt.Errorf("wallet file version %d is newer than this program supports (%d)", wallets.Version, walletFileVersion)
+	}
 
-	ws.Wallets = wallets.Wallets
+	// Wallets are kept under their address on the active network, whatever
+	// format or network they were saved with.
+	ws.Wallets = make(map[string]*Wallet)
+	for _, w := range wallets.Wallets {
+		ws.Wallets[string(w.Address())] = w
+	}
+	ws.Seed = wallets.Seed
+	ws.Accounts = wallets.Accounts
+	ws.Watched = wallets.Watched
+	ws.Crypto = wallets.Crypto
+	ws.Contacts = wallets.Contacts
+
+	// Files written before they were kept private are made so now.
+	if info, err := os.Stat(walletFile); err == nil && info.Mode().Perm()&0077 != 0 {
+		if err := os.Chmod(walletFile, 0600); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// Save wallets to file
+// Save wallets to file, readable by the owner only. An encrypted wallet
+// file keeps its seed and private keys sealed, sealing them again if they
+// changed while it was unlocked.
 func (ws *Wallets) SaveFile(nodeId string) {
 	var content bytes.Buffer
 	walletFile := fmt.Sprintf(walletFile, nodeId)
 
+	// A file from a newer version would lose what this one cannot read.
+	if ws.Version > walletFileVersion {
+		log.Panicf("refusing to overwrite a version %d wallet file", ws.Version)
+	}
+	ws.Version = walletFileVersion
+	stored := &Wallets{Version: ws.Version, Wallets: ws.Wallets, Seed: ws.Seed, Accounts: ws.Accounts, Watched: ws.Watched, Crypto: ws.Crypto, Contacts: ws.Contacts}
+	if ws.IsEncrypted() {
+		if !ws.IsLocked() {
+			crypto := *ws.Crypto
+			if err := crypto.seal(ws.key, ws.secrets()); err != nil {
+				log.Panic(err)
+			}
+			ws.Crypto = &crypto
+			stored.Crypto = &crypto
+		}
+
+		stored.Seed = nil
+		stored.Wallets = make(map[string]*Wallet)
+		for address, w := range ws.Wallets {
+			public := *w
+			public.PrivateKey = nil
+			stored.Wallets[address] = &public
+		}
+	}
+
 	gob.Register(elliptic.P256())
 
 	encoder := gob.NewEncoder(&content)
-	err := encoder.Encode(ws)
+	err := encoder.Encode(stored)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	err = os.WriteFile(walletFile, content.Bytes(), 0644)
+	// Write a new file and move it over the old one, so a crash cannot
+	// leave a truncated wallet behind.
+	tmp := walletFile + ".tmp"
+	err = os.WriteFile(tmp, content.Bytes(), 0600)
+	if err != nil {
+		log.Panic(err)
+	}
+	err = os.Rename(tmp, walletFile)
 	if err != nil {
 		log.Panic(err)
 	}
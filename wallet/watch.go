@@ -0,0 +1,119 @@
+package wallet
+
+import (
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+)
+
+// ImportAddress adds an address to watch without its public or private
+// key.
+func (ws *Wallets) ImportAddress(address string) (string, error) {
+	decoded, err := DecodeAddress(address)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := ws.Lookup(address); ok {
+		return "", fmt.Errorf("address %s is already in the wallet file", address)
+	}
+
+	w := &Wallet{KeyType: decoded.KeyType, WatchOnly: true, PubKeyHash: decoded.PubKeyHash}
+	return ws.add(w), nil
+}
+
+// ImportPublicKey adds the address of a public key to watch. The key is
+// either tagged with its type, as in transaction inputs, or a SEC 1
+// encoded P-256 point.
+func (ws *Wallets) ImportPublicKey(pubKey []byte) (string, error) {
+	pubKey, err := normalizePublicKey(pubKey)
+	if err != nil {
+		return "", err
+	}
+	keyType, _, _ := ParsePublicKey(pubKey)
+
+	w := &Wallet{PublicKey: pubKey, KeyType: keyType, WatchOnly: true}
+	address := string(w.Address())
+	if existing, ok := ws.Wallets[address]; ok && existing.PublicKey != nil {
+		return "", fmt.Errorf("address %s is already in the wallet file", address)
+	}
+
+	return ws.add(w), nil
+}
+
+// ImportExtendedKey watches the account of an extended key, adding the
+// addresses of its external and change chains that used reports as used
+// until gap unused ones in a row, and at least the first external address.
+// A private extended key is only used for its public key. Importing the
+// same key again rescans it.
+func (ws *Wallets) ImportExtendedKey(xpub string, gap int, used func(pubKeyHash []byte) bool) (int, error) {
+	key, err := ParseExtendedKey(xpub)
+	if err != nil {
+		return 0, err
+	}
+	key = key.Neuter()
+
+	var account *Account
+	for _, watched := range ws.Watched {
+		if watched.XPub == key.String() {
+			account = watched
+		}
+	}
+	if account == nil {
+		account = &Account{Number: uint32(len(ws.Watched)), XPub: key.String()}
+		ws.Watched = append(ws.Watched, account)
+	}
+
+	add := func(wallet *Wallet, chain, index uint32) {
+		wallet.WatchOnly = true
+		address := string(wallet.Address())
+		if _, ok := ws.Wallets[address]; !ok {
+			ws.add(wallet)
+		}
+	}
+	found, err := scanAccount(key, account, gap, used, add)
+	if err != nil {
+		return found, err
+	}
+
+	if account.Next[ExternalChain] == 0 {
+		first, err := key.Derive(fmt.Sprintf("%d/0", ExternalChain))
+		if err != nil {
+			return found, err
+		}
+		add(first.Wallet(), ExternalChain, 0)
+		account.Next[ExternalChain] = 1
+	}
+
+	return found, nil
+}
+
+// normalizePublicKey returns a valid public key in the tagged form.
+func normalizePublicKey(pubKey []byte) ([]byte, error) {
+	curve := elliptic.P256()
+	if len(pubKey) == 33 && (pubKey[0] == 2 || pubKey[0] == 3) {
+		x, y := elliptic.UnmarshalCompressed(curve, pubKey)
+		if x == nil {
+			return nil, errors.New("invalid P-256 public key")
+		}
+		pubKey = make([]byte, 1+p256PublicKeyLength)
+		x.FillBytes(pubKey[1:33])
+		y.FillBytes(pubKey[33:])
+	} else if len(pubKey) == 1+p256PublicKeyLength && pubKey[0] == 4 {
+		pubKey = append([]byte{byte(KeyTypeP256)}, pubKey[1:]...)
+	}
+
+	keyType, key, err := ParsePublicKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	if keyType == KeyTypeP256 {
+		if len(key) != p256PublicKeyLength {
+			return nil, errors.New("invalid P-256 public key")
+		}
+		if _, err := p256PublicKey(key); err != nil {
+			return nil, errors.New("invalid P-256 public key")
+		}
+	}
+
+	return tagPublicKey(keyType, key), nil
+}
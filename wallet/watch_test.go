@@ -0,0 +1,124 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestImportWatchOnly(t *testing.T) {
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.Mkdir("tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cold := MakeWallet()
+	other, _ := MakeWalletOfType(KeyTypeEd25519)
+
+	ws := &Wallets{Wallets: make(map[string]*Wallet)}
+	address, err := ws.ImportAddress(string(cold.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ws.Wallets[address].KeyHash(), cold.KeyHash()) {
+		t.Errorf("expected a watched address to keep its key hash")
+	}
+	if _, err := ws.ImportAddress(address); err == nil {
+		t.Errorf("expected a duplicate address to be rejected")
+	}
+
+	// The public key of a watched address can be added later.
+	if _, err := ws.ImportPublicKey(cold.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ws.Wallets[address].PublicKey, cold.PublicKey) {
+		t.Errorf("expected the public key to be added to the watched address")
+	}
+	if _, err := ws.ImportPublicKey(other.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.ImportPublicKey([]byte{0, 1, 2}); err == nil {
+		t.Errorf("expected an invalid public key to be rejected")
+	}
+
+	// A compressed SEC 1 key is the same address as the tagged key.
+	master, _ := NewMasterKey(bytes.Repeat([]byte{4}, 32))
+	account, _ := master.Child(HardenedKeyStart)
+	first, _ := account.Derive("0/0")
+	ws2 := &Wallets{Wallets: make(map[string]*Wallet)}
+	compressed, err := ws2.ImportPublicKey(first.Neuter().Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compressed != string(first.Wallet().Address()) {
+		t.Errorf("expected a compressed key to give the same address")
+	}
+
+	for _, w := range ws.Wallets {
+		if _, err := w.SigningKey(); !errors.Is(err, ErrWatchOnly) {
+			t.Errorf("expected signing with a watch-only wallet to fail, got %v", err)
+		}
+	}
+
+	ws.SaveFile("test")
+	loaded, err := CreateWallets("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := loaded.Wallets[address]; !w.WatchOnly || w.PrivateKey != nil {
+		t.Errorf("expected the watched address to be saved as watch-only")
+	}
+}
+
+func TestImportExtendedKey(t *testing.T) {
+	master, _ := NewMasterKey(bytes.Repeat([]byte{5}, 32))
+	account, _ := master.Child(HardenedKeyStart)
+	used := make(map[string]bool)
+	for _, path := range []string{"0/3", "1/0"} {
+		key, _ := account.Derive(path)
+		used[hex.EncodeToString(PublicKeyHash(key.Wallet().PublicKey))] = true
+	}
+	isUsed := func(pubKeyHash []byte) bool {
+		return used[hex.EncodeToString(pubKeyHash)]
+	}
+
+	ws := &Wallets{Wallets: make(map[string]*Wallet)}
+	found, err := ws.ImportExtendedKey(account.Neuter().String(), 5, isUsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != 2 || len(ws.Wallets) != 2 {
+		t.Errorf("expected 2 used addresses, got %d of %d", found, len(ws.Wallets))
+	}
+	if len(ws.Watched) != 1 || ws.Watched[0].Next != [2]uint32{4, 1} {
+		t.Errorf("unexpected watched accounts %v", ws.Watched)
+	}
+	for _, w := range ws.Wallets {
+		if !w.WatchOnly || w.PrivateKey != nil {
+			t.Errorf("expected only watch-only wallets")
+		}
+	}
+
+	// A private extended key is stored as its public key, and importing
+	// the same account again rescans it.
+	if _, err := ws.ImportExtendedKey(account.String(), 5, isUsed); err != nil {
+		t.Fatal(err)
+	}
+	if len(ws.Watched) != 1 || ws.Watched[0].XPub != account.Neuter().String() {
+		t.Errorf("expected the account to be watched once by its public key")
+	}
+
+	unused := &Wallets{Wallets: make(map[string]*Wallet)}
+	if _, err := unused.ImportExtendedKey(account.Neuter().String(), 5, func([]byte) bool { return false }); err != nil {
+		t.Fatal(err)
+	}
+	if len(unused.Wallets) != 1 {
+		t.Errorf("expected the first address of an unused account to be watched")
+	}
+}
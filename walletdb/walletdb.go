@@ -0,0 +1,520 @@
+// Package walletdb keeps the wallet's own record of the outputs paying its
+// addresses and of the transactions touching them, so balances and history
+// need no scan of the whole UTXO set.
+package walletdb
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+	"github.com/mapfumo/golang-blockchain/wallet"
+)
+
+const dbFile = "./tmp/walletdb_%s.data"
+
+// Unconfirmed is the height of transactions and outputs still in the memory
+// pool.
+const Unconfirmed = -1
+
+// CoinbaseMaturity is how many confirmations a coinbase output needs before
+// it is counted as confirmed balance rather than immature, since a chain
+// reorganization would erase it. The chain itself does not enforce it.
+const CoinbaseMaturity = 10
+
+var ErrNotConnected = errors.New("block does not extend the wallet's tip")
+
+// Output is a transaction output paying one of the wallet's addresses.
+type Output struct {
+	TxID       []byte
+	Index      int
+	Value      int
+	PubKeyHash []byte
+	Coinbase   bool
+	// Change marks an output of the wallet's own payment to one of its
+	// change addresses.
+	Change bool
+	Height int
+	// SpentBy is the ID of the confirmed or pending transaction spending
+	// the output, nil while it is unspent.
+	SpentBy []byte
+}
+
+// TxRecord is a transaction paying to or spending from the wallet.
+type TxRecord struct {
+	Tx        *blockchain.Transaction
+	Height    int
+	BlockHash []byte
+	// Received is the value of the outputs paying the wallet, Change the
+	// value of those paying its change addresses back, and Sent the value
+	// of the wallet's outputs it spends.
+	Received int
+	Change   int
+	Sent     int
+	Added    time.Time
+}
+
+// Net is how much the transaction changed the wallet's balance by.
+func (r *TxRecord) Net() int {
+	return r.Received + r.Change - r.Sent
+}
+
+// Balance splits the value of the wallet's unspent outputs.
+type Balance struct {
+	Confirmed   int
+	Unconfirmed int
+	Immature    int
+}
+
+// Key describes one of the wallet's addresses.
+type Key struct {
+	WatchOnly bool
+	// Change marks an internal address the wallet sends change to.
+	Change bool
+}
+
+type DB struct {
+	// Height and Tip are the last block applied, Tip nil before any.
+	Height int
+	Tip    []byte
+	// Keys are the wallet's addresses by hex key hash.
+	Keys         map[string]Key
+	Outputs      map[string]*Output
+	Transactions map[string]*TxRecord
+	// RescanPending asks the next Open to rebuild the database, for
+	// addresses that may have been paid before they were added.
+	RescanPending bool
+
+	mu   sync.Mutex
+	path string
+	// rescan holds the pending transactions to add back once a rebuilt
+	// database has caught up with the chain.
+	rescan []*blockchain.Transaction
+}
+
+// WalletKeys returns the key hashes of every address in a wallet file, in
+// the form Open takes.
+func WalletKeys(ws *wallet.Wallets) map[string]Key {
+	keys := make(map[string]Key)
+	for _, w := range ws.Wallets {
+		keys[hex.EncodeToString(w.KeyHash())] = Key{WatchOnly: w.WatchOnly, Change: w.Internal}
+	}
+
+	return keys
+}
+
+// Open loads the wallet database of a node. When an address was removed or
+// changed type since it was saved, a rescan was asked for, or the file is
+// from an older version, it starts over so the next Sync rescans the chain.
+func Open(nodeID string, keys map[string]Key) (*DB, error) {
+	db := &DB{path: fmt.Sprintf(dbFile, nodeID)}
+	db.reset(keys)
+
+	data, err := os.ReadFile(db.path)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var saved DB
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&saved); err != nil {
+		// The database only caches what is in the chain.
+		return db, nil
+	}
+	db.Height, db.Tip = saved.Height, saved.Tip
+	db.Keys, db.Outputs, db.Transactions = saved.Keys, saved.Outputs, saved.Transactions
+	if saved.RescanPending {
+		db.rebuild(keys)
+	} else {
+		db.setKeys(keys)
+	}
+
+	return db, nil
+}
+
+// SetKeys updates the wallet's addresses. New addresses are fresh ones
+// nothing has paid yet, so they are only added; if one was removed or
+// changed type the database is rebuilt from the genesis block by the next
+// Sync.
+func (db *DB) SetKeys(keys map[string]Key) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.setKeys(keys)
+}
+
+func (db *DB) setKeys(keys map[string]Key) {
+	for hash, key := range db.Keys {
+		if other, ok := keys[hash]; !ok || other != key {
+			db.rebuild(keys)
+			return
+		}
+	}
+
+	db.Keys = keys
+}
+
+// Rescan has the next Open rebuild the database from the genesis block,
+// after adding addresses that may already have been paid.
+func (db *DB) Rescan() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.RescanPending = true
+}
+
+// rebuild empties the database, keeping its pending transactions for Sync
+// to add back.
+func (db *DB) rebuild(keys map[string]Key) {
+	db.rescan = append(db.rescan, db.pending()...)
+	db.reset(keys)
+}
+
+func (db *DB) reset(keys map[string]Key) {
+	db.Height, db.Tip = 0, nil
+	db.Keys = keys
+	db.Outputs = make(map[string]*Output)
+	db.Transactions = make(map[string]*TxRecord)
+}
+
+// Save writes the database through a temporary file, readable by the owner
+// only like the wallet file.
+func (db *DB) Save() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(db); err != nil {
+		return err
+	}
+
+	tmp := db.path + ".tmp"
+	if err := os.WriteFile(tmp, data.Bytes(), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, db.path)
+}
+
+func outpoint(txID []byte, index int) string {
+	return fmt.Sprintf("%x:%d", txID, index)
+}
+
+// Sync applies the blocks of the chain above the wallet's tip. If the tip
+// is no longer in the chain, the wallet is rebuilt from the genesis block,
+// keeping its pending transactions.
+func (db *DB) Sync(chain *blockchain.BlockChain) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var blocks []*blockchain.Block
+	iter := chain.Iterator()
+	for {
+		block := iter.Next()
+		if db.Tip != nil && bytes.Equal(block.Hash, db.Tip) {
+			break
+		}
+		blocks = append(blocks, block)
+
+		if len(block.PrevHash) == 0 {
+			if db.Tip != nil {
+				db.rebuild(db.Keys)
+			}
+			break
+		}
+	}
+
+	for i := len(blocks) - 1; i >= 0; i-- {
+		db.connect(blocks[i])
+	}
+	db.addPending(db.rescan)
+	db.rescan = nil
+}
+
+// BlockConnected applies a block extending the wallet's tip.
+func (db *DB) BlockConnected(block *blockchain.Block) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.Tip != nil && !bytes.Equal(block.PrevHash, db.Tip) {
+		return ErrNotConnected
+	}
+	db.connect(block)
+
+	return nil
+}
+
+func (db *DB) connect(block *blockchain.Block) {
+	for _, tx := range block.Transactions {
+		db.add(tx, block.Height, block.Hash)
+	}
+	db.Height, db.Tip = block.Height, block.Hash
+}
+
+// AddTransaction records a transaction accepted into the memory pool if it
+// touches the wallet. Pending transactions it double spends are dropped
+// with their descendants, as the pool does when replacing them.
+func (db *DB) AddTransaction(tx *blockchain.Transaction) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.add(tx, Unconfirmed, nil)
+}
+
+// Expire drops pending transactions older than maxAge, which no memory
+// pool keeps anymore, and returns how many it dropped.
+func (db *DB) Expire(now time.Time, maxAge time.Duration) int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	expired := 0
+	for id, record := range db.Transactions {
+		if record.Height == Unconfirmed && now.Sub(record.Added) > maxAge {
+			db.removePending(id)
+			expired++
+		}
+	}
+
+	return expired
+}
+
+// pending returns the pending transactions, parents before children.
+func (db *DB) pending() []*blockchain.Transaction {
+	var records []*TxRecord
+	for _, record := range db.Transactions {
+		if record.Height == Unconfirmed {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Added.Before(records[j].Added)
+	})
+
+	var txs []*blockchain.Transaction
+	visited := make(map[string]bool)
+	var visit func(record *TxRecord)
+	visit = func(record *TxRecord) {
+		id := hex.EncodeToString(record.Tx.ID)
+		if visited[id] {
+			return
+		}
+		visited[id] = true
+		for _, in := range record.Tx.Inputs {
+			if parent, ok := db.Transactions[hex.EncodeToString(in.ID)]; ok && parent.Height == Unconfirmed {
+				visit(parent)
+			}
+		}
+		txs = append(txs, record.Tx)
+	}
+	for _, record := range records {
+		visit(record)
+	}
+
+	return txs
+}
+
+func (db *DB) addPending(txs []*blockchain.Transaction) {
+	for _, tx := range txs {
+		db.add(tx, Unconfirmed, nil)
+	}
+}
+
+// add records tx at height if it pays or spends from the wallet.
+func (db *DB) add(tx *blockchain.Transaction, height int, blockHash []byte) {
+	id := hex.EncodeToString(tx.ID)
+	record, known := db.Transactions[id]
+	if known && height == Unconfirmed {
+		return
+	}
+
+	var spends []*Output
+	if !tx.IsCoinbase() {
+		for _, in := range tx.Inputs {
+			out, ok := db.Outputs[outpoint(in.ID, in.Out)]
+			if !ok {
+				continue
+			}
+			if out.SpentBy != nil && !bytes.Equal(out.SpentBy, tx.ID) {
+				other := db.Transactions[hex.EncodeToString(out.SpentBy)]
+				if other.Height != Unconfirmed {
+					// A pending double spend of a confirmed spend is invalid.
+					return
+				}
+				db.removePending(hex.EncodeToString(out.SpentBy))
+			}
+			spends = append(spends, out)
+		}
+	}
+
+	var pays []int
+	for i, out := range tx.Outputs {
+		if _, ok := db.Keys[hex.EncodeToString(out.PubKeyHash)]; ok {
+			pays = append(pays, i)
+		}
+	}
+	if !known && len(spends) == 0 && len(pays) == 0 {
+		return
+	}
+
+	if !known {
+		record = &TxRecord{Tx: tx, Added: time.Now()}
+		for _, out := range spends {
+			record.Sent += out.Value
+		}
+		for _, i := range pays {
+			if db.isChange(tx.Outputs[i], spends) {
+				record.Change += tx.Outputs[i].Value
+			} else {
+				record.Received += tx.Outputs[i].Value
+			}
+		}
+		db.Transactions[id] = record
+	}
+	record.Height, record.BlockHash = height, blockHash
+
+	for _, out := range spends {
+		out.SpentBy = tx.ID
+	}
+	for _, i := range pays {
+		key := outpoint(tx.ID, i)
+		if out, ok := db.Outputs[key]; ok {
+			out.Height = height
+			continue
+		}
+		db.Outputs[key] = &Output{
+			TxID:       tx.ID,
+			Index:      i,
+			Value:      tx.Outputs[i].Value,
+			PubKeyHash: tx.Outputs[i].PubKeyHash,
+			Coinbase:   tx.IsCoinbase(),
+			Change:     db.isChange(tx.Outputs[i], spends),
+			Height:     height,
+		}
+	}
+}
+
+// isChange reports whether an output pays change back to the wallet, which
+// takes a change address and a transaction spending the wallet's outputs.
+func (db *DB) isChange(out blockchain.TxOutput, spends []*Output) bool {
+	return len(spends) > 0 && db.Keys[hex.EncodeToString(out.PubKeyHash)].Change
+}
+
+// removePending forgets a pending transaction and its pending descendants,
+// making the outputs it spent unspent again.
+func (db *DB) removePending(id string) {
+	record, ok := db.Transactions[id]
+	if !ok || record.Height != Unconfirmed {
+		return
+	}
+	delete(db.Transactions, id)
+
+	for i := range record.Tx.Outputs {
+		key := outpoint(record.Tx.ID, i)
+		if out, ok := db.Outputs[key]; ok {
+			if out.SpentBy != nil {
+				db.removePending(hex.EncodeToString(out.SpentBy))
+			}
+			delete(db.Outputs, key)
+		}
+	}
+	for _, in := range record.Tx.Inputs {
+		if out, ok := db.Outputs[outpoint(in.ID, in.Out)]; ok && bytes.Equal(out.SpentBy, record.Tx.ID) {
+			out.SpentBy = nil
+		}
+	}
+}
+
+// Confirmations returns how many blocks confirm something at height, 0
+// while it is pending.
+func (db *DB) Confirmations(height int) int {
+	if height == Unconfirmed {
+		return 0
+	}
+
+	return db.Height - height + 1
+}
+
+// IsMature reports whether an output can be counted as confirmed balance.
+func (db *DB) IsMature(out *Output) bool {
+	return !out.Coinbase || db.Confirmations(out.Height) >= CoinbaseMaturity
+}
+
+// Balance adds up the unspent outputs of the spendable addresses, or of
+// the watch-only ones. Outputs spent by pending transactions count in
+// neither, while their change counts as unconfirmed.
+func (db *DB) Balance(watchOnly bool) Balance {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var balance Balance
+	for _, out := range db.Outputs {
+		if out.SpentBy != nil || db.Keys[hex.EncodeToString(out.PubKeyHash)].WatchOnly != watchOnly {
+			continue
+		}
+		switch {
+		case out.Height == Unconfirmed:
+			balance.Unconfirmed += out.Value
+		case !db.IsMature(out):
+			balance.Immature += out.Value
+		default:
+			balance.Confirmed += out.Value
+		}
+	}
+
+	return balance
+}
+
+// Unspent returns the wallet's unspent outputs, oldest first.
+func (db *DB) Unspent() []*Output {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var outputs []*Output
+	for _, out := range db.Outputs {
+		if out.SpentBy == nil {
+			outputs = append(outputs, out)
+		}
+	}
+	sort.Slice(outputs, func(i, j int) bool {
+		a, b := outputs[i], outputs[j]
+		if a.Height != b.Height {
+			return a.Height != Unconfirmed && (b.Height == Unconfirmed || a.Height < b.Height)
+		}
+		if c := bytes.Compare(a.TxID, b.TxID); c != 0 {
+			return c < 0
+		}
+		return a.Index < b.Index
+	})
+
+	return outputs
+}
+
+// History returns the wallet's transactions in the order they confirmed,
+// pending ones last.
+func (db *DB) History() []*TxRecord {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var records []*TxRecord
+	for _, record := range db.Transactions {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Height != b.Height {
+			return a.Height != Unconfirmed && (b.Height == Unconfirmed || a.Height < b.Height)
+		}
+		return a.Added.Before(b.Added)
+	})
+
+	return records
+}
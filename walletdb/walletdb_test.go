@@ -0,0 +1,276 @@
+package walletdb
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mapfumo/golang-blockchain/blockchain"
+)
+
+var (
+	ours      = []byte("ours")
+	change    = []byte("change")
+	watched   = []byte("watched")
+	theirs    = []byte("theirs")
+	txCounter = 0
+)
+
+func newDB() *DB {
+	db := &DB{}
+	db.reset(map[string]Key{
+		hex.EncodeToString(ours):    {},
+		hex.EncodeToString(change):  {Change: true},
+		hex.EncodeToString(watched): {WatchOnly: true},
+	})
+
+	return db
+}
+
+func coinbase(to []byte, value int) *blockchain.Transaction {
+	txCounter++
+	return &blockchain.Transaction{
+		ID:      []byte(fmt.Sprintf("coinbase-%d", txCounter)),
+		Inputs:  []blockchain.TxInput{{ID: []byte{}, Out: -1}},
+		Outputs: []blockchain.TxOutput{{Value: value, PubKeyHash: to}},
+	}
+}
+
+// spend spends output index of prev, paying each value to the matching
+// key hash.
+func spend(prev *blockchain.Transaction, index int, payees [][]byte, values ...int) *blockchain.Transaction {
+	txCounter++
+	tx := &blockchain.Transaction{
+		ID:     []byte(fmt.Sprintf("tx-%d", txCounter)),
+		Inputs: []blockchain.TxInput{{ID: prev.ID, Out: index}},
+	}
+	for i, value := range values {
+		tx.Outputs = append(tx.Outputs, blockchain.TxOutput{Value: value, PubKeyHash: payees[i]})
+	}
+
+	return tx
+}
+
+func block(db *DB, txs ...*blockchain.Transaction) *blockchain.Block {
+	height := db.Height + 1
+	if db.Tip == nil {
+		height = 0
+	}
+
+	return &blockchain.Block{
+		Hash:         []byte(fmt.Sprintf("block-%d-%d", height, txCounter)),
+		PrevHash:     db.Tip,
+		Transactions: txs,
+		Height:       height,
+	}
+}
+
+func connect(t *testing.T, db *DB, txs ...*blockchain.Transaction) {
+	if err := db.BlockConnected(block(db, txs...)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBalance(t *testing.T) {
+	db := newDB()
+	reward := coinbase(ours, 20)
+	connect(t, db, reward, coinbase(theirs, 20))
+	if got := db.Balance(false); got != (Balance{Immature: 20}) {
+		t.Errorf("expected a fresh coinbase to be immature, got %+v", got)
+	}
+
+	for i := 1; i < CoinbaseMaturity; i++ {
+		connect(t, db, coinbase(theirs, 20))
+	}
+	if got := db.Balance(false); got != (Balance{Confirmed: 20}) {
+		t.Errorf("expected a mature coinbase to be confirmed, got %+v", got)
+	}
+
+	// A pending payment takes its inputs out of the confirmed balance and
+	// adds its change as unconfirmed.
+	pay := spend(reward, 0, [][]byte{theirs, change, watched}, 5, 12, 3)
+	db.AddTransaction(pay)
+	if got := db.Balance(false); got != (Balance{Unconfirmed: 12}) {
+		t.Errorf("unexpected balance with a pending payment %+v", got)
+	}
+	if got := db.Balance(true); got != (Balance{Unconfirmed: 3}) {
+		t.Errorf("unexpected watch-only balance %+v", got)
+	}
+
+	connect(t, db, pay)
+	if got := db.Balance(false); got != (Balance{Confirmed: 12}) {
+		t.Errorf("unexpected balance once the payment confirmed %+v", got)
+	}
+
+	history := db.History()
+	last := history[len(history)-1]
+	if string(last.Tx.ID) != string(pay.ID) || last.Sent != 20 || last.Received != 3 || last.Change != 12 || last.Net() != -5 || db.Confirmations(last.Height) != 1 {
+		t.Errorf("unexpected history entry %+v", last)
+	}
+	unspent := db.Unspent()
+	if len(unspent) != 2 {
+		t.Fatalf("expected 2 unspent outputs, got %d", len(unspent))
+	}
+	for _, out := range unspent {
+		if out.Change != bytes.Equal(out.PubKeyHash, change) {
+			t.Errorf("expected only the output to the change address to be change, got %+v", out)
+		}
+	}
+
+	// Coins sent to a change address by someone else are not change.
+	gift := spend(coinbase(theirs, 7), 0, [][]byte{change}, 7)
+	connect(t, db, gift)
+	if record := db.Transactions[hex.EncodeToString(gift.ID)]; record.Received != 7 || record.Change != 0 {
+		t.Errorf("unexpected record of a payment to a change address %+v", record)
+	}
+
+	if err := db.BlockConnected(&blockchain.Block{Hash: []byte("stray"), PrevHash: []byte("elsewhere")}); err != ErrNotConnected {
+		t.Errorf("expected ErrNotConnected, got %v", err)
+	}
+	// Transactions not touching the wallet are not recorded.
+	if _, ok := db.Transactions[hex.EncodeToString(spend(coinbase(theirs, 1), 0, [][]byte{theirs}, 1).ID)]; ok {
+		t.Errorf("expected a foreign transaction to be ignored")
+	}
+}
+
+func TestPendingReplacementAndExpiry(t *testing.T) {
+	db := newDB()
+	funding := spend(coinbase(theirs, 50), 0, [][]byte{ours}, 50)
+	connect(t, db, funding)
+
+	first := spend(funding, 0, [][]byte{theirs, ours}, 10, 39)
+	child := spend(first, 1, [][]byte{theirs}, 38)
+	db.AddTransaction(first)
+	db.AddTransaction(child)
+	if len(db.Transactions) != 3 {
+		t.Fatalf("expected 3 transactions, got %d", len(db.Transactions))
+	}
+
+	// A replacement drops the transaction it double spends and its child.
+	replacement := spend(funding, 0, [][]byte{theirs, ours}, 10, 37)
+	db.AddTransaction(replacement)
+	if _, ok := db.Transactions[hex.EncodeToString(child.ID)]; ok || len(db.Transactions) != 2 {
+		t.Errorf("expected the replaced transaction and its child to be dropped")
+	}
+	if got := db.Balance(false); got != (Balance{Unconfirmed: 37}) {
+		t.Errorf("unexpected balance after replacement %+v", got)
+	}
+
+	db.AddTransaction(first)
+	if db.Expire(time.Now(), time.Hour) != 0 {
+		t.Errorf("expected a new transaction to stay")
+	}
+	if db.Expire(time.Now().Add(2*time.Hour), time.Hour) != 1 || db.Balance(false).Confirmed != 50 {
+		t.Errorf("expected an old transaction to expire")
+	}
+
+	// A block confirming a double spend drops the pending transaction.
+	db.AddTransaction(first)
+	connect(t, db, replacement)
+	if _, ok := db.Transactions[hex.EncodeToString(first.ID)]; ok {
+		t.Errorf("expected a transaction conflicting with the chain to be dropped")
+	}
+	db.AddTransaction(first)
+	if _, ok := db.Transactions[hex.EncodeToString(first.ID)]; ok {
+		t.Errorf("expected a double spend of a confirmed spend to be ignored")
+	}
+}
+
+func TestSaveAndOpen(t *testing.T) {
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.Mkdir("tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := map[string]Key{hex.EncodeToString(ours): {}}
+	db, err := Open("test", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funding := coinbase(ours, 20)
+	connect(t, db, funding)
+	pending := spend(funding, 0, [][]byte{ours}, 19)
+	db.AddTransaction(pending)
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Open("test", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Height != db.Height || len(loaded.Transactions) != 2 || loaded.Balance(false) != db.Balance(false) {
+		t.Errorf("expected the saved database back")
+	}
+
+	// New addresses are only added.
+	keys[hex.EncodeToString(change)] = Key{Change: true}
+	added, err := Open("test", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.Height != db.Height || len(added.Transactions) != 2 || len(added.Keys) != 2 {
+		t.Errorf("expected the new address to be added without a rescan")
+	}
+
+	// An address changing type needs a rescan, which keeps the pending
+	// transactions.
+	keys[hex.EncodeToString(ours)] = Key{WatchOnly: true}
+	rebuilt, err := Open("test", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt.Tip != nil || len(rebuilt.Transactions) != 0 || len(rebuilt.rescan) != 1 {
+		t.Errorf("expected the database to be rebuilt with its pending transaction")
+	}
+
+	// So does one asked for after importing addresses.
+	keys[hex.EncodeToString(ours)] = Key{}
+	db.Rescan()
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+	rescanned, err := Open("test", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rescanned.Tip != nil || rescanned.RescanPending || len(rescanned.rescan) != 1 {
+		t.Errorf("expected the asked for rescan")
+	}
+}
+
+func TestSetKeys(t *testing.T) {
+	db := newDB()
+	funding := coinbase(ours, 20)
+	connect(t, db, funding)
+
+	keys := make(map[string]Key)
+	for hash, key := range db.Keys {
+		keys[hash] = key
+	}
+	keys[hex.EncodeToString(theirs)] = Key{Change: true}
+	db.SetKeys(keys)
+	if db.Tip == nil || len(db.Keys) != 4 {
+		t.Fatalf("expected a new address to be added without a rescan")
+	}
+	connect(t, db, spend(funding, 0, [][]byte{theirs}, 20))
+	if db.Balance(false).Confirmed != 20 {
+		t.Errorf("expected the new address to be paid, got %+v", db.Balance(false))
+	}
+
+	db.SetKeys(map[string]Key{
+		hex.EncodeToString(ours):   {},
+		hex.EncodeToString(change): {Change: true},
+		hex.EncodeToString(theirs): {Change: true},
+	})
+	if db.Tip != nil || len(db.Outputs) != 0 {
+		t.Errorf("expected a removed address to rebuild the database")
+	}
+}